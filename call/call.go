@@ -0,0 +1,42 @@
+package call
+
+import "fmt"
+
+const (
+	// Directions of a hall call.
+	DIRECTION_UP   = "up"
+	DIRECTION_DOWN = "down"
+)
+
+type (
+	// A press of the up or down button on a floor's hall panel.
+	// Hall calls are scheduled on an elevator, which answers by stopping at the floor.
+	HallCall struct {
+		Floor     int    `json:"floor"`
+		Direction string `json:"direction"` // up or down.
+	}
+
+	// A press of a floor button on a car's operating panel.
+	// Car calls go straight to the car, which stops at the floor on its way.
+	CarCall struct {
+		GroupId    string `json:"groupId"`
+		ElevatorId string `json:"elevatorId"`
+		Floor      int    `json:"floor"`
+	}
+)
+
+// Returns an error if the hall call's direction isn't up or down.
+func (h *HallCall) Validate() error {
+	if h.Direction != DIRECTION_UP && h.Direction != DIRECTION_DOWN {
+		return fmt.Errorf("Direction must be %s or %s.", DIRECTION_UP, DIRECTION_DOWN)
+	}
+	return nil
+}
+
+// Returns 1 for an up call and -1 for a down call.
+func (h *HallCall) Step() int {
+	if h.Direction == DIRECTION_DOWN {
+		return -1
+	}
+	return 1
+}
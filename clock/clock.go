@@ -0,0 +1,85 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// Tells the time.  Lets elevators run on real time, or on a fake time advanced by tests and simulations.
+	Clock interface {
+		// Returns the current time.
+		Now() time.Time
+
+		// Returns a channel that receives the time every interval d.  Ticks are dropped for slow receivers.
+		Tick(d time.Duration) <-chan time.Time
+	}
+
+	// The system clock.
+	Real struct{}
+
+	// A clock that only moves when advanced.
+	Fake struct {
+		mu      sync.Mutex
+		now     time.Time
+		tickers []*fakeTicker
+	}
+
+	// A ticker on a fake clock.
+	fakeTicker struct {
+		interval time.Duration
+		next     time.Time
+		c        chan time.Time
+	}
+)
+
+// Returns the current time.
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// Returns a channel that receives the time every interval d.
+func (Real) Tick(d time.Duration) <-chan time.Time {
+	return time.Tick(d)
+}
+
+// Returns a fake clock set to start.
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start}
+}
+
+// Returns the fake time.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// Returns a channel that receives the fake time every interval d as the clock is advanced.
+func (f *Fake) Tick(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := &fakeTicker{interval: d, next: f.now.Add(d), c: make(chan time.Time, 1)}
+	f.tickers = append(f.tickers, t)
+	return t.c
+}
+
+// Moves the fake time forward by d, firing every ticker whose interval has passed.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+	for _, t := range f.tickers {
+		for !t.next.After(f.now) {
+			select {
+			case t.c <- t.next:
+			default:
+				// Like time.Ticker, drop ticks the receiver isn't ready for.
+			}
+			t.next = t.next.Add(t.interval)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeAdvance(t *testing.T) {
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+
+	f.Advance(90 * time.Second)
+	if !f.Now().Equal(start.Add(90 * time.Second)) {
+		t.Errorf("Got %v but wanted %v", f.Now(), start.Add(90*time.Second))
+	}
+}
+
+func TestFakeTick(t *testing.T) {
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+	c := f.Tick(time.Second)
+
+	f.Advance(500 * time.Millisecond)
+	select {
+	case <-c:
+		t.Fatal("Ticked before the interval passed.")
+	default:
+	}
+
+	f.Advance(500 * time.Millisecond)
+	select {
+	case now := <-c:
+		if !now.Equal(start.Add(time.Second)) {
+			t.Errorf("Got tick at %v but wanted %v", now, start.Add(time.Second))
+		}
+	default:
+		t.Fatal("Expected a tick.")
+	}
+
+	// Ticks the receiver isn't ready for are dropped.
+	f.Advance(5 * time.Second)
+	<-c
+	select {
+	case <-c:
+		t.Error("Expected missed ticks to be dropped.")
+	default:
+	}
+}
@@ -0,0 +1,212 @@
+package door
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// Door states
+	STATE_CLOSED     = iota
+	STATE_OPENING    // Moving from closed to open.
+	STATE_OPEN       // Fully open.  Closes on its own after the dwell time.
+	STATE_CLOSING    // Moving from open to closed.
+	STATE_HELD       // Held open by a door-hold request.
+	STATE_OBSTRUCTED // Something is in the doorway.  Stays open until the obstruction clears.
+)
+
+type (
+	// How long each step of a door cycle takes.  Zero timings make the step instant.
+	Timings struct {
+		OpenTime  time.Duration // Time to open the doors.
+		DwellTime time.Duration // Time the doors stay open before closing.
+		CloseTime time.Duration // Time to close the doors.
+	}
+
+	// A set of elevator doors.  Doors open on request, stay open for the dwell time,
+	// then close on their own.  Doors start closed.
+	// Time is passed in by the caller, which keeps the doors in step with the elevator's own clock.
+	Door struct {
+		Timings
+
+		mu        sync.Mutex
+		state     int
+		since     time.Time // When the doors entered their current state.
+		holdUntil time.Time // When a door-hold request ends.
+		opened    bool      // True once the doors have opened since the last Open request.
+	}
+)
+
+// Returns the current state of the doors.
+func (d *Door) State() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.state
+}
+
+// Returns true if the doors are fully closed.  The elevator can only move while they are.
+func (d *Door) IsClosed() bool {
+	return d.State() == STATE_CLOSED
+}
+
+// Returns true if the doors have opened since the last Open request, so passengers can get on and off.
+func (d *Door) Opened() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.opened
+}
+
+// Starts a door cycle.  Closed or closing doors start opening.  Doors that are already open stay open for a fresh dwell.
+func (d *Door) Open(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch d.state {
+	case STATE_CLOSED, STATE_CLOSING:
+		d.opened = false
+		d.set(STATE_OPENING, now)
+	case STATE_OPEN:
+		d.since = now
+	}
+	d.advance(now)
+}
+
+// Holds the doors open for the given time, e.g. while a passenger presses the door-open button.
+// Closing doors reopen first.  Closed doors stay closed, since the elevator may be moving.
+// Returns false if the doors are closed.
+func (d *Door) Hold(now time.Time, hold time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch d.state {
+	case STATE_CLOSED:
+		return false
+	case STATE_CLOSING:
+		d.set(STATE_OPENING, now)
+	case STATE_OPEN:
+		d.set(STATE_HELD, now)
+	}
+
+	d.holdUntil = now.Add(hold)
+	d.advance(now)
+	return true
+}
+
+// Ends a door-hold request.  The doors stay open for a fresh dwell, then close.
+func (d *Door) Release(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.holdUntil = time.Time{}
+	if d.state == STATE_HELD {
+		d.set(STATE_OPEN, now)
+	}
+	d.advance(now)
+}
+
+// Reports something in the doorway.  Doors that aren't closed reopen and stay open until the obstruction clears.
+// Returns false if the doors are closed.
+func (d *Door) Obstruct(now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.state == STATE_CLOSED {
+		return false
+	}
+
+	// The doorway is open far enough for someone to be in it.
+	d.opened = true
+	d.set(STATE_OBSTRUCTED, now)
+	return true
+}
+
+// Reports the doorway is clear.  The doors stay open for a fresh dwell, then close.
+func (d *Door) Clear(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.state == STATE_OBSTRUCTED {
+		if now.Before(d.holdUntil) {
+			d.set(STATE_HELD, now)
+		} else {
+			d.set(STATE_OPEN, now)
+		}
+	}
+	d.advance(now)
+}
+
+// Moves the doors through every step that has finished by now.
+func (d *Door) Tick(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.advance(now)
+}
+
+// Moves the doors through every step that has finished by now.  Each step starts when the last one ended,
+// so zero timings run a whole cycle at once.  Must be called with the lock held.
+func (d *Door) advance(now time.Time) {
+	for {
+		switch d.state {
+		case STATE_OPENING:
+			if now.Sub(d.since) < d.OpenTime {
+				return
+			}
+			d.opened = true
+			if now.Before(d.holdUntil) {
+				d.set(STATE_HELD, d.since.Add(d.OpenTime))
+			} else {
+				d.set(STATE_OPEN, d.since.Add(d.OpenTime))
+			}
+
+		case STATE_HELD:
+			if now.Before(d.holdUntil) {
+				return
+			}
+			d.set(STATE_OPEN, d.holdUntil)
+
+		case STATE_OPEN:
+			if now.Sub(d.since) < d.DwellTime {
+				return
+			}
+			d.set(STATE_CLOSING, d.since.Add(d.DwellTime))
+
+		case STATE_CLOSING:
+			if now.Sub(d.since) < d.CloseTime {
+				return
+			}
+			d.set(STATE_CLOSED, d.since.Add(d.CloseTime))
+
+		default:
+			// Closed and obstructed doors only change on request.
+			return
+		}
+	}
+}
+
+// Moves the doors into a new state.  Must be called with the lock held.
+func (d *Door) set(state int, since time.Time) {
+	d.state = state
+	d.since = since
+}
+
+// Translates one of the const States into human-readable text.
+func StateName(state int) string {
+	switch state {
+	case STATE_CLOSED:
+		return "CLOSED"
+	case STATE_OPENING:
+		return "OPENING"
+	case STATE_OPEN:
+		return "OPEN"
+	case STATE_CLOSING:
+		return "CLOSING"
+	case STATE_HELD:
+		return "HELD"
+	case STATE_OBSTRUCTED:
+		return "OBSTRUCTED"
+	}
+	return "UNKNOWN"
+}
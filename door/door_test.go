@@ -0,0 +1,167 @@
+package door
+
+import (
+	"testing"
+	"time"
+)
+
+// Returns a time the given number of seconds after start.
+func after(start time.Time, seconds int) time.Time {
+	return start.Add(time.Duration(seconds) * time.Second)
+}
+
+func newDoor() *Door {
+	return &Door{Timings: Timings{OpenTime: 2 * time.Second, DwellTime: 3 * time.Second, CloseTime: 2 * time.Second}}
+}
+
+func TestDoorCycle(t *testing.T) {
+	d := newDoor()
+	start := time.Now()
+
+	steps := []struct {
+		seconds int
+		state   int
+	}{
+		{1, STATE_OPENING},
+		{2, STATE_OPEN},
+		{4, STATE_OPEN},
+		{5, STATE_CLOSING},
+		{7, STATE_CLOSED},
+	}
+
+	d.Open(start)
+	for _, step := range steps {
+		d.Tick(after(start, step.seconds))
+		if d.State() != step.state {
+			t.Errorf("At %ds expected %s but got %s", step.seconds, StateName(step.state), StateName(d.State()))
+		}
+	}
+
+	if !d.Opened() {
+		t.Error("Expected the doors to have opened.")
+	}
+}
+
+func TestZeroTimingsCycleAtOnce(t *testing.T) {
+	d := &Door{}
+	d.Open(time.Now())
+
+	if !d.Opened() || !d.IsClosed() {
+		t.Errorf("Expected a whole door cycle but doors are %s", StateName(d.State()))
+	}
+}
+
+func TestTickCatchesUpOnMissedSteps(t *testing.T) {
+	d := newDoor()
+	start := time.Now()
+
+	d.Open(start)
+	d.Tick(after(start, 10))
+
+	if !d.IsClosed() {
+		t.Errorf("Expected closed doors but got %s", StateName(d.State()))
+	}
+}
+
+func TestHoldKeepsDoorsOpen(t *testing.T) {
+	d := newDoor()
+	start := time.Now()
+
+	d.Open(start)
+	d.Tick(after(start, 2))
+
+	if !d.Hold(after(start, 2), 10*time.Second) {
+		t.Fatal("Expected open doors to be held.")
+	}
+
+	d.Tick(after(start, 11))
+	if d.State() != STATE_HELD {
+		t.Errorf("Expected held doors but got %s", StateName(d.State()))
+	}
+
+	// The hold ends, then the doors dwell before closing.
+	d.Tick(after(start, 14))
+	if d.State() != STATE_OPEN {
+		t.Errorf("Expected open doors after the hold but got %s", StateName(d.State()))
+	}
+
+	d.Tick(after(start, 17))
+	if !d.IsClosed() {
+		t.Errorf("Expected closed doors but got %s", StateName(d.State()))
+	}
+}
+
+func TestReleaseEndsHold(t *testing.T) {
+	d := newDoor()
+	start := time.Now()
+
+	d.Open(start)
+	d.Hold(after(start, 1), time.Minute)
+	d.Tick(after(start, 5))
+
+	d.Release(after(start, 5))
+	d.Tick(after(start, 10))
+
+	if !d.IsClosed() {
+		t.Errorf("Expected closed doors but got %s", StateName(d.State()))
+	}
+}
+
+func TestHoldReopensClosingDoors(t *testing.T) {
+	d := newDoor()
+	start := time.Now()
+
+	d.Open(start)
+	d.Tick(after(start, 6))
+	d.Hold(after(start, 6), 5*time.Second)
+
+	d.Tick(after(start, 8))
+	if d.State() != STATE_HELD {
+		t.Errorf("Expected the doors to reopen and be held but got %s", StateName(d.State()))
+	}
+}
+
+func TestHoldIgnoredWhenClosed(t *testing.T) {
+	d := newDoor()
+
+	if d.Hold(time.Now(), time.Minute) || !d.IsClosed() {
+		t.Error("Expected closed doors to ignore a hold.")
+	}
+}
+
+func TestObstructionReopensDoors(t *testing.T) {
+	d := newDoor()
+	start := time.Now()
+
+	d.Open(start)
+	d.Tick(after(start, 6))
+	if d.State() != STATE_CLOSING {
+		t.Fatalf("Expected closing doors but got %s", StateName(d.State()))
+	}
+
+	d.Obstruct(after(start, 6))
+	d.Tick(after(start, 60))
+	if d.State() != STATE_OBSTRUCTED {
+		t.Errorf("Expected obstructed doors to stay open but got %s", StateName(d.State()))
+	}
+
+	// Once clear, the doors dwell again before closing.
+	d.Clear(after(start, 60))
+	d.Tick(after(start, 62))
+	if d.State() != STATE_OPEN {
+		t.Errorf("Expected open doors but got %s", StateName(d.State()))
+	}
+
+	d.Tick(after(start, 65))
+	if !d.IsClosed() {
+		t.Errorf("Expected closed doors but got %s", StateName(d.State()))
+	}
+}
+
+func TestObstructionIgnoredWhenClosed(t *testing.T) {
+	d := newDoor()
+
+	if d.Obstruct(time.Now()) || !d.IsClosed() {
+		t.Error("Expected closed doors to ignore an obstruction.")
+	}
+}
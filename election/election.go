@@ -0,0 +1,126 @@
+package election
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// How long to wait before campaigning again after a campaign fails.
+const CAMPAIGN_RETRY = 1 * time.Second
+
+// Returned by Campaign when it is stopped before the node becomes the leader.
+var ErrStopped = errors.New("Campaign stopped.")
+
+type (
+	// Elects one leader among the nodes of the cluster.
+	Elector interface {
+		// Blocks until the node is the leader.  Returns a channel that is closed when leadership is lost.
+		// Returns ErrStopped if stop is closed first.
+		Campaign(stop <-chan struct{}) (<-chan struct{}, error)
+
+		// Gives up leadership, if the node has it.
+		Resign() error
+
+		// Returns the id of the current leader, or "" if there is none.
+		Leader() (string, error)
+	}
+
+	// A background job that only runs on the leader.  It must return soon after stop is closed.
+	Task func(stop <-chan struct{})
+
+	// Campaigns for leadership and runs the registered tasks while the node is the leader.
+	Leadership struct {
+		Id      string // Identifies the node.  e.g. its host and port.
+		Elector Elector
+
+		mu      sync.Mutex
+		tasks   []Task
+		leading bool
+	}
+)
+
+// Registers a task to run each time the node becomes the leader.
+// Tasks registered while the node is already the leader start on its next term.
+func (l *Leadership) Register(task Task) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tasks = append(l.tasks, task)
+}
+
+// Returns true while the node is the leader.
+func (l *Leadership) IsLeader() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.leading
+}
+
+// Campaigns for leadership until stop is closed.  A nil stop campaigns forever.
+// Each time the node wins, the registered tasks run until leadership is lost.
+// Once stop is closed, the tasks are stopped and the node resigns.
+func (l *Leadership) Run(stop <-chan struct{}) {
+	for {
+		lost, err := l.Elector.Campaign(stop)
+		if err == ErrStopped {
+			return
+		}
+
+		if err != nil {
+			fmt.Printf("Could not campaign for leadership.  Retrying in %v.  Error: %v\n", CAMPAIGN_RETRY, err)
+			select {
+			case <-time.After(CAMPAIGN_RETRY):
+				continue
+			case <-stop:
+				return
+			}
+		}
+
+		if !l.lead(lost, stop) {
+			if err := l.Elector.Resign(); err != nil {
+				fmt.Printf("Could not resign leadership.  Error: %v\n", err)
+			}
+			return
+		}
+	}
+}
+
+// Runs the tasks until leadership is lost or stop is closed, then waits for every task to return.
+// Returns false if stop was closed.
+func (l *Leadership) lead(lost, stop <-chan struct{}) bool {
+	fmt.Printf("%s is now the leader.\n", l.Id)
+
+	l.mu.Lock()
+	l.leading = true
+	tasks := append([]Task(nil), l.tasks...)
+	l.mu.Unlock()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		wg.Add(1)
+		go func(task Task) {
+			defer wg.Done()
+			task(done)
+		}(task)
+	}
+
+	stopped := false
+	select {
+	case <-lost:
+		fmt.Printf("%s lost leadership.\n", l.Id)
+	case <-stop:
+		stopped = true
+	}
+
+	l.mu.Lock()
+	l.leading = false
+	l.mu.Unlock()
+
+	close(done)
+	wg.Wait()
+
+	return !stopped
+}
@@ -0,0 +1,87 @@
+package election_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davepersing/elevator-platform/election"
+	"github.com/davepersing/elevator-platform/memory_store"
+)
+
+// Returns a leadership campaigning as id whose task reports when it starts and stops.
+func newLeadership(st *memory_store.MemoryStore, id string, started, stopped chan string) *election.Leadership {
+	l := &election.Leadership{Id: id, Elector: st.NewElection(id)}
+	l.Register(func(stop <-chan struct{}) {
+		started <- id
+		<-stop
+		stopped <- id
+	})
+	return l
+}
+
+// Returns the next id sent on c, failing the test if none is sent within a second.
+func receive(t *testing.T, c chan string, what string) string {
+	select {
+	case id := <-c:
+		return id
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for a task to %s.", what)
+	}
+	return ""
+}
+
+func TestTasksOnlyRunOnTheLeader(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	st.Init()
+
+	started, stopped := make(chan string, 2), make(chan string, 2)
+	a, b := newLeadership(st, "a", started, stopped), newLeadership(st, "b", started, stopped)
+
+	stopA, stopB := make(chan struct{}), make(chan struct{})
+	doneA := make(chan struct{})
+	go func() {
+		a.Run(stopA)
+		close(doneA)
+	}()
+
+	if id := receive(t, started, "start"); id != "a" || !a.IsLeader() {
+		t.Fatalf("Expected a to lead but %s started", id)
+	}
+
+	go b.Run(stopB)
+	defer close(stopB)
+
+	if leader, _ := st.NewElection("b").Leader(); leader != "a" || b.IsLeader() {
+		t.Errorf("Expected a to stay the leader but got %q", leader)
+	}
+
+	// Stopping a stops its task before it resigns, and b takes over.
+	close(stopA)
+	if id := receive(t, stopped, "stop"); id != "a" {
+		t.Errorf("Expected a's task to stop but %s stopped", id)
+	}
+
+	if id := receive(t, started, "start"); id != "b" {
+		t.Errorf("Expected b to take over but %s started", id)
+	}
+
+	<-doneA
+	if a.IsLeader() {
+		t.Error("Expected a to no longer be the leader.")
+	}
+}
+
+func TestCampaignStops(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	st.Init()
+
+	if _, err := st.NewElection("a").Campaign(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+	if _, err := st.NewElection("b").Campaign(stop); err != election.ErrStopped {
+		t.Errorf("Expected ErrStopped but got %v", err)
+	}
+}
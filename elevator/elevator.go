@@ -3,14 +3,17 @@ package elevator
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
 
-	"github.com/coreos/etcd/client"
-	"github.com/davepersing/elevator-platform/etcd"
+	"github.com/davepersing/elevator-platform/call"
+	"github.com/davepersing/elevator-platform/clock"
+	"github.com/davepersing/elevator-platform/door"
+	"github.com/davepersing/elevator-platform/motion"
 	"github.com/davepersing/elevator-platform/passenger"
-	"golang.org/x/net/context"
+	"github.com/davepersing/elevator-platform/store"
 )
 
 const (
@@ -21,9 +24,23 @@ const (
 	STATE_MAINTENANCE
 	STATE_LOADING
 	STATE_UNLOADING
-	STATE_ERROR // This is really just convenience to set the response if the request times out to this node.
+	STATE_ERROR    // This is really just convenience to set the response if the request times out to this node.
+	STATE_DRAINING // Maintenance was requested.  Riders are delivered, so the elevator is parking before maintenance.
 )
 
+const (
+	// Directions of travel reported to passengers.
+	DIRECTION_UP   = "up"
+	DIRECTION_DOWN = "down"
+	DIRECTION_NONE = "none"
+)
+
+// How long a saved status stays alive in the store without being saved again.
+const STATUS_TTL = 2 * time.Second
+
+// How often the run loop moves the elevator.
+const TICK_INTERVAL = 1 * time.Second
+
 type (
 	// Defines an elevator.  Contains a current elevator status,
 	// information about the server, and known nodes in the cluster.
@@ -34,7 +51,30 @@ type (
 
 		ElevatorStatus // Current state of the elevator
 
-		*etcd.Etcd // Etcd
+		Doors door.Door // The car's doors.  Must be closed before the elevator moves.
+
+		// Held for each move and each door request.  Door requests come from the HTTP API while the run loop
+		// moves the elevator, so each waits for the move in progress and every check in a move sees the same doors.
+		doorsMu sync.Mutex
+
+		Motion motion.Profile // How the car moves between floors.  Moves one floor per tick if not enabled.
+		car    motion.Car
+		moved  time.Time // When the elevator last moved.
+
+		Store store.Store // Backing data store shared with the rest of the cluster.
+
+		Clock   clock.Clock // Tells the elevator the time.  Defaults to the system clock.
+		Stepped bool        // If true, the run loop isn't started and the elevator only moves when Step is called.
+
+		ParkingFloor int // The floor the elevator parks at before entering maintenance.  MinFloor if out of range.
+
+		// Hands a waiting passenger back to the scheduler when maintenance is requested.
+		// Returns false if the passenger couldn't be reassigned, in which case the elevator picks them up itself.
+		// Without it, every waiting passenger is picked up before the elevator parks.
+		Reassign func(p *passenger.Passenger) bool
+
+		draining bool // True once waiting passengers have been handed back for the current maintenance request.
+		heading  int  // 1 or -1 while the elevator is on a run up or down, 0 once it has been idle.
 	}
 
 	// Defines a status for a given elevator.
@@ -48,6 +88,28 @@ type (
 		CurrentState       int `json:"currentState"`       // Tracks the current state of the elevator.
 		CurrentTargetFloor int `json:"currentTargetFloor"` // Tracks the current highest/lowest floor the elevator is going to.
 
+		// Set while maintenance is requested.  The elevator takes no new calls, delivers its riders,
+		// and parks before entering STATE_MAINTENANCE.
+		MaintenanceRequested bool `json:"maintenanceRequested"`
+
+		DoorState string `json:"door"` // Human-readable state of the doors.
+
+		Position float64 `json:"position"` // Fractional floor the car is at.  e.g. 2.5 is halfway between floors 2 and 3.
+		Velocity float64 `json:"velocity"` // Meters per second.  Positive is up.
+
+		ServedFloors ServedFloors `json:"servedFloors"` // The floors the elevator stops at.
+
+		MaxCapacity   int `json:"maxCapacity"`   // The maximum number of persons the elevator can carry.  0 is unlimited.
+		CommittedLoad int `json:"committedLoad"` // Passengers riding plus passengers waiting to be picked up.
+
+		HallButtons []call.HallCall `json:"hallButtons"` // Lit hall buttons the elevator is answering, lowest floor first.
+		CarButtons  []int           `json:"carButtons"`  // Lit buttons on the car's operating panel, lowest floor first.
+
+		LastCallIndex uint64 `json:"lastCallIndex"` // Index of the last call consumed from the waiting queue.
+
+		PassengerWatcher   string `json:"passengerWatcher"`   // Connection state of the waiting queue watcher.
+		MaintenanceWatcher string `json:"maintenanceWatcher"` // Connection state of the maintenance mode watcher.
+
 		WaitingPassengers
 
 		Passengers []*passenger.Passenger `json:"passengers"` // The current number of passengers actually on the elevator.
@@ -64,94 +126,142 @@ type (
 // - One to run the timer to make an elevator move.
 // - One to start the scheduling server
 func (e *Elevator) Init() {
-	e.Etcd.Init()
+	e.Store.Init()
 
-	// Grab the possibly existing data from etcd.
+	// Without explicit ranges, the elevator stops at every floor it can access.
+	if len(e.ServedFloors.Ranges) == 0 {
+		e.ServedFloors.Ranges = []FloorRange{{Min: e.MinFloor, Max: e.MaxFloor}}
+	}
+
+	// Grab the possibly existing data from the store.
 	e.loadExistingStatus()
 
+	// Publish the status right away so the elevator can be scheduled before the first tick.
+	e.saveState()
+
 	e.startPassengerWatcher()
 
 	e.startMaintenanceWatcher()
 
-	e.startTimerLoop()
+	if !e.Stepped {
+		e.startTimerLoop()
+	}
+}
+
+// Moves the elevator into its next state at the clock's current time and saves its state.
+// This is one iteration of the run loop.  Tests and simulations call it directly on a Stepped elevator
+// to advance it deterministically, as fast as they like.
+func (e *Elevator) Step() {
+	e.doorsMu.Lock()
+	e.move(e.now())
+	e.doorsMu.Unlock()
+
+	e.saveState()
 }
 
-// Starts a timer to report status every one second and move the elevator to the next step.
+// Starts a timer to report status every TICK_INTERVAL and move the elevator to the next step.
 func (e *Elevator) startTimerLoop() {
 
 	go func(e *Elevator) {
-		c := time.Tick(1 * time.Second)
+		c := e.getClock().Tick(TICK_INTERVAL)
 		for range c {
 			// To get the ordered and pretty output, save the current state and add the moved state.
 			currStatus := "Current: " + e.prettyPrintStatus()
-			e.move()
-			e.saveState()
+			e.Step()
 			currStatus += "After:   " + e.prettyPrintStatus()
 			fmt.Println(currStatus)
 		}
 	}(e)
 }
 
-// Start a watcher to deal with adding new passengers.
-// TODO:  This goroutine crashes if etcd is unreachable
-// and will not re-run until the elevator is restarted.
-//
-// Retry logic would be extremely helpful here.
-func (e *Elevator) startPassengerWatcher() {
+// Returns the elevator's clock.
+func (e *Elevator) getClock() clock.Clock {
+	if e.Clock == nil {
+		return clock.Real{}
+	}
+	return e.Clock
+}
 
-	go func(e *Elevator) {
+// Returns the current time on the elevator's clock.
+func (e *Elevator) now() time.Time {
+	return e.getClock().Now()
+}
 
-		watcherOptions := client.WatcherOptions{AfterIndex: 0, Recursive: true}
-		watcher := e.Etcd.KeysApi.Watcher("/wait/"+e.getKey(), &watcherOptions)
-		for {
-			r, err := watcher.Next(context.Background())
-			if err != nil {
-				fmt.Printf("Error from watcher.  Error: %v", err)
-				return
-			}
-			// Need to process the passenger.
-			// Start in new goroutine so we don't block the possible next one.
-			go e.addNewWaitingPassengerFromNode(r.Node)
-		}
-	}(e)
+// Start a watcher to deal with adding new passengers.
+// Any passengers queued while the elevator was down are consumed before new ones.
+// The store reconnects the watcher on its own if it becomes unreachable.
+func (e *Elevator) startPassengerWatcher() {
+	e.Store.WatchCalls(e.getKey(), func(c *store.Call) {
+		e.consumeQueuedPassenger(c)
+	}, func(state string) {
+		e.setWatcherState(&e.PassengerWatcher, state)
+	})
 }
 
 // Start a watcher to deal with putting elevator into maintenance mode.
+// The store reconnects the watcher on its own if it becomes unreachable.
 func (e *Elevator) startMaintenanceWatcher() {
+	e.Store.WatchMaintenance(e.getKey(), func(mode string) {
+		e.updateMaintenanceMode(mode)
+	}, func(state string) {
+		e.setWatcherState(&e.MaintenanceWatcher, state)
+	})
+}
 
-	go func(e *Elevator) {
-
-		watcherOptions := client.WatcherOptions{AfterIndex: 0, Recursive: true}
-		watcher := e.Etcd.KeysApi.Watcher("/maintenance/"+e.getKey(), &watcherOptions)
-		for {
-			r, err := watcher.Next(context.Background())
-			if err != nil {
-				fmt.Printf("Error from watcher.  Error: %v", err)
-				return
-			}
-			// Start in new goroutine so we don't block the possible next one.
-			go e.updateMaintenanceModeFromNode(r.Node)
-		}
-	}(e)
+// Records the connection state of a watcher so it is published with the elevator's status.
+func (e *Elevator) setWatcherState(watcher *string, state string) {
+	e.WaitingPassengers.Lock()
+	*watcher = state
+	e.WaitingPassengers.Unlock()
 }
 
 // Moves the elevator into its next state.
 // This state is determined by the current status of the Passengers and Waiting Passengers.
-func (e *Elevator) move() {
+// The elevator only leaves a floor once its doors have opened and closed again.
+func (e *Elevator) move(now time.Time) {
+
+	var elapsed time.Duration
+	if !e.moved.IsZero() {
+		elapsed = now.Sub(e.moved)
+	}
+	e.moved = now
+
+	e.Doors.Tick(now)
+
+	e.pressCarButtons(now)
+
+	e.drain()
 
 	switch e.CurrentState {
 
 	// If Elevator is idling, constantly check for passengers.
 	case STATE_IDLE:
+		e.heading = 0
 
-		if len(e.Waiting) > 0 {
+		if len(e.Waiting) == 0 && len(e.Passengers) == 0 && e.isMaintenanceRequested() {
+			// Everyone has been delivered.  Park before going out of service.
+			e.CurrentState = STATE_DRAINING
+			return
+		}
+
+		// Riders who pressed a button in the car come first.
+		if len(e.Passengers) > 0 {
+			p := e.Passengers[0]
+			if p.DestinationFloor > e.CurrentFloor {
+				e.CurrentState = STATE_MOVING_UP
+			} else if p.DestinationFloor < e.CurrentFloor {
+				e.CurrentState = STATE_MOVING_DOWN
+			} else {
+				e.stopAt(STATE_UNLOADING, now)
+			}
+		} else if len(e.Waiting) > 0 {
 			p := e.Waiting[0]
 			if p.CurrentFloor > e.CurrentFloor {
 				e.CurrentState = STATE_MOVING_UP
 			} else if p.CurrentFloor < e.CurrentFloor {
 				e.CurrentState = STATE_MOVING_DOWN
 			} else {
-				e.CurrentState = STATE_LOADING
+				e.stopAt(STATE_LOADING, now)
 			}
 		}
 
@@ -162,20 +272,28 @@ func (e *Elevator) move() {
 			e.CurrentFloor < e.MaxFloor {
 
 			e.CurrentState = STATE_MOVING_UP
-			e.CurrentFloor++
+			if !e.travel(elapsed, 1) {
+				// Still between floors.
+				return
+			}
 
 			// We've "moved up" a floor.  Check to see if there are passengers to unload.
-			if e.getUnloadPassengerCountForFloor() > 0 {
-				e.CurrentState = STATE_UNLOADING
+			if e.getUnloadPassengerCountForFloor(e.CurrentFloor) > 0 {
+				e.stopAt(STATE_UNLOADING, now)
 				return
 			}
 
 			// Also check to see if we can load more passengers.
-			if e.getLoadPassengerCountForFloor() > 0 {
-				e.CurrentState = STATE_LOADING
+			if e.getLoadPassengerCountForFloor(e.CurrentFloor) > 0 {
+				e.stopAt(STATE_LOADING, now)
 				return
 			}
 
+			// Reached the top without a reason to stop.  Decide where to go from here.
+			if e.CurrentFloor >= e.MaxFloor {
+				e.CurrentState = STATE_IDLE
+			}
+
 		} else {
 			// Nothing left to do, so move self to IDLE.
 			e.CurrentState = STATE_IDLE
@@ -187,25 +305,41 @@ func (e *Elevator) move() {
 			e.CurrentFloor > e.MinFloor {
 
 			e.CurrentState = STATE_MOVING_DOWN
-			e.CurrentFloor--
+			if !e.travel(elapsed, -1) {
+				return
+			}
 
-			if e.getUnloadPassengerCountForFloor() > 0 {
-				e.CurrentState = STATE_UNLOADING
+			if e.getUnloadPassengerCountForFloor(e.CurrentFloor) > 0 {
+				e.stopAt(STATE_UNLOADING, now)
 				return
 			}
 
-			if e.getLoadPassengerCountForFloor() > 0 {
-				e.CurrentState = STATE_LOADING
+			if e.getLoadPassengerCountForFloor(e.CurrentFloor) > 0 {
+				e.stopAt(STATE_LOADING, now)
 				return
 			}
 
+			if e.CurrentFloor <= e.MinFloor {
+				e.CurrentState = STATE_IDLE
+			}
+
 		} else {
 			e.CurrentState = STATE_IDLE
 		}
 
 	case STATE_LOADING:
+		// Wait for the doors to open.
+		if !e.doorsOpened(now) {
+			return
+		}
+
 		// Elevator is currently loading passengers.
-		e.loadPassengers()
+		e.loadPassengers(now)
+
+		// Keep loading until the doors close.
+		if !e.Doors.IsClosed() {
+			return
+		}
 
 		// Passengers are loaded, now decide which direction we were going in.
 		if len(e.Passengers) > 0 {
@@ -215,11 +349,24 @@ func (e *Elevator) move() {
 			} else {
 				e.CurrentState = STATE_MOVING_DOWN
 			}
+		} else {
+			// Only hall calls were answered here.  Wait for a car call, or go to the next waiting passenger.
+			e.CurrentState = STATE_IDLE
 		}
 
 	case STATE_UNLOADING:
+		// Wait for the doors to open.
+		if !e.doorsOpened(now) {
+			return
+		}
+
 		// Elevator is currently unloading passengers.
-		e.unloadPassengers()
+		e.unloadPassengers(now)
+
+		// Keep unloading until the doors close.
+		if !e.Doors.IsClosed() {
+			return
+		}
 
 		// IF current passengers exist, they're priority.
 		// else if waiting passengers exist, then go to them.
@@ -256,62 +403,317 @@ func (e *Elevator) move() {
 				e.CurrentState = STATE_MOVING_DOWN
 			} else {
 
-				e.CurrentState = STATE_LOADING
+				e.stopAt(STATE_LOADING, now)
 			}
 		} else {
 
 			e.CurrentState = STATE_IDLE
 		}
 
+	case STATE_DRAINING:
+		// Travel to the parking floor without stopping.
+		parking := e.parkingFloor()
+		if e.CurrentFloor != parking || e.Velocity != 0 {
+			direction := 1
+			if e.Velocity < 0 || (e.Velocity == 0 && parking < e.CurrentFloor) {
+				direction = -1
+			}
+
+			if !e.travel(elapsed, direction) || e.CurrentFloor != parking {
+				return
+			}
+		}
+
+		e.CurrentState = STATE_MAINTENANCE
+
 	case STATE_MAINTENANCE:
-		// Doesn't respond to requests inputs.  Need to figure out a way to put an elevator in maintenance mode.
-		if len(e.Waiting) > 0 {
-			// TODO: Reschedule the passengers on a different lift.
+		// Doesn't respond to requests.  An elevator restored into maintenance with passengers, e.g. from a state
+		// saved before maintenance drained, delivers them first.
+		if len(e.Waiting) > 0 || len(e.Passengers) > 0 {
+			e.CurrentState = STATE_IDLE
 		}
+	}
+}
 
-		if len(e.Passengers) > 0 {
-			// Unload the passengers on the current floor.
-			//
-			// TODO:  Fix this.  Maintenance needs to be stored locally to
-			// return to the maintenance mode upon unloading the passengers.
-			// e.CurrentState = STATE_UNLOADING
-			e.unloadPassengers()
-			return
+// Starts or ends draining for maintenance.
+// When maintenance is first requested, the elevator publishes the request so the scheduler stops assigning it calls,
+// then hands its waiting passengers back to be reassigned in the background.  Riders are delivered by the normal run loop.
+// When the request is withdrawn, an elevator parking or in maintenance goes back into service.
+func (e *Elevator) drain() {
+	if !e.isMaintenanceRequested() {
+		e.draining = false
+		if e.CurrentState == STATE_DRAINING || e.CurrentState == STATE_MAINTENANCE {
+			e.CurrentState = STATE_IDLE
 		}
+		return
+	}
 
-		// This is bad implementation.  The state will change twice in the run loop.
-		e.CurrentState = STATE_MAINTENANCE
+	if e.draining {
+		return
+	}
+	e.draining = true
+
+	if e.Reassign == nil {
+		return
+	}
+
+	// Publish the request first, so none of the passengers are assigned straight back.
+	e.saveState()
+
+	e.WaitingPassengers.Lock()
+	waiting := e.Waiting
+	e.Waiting = make([]*passenger.Passenger, 0)
+	e.WaitingPassengers.Unlock()
+
+	var kept, handBack []*passenger.Passenger
+	for _, p := range waiting {
+		// Car calls were pressed by riders, so only this elevator can take them.
+		if p.CarCall {
+			kept = append(kept, p)
+		} else {
+			handBack = append(handBack, p)
+		}
+	}
+	e.keepWaiting(kept)
+
+	if e.Stepped {
+		// Stepped runs reassign in the move, so they stay deterministic.
+		e.reassign(handBack)
+		return
+	}
+
+	// Each reassignment is a round of store reads and writes.  Making them in the move would hold up the run loop,
+	// and with it the status the elevator is kept alive by.
+	go e.reassign(handBack)
+}
+
+// Hands each passenger to Reassign.  Passengers that couldn't be reassigned wait for this elevator again.
+func (e *Elevator) reassign(waiting []*passenger.Passenger) {
+	var kept []*passenger.Passenger
+	for _, p := range waiting {
+		if !e.Reassign(p) {
+			kept = append(kept, p)
+		}
+	}
+	e.keepWaiting(kept)
+}
+
+// Puts passengers back at the front of the waiting list.
+func (e *Elevator) keepWaiting(kept []*passenger.Passenger) {
+	if len(kept) == 0 {
+		return
+	}
+
+	e.WaitingPassengers.Lock()
+	e.Waiting = append(kept, e.Waiting...)
+	e.WaitingPassengers.Unlock()
+}
+
+// Returns true if maintenance has been requested.
+func (e *Elevator) isMaintenanceRequested() bool {
+	e.WaitingPassengers.Lock()
+	defer e.WaitingPassengers.Unlock()
+
+	return e.MaintenanceRequested
+}
+
+// Returns the floor the elevator parks at before maintenance.
+func (e *Elevator) parkingFloor() int {
+	if e.ParkingFloor < e.MinFloor || e.ParkingFloor > e.MaxFloor {
+		return e.MinFloor
+	}
+	return e.ParkingFloor
+}
+
+// Moves car calls from the waiting list into the car, since they were pressed by riders already on board.
+// Each is carried like a passenger to the floor pressed.
+// A press for the floor the car is stopped at reopens the doors, and is recorded as picked up and dropped off at now.
+// Pressing a button that is already lit changes nothing for the car: the press rides along with the lit one
+// and is dropped off with it.
+func (e *Elevator) pressCarButtons(now time.Time) {
+	e.WaitingPassengers.Lock()
+	var waiting, pressed []*passenger.Passenger
+	for _, p := range e.Waiting {
+		if p.CarCall {
+			pressed = append(pressed, p)
+		} else {
+			waiting = append(waiting, p)
+		}
+	}
+
+	if len(pressed) > 0 {
+		e.Waiting = waiting
+	}
+	e.WaitingPassengers.Unlock()
+
+	for _, p := range pressed {
+		p.CurrentFloor = e.CurrentFloor
+		p.PickedUpAt = now
+
+		if e.isStoppedAt(p.DestinationFloor) {
+			e.reopenDoors(now)
+			p.DroppedOffAt = now
+		} else {
+			e.addNewPassenger(p)
+		}
+		e.savePassenger(p)
 	}
 }
 
+// Returns true if the elevator is standing at the floor rather than passing it.
+func (e *Elevator) isStoppedAt(floor int) bool {
+	if e.CurrentFloor != floor || e.Velocity != 0 {
+		return false
+	}
+	return e.CurrentState == STATE_IDLE || e.CurrentState == STATE_LOADING || e.CurrentState == STATE_UNLOADING
+}
+
+// Opens the doors again at the current stop.  An idle elevator stops to unload, so it waits for the doors to close
+// before moving on.  Doors that are already open stay open for a fresh dwell.
+func (e *Elevator) reopenDoors(now time.Time) {
+	if e.CurrentState == STATE_IDLE {
+		e.stopAt(STATE_UNLOADING, now)
+		return
+	}
+	e.Doors.Open(now)
+}
+
+// Returns the lit hall buttons the elevator is answering and the lit buttons on its operating panel.
+// Must be called with the WaitingPassengers lock held.
+func (e *Elevator) litButtons() ([]call.HallCall, []int) {
+	hall := make([]call.HallCall, 0)
+	seenHall := make(map[call.HallCall]bool)
+	for _, p := range e.Waiting {
+		hc := call.HallCall{Floor: p.CurrentFloor, Direction: p.HallCall}
+		if p.HallCall != "" && !seenHall[hc] {
+			seenHall[hc] = true
+			hall = append(hall, hc)
+		}
+	}
+
+	sort.Slice(hall, func(i, j int) bool {
+		if hall[i].Floor != hall[j].Floor {
+			return hall[i].Floor < hall[j].Floor
+		}
+		return hall[i].Direction > hall[j].Direction // up before down.
+	})
+
+	car := make([]int, 0)
+	seenCar := make(map[int]bool)
+	for _, riders := range [][]*passenger.Passenger{e.Passengers, e.Waiting} {
+		for _, p := range riders {
+			if p.CarCall && !seenCar[p.DestinationFloor] {
+				seenCar[p.DestinationFloor] = true
+				car = append(car, p.DestinationFloor)
+			}
+		}
+	}
+	sort.Ints(car)
+
+	return hall, car
+}
+
+// Stops the elevator at the current floor to load or unload passengers, and opens the doors.
+func (e *Elevator) stopAt(state int, now time.Time) {
+	e.CurrentState = state
+	e.Doors.Open(now)
+}
+
+// Returns true once the doors have opened at the current stop.
+// Opens the doors if the elevator stopped without doing so, e.g. when restored from a saved state.
+func (e *Elevator) doorsOpened(now time.Time) bool {
+	if !e.Doors.Opened() && e.Doors.IsClosed() {
+		e.Doors.Open(now)
+	}
+	return e.Doors.Opened()
+}
+
+// Holds the doors open for the given time, e.g. while a passenger presses the door-open button.
+// Returns false if the doors are closed, since the elevator may be moving.
+func (e *Elevator) HoldDoor(hold time.Duration) bool {
+	e.doorsMu.Lock()
+	defer e.doorsMu.Unlock()
+
+	return e.Doors.Hold(e.now(), hold)
+}
+
+// Ends a door-hold request.  The doors close after the dwell time.
+func (e *Elevator) ReleaseDoor() {
+	e.doorsMu.Lock()
+	defer e.doorsMu.Unlock()
+
+	e.Doors.Release(e.now())
+}
+
+// Reports something in the doorway.  The doors reopen and stay open until ClearDoor is called.
+// Returns false if the doors are closed.
+func (e *Elevator) ObstructDoor() bool {
+	e.doorsMu.Lock()
+	defer e.doorsMu.Unlock()
+
+	return e.Doors.Obstruct(e.now())
+}
+
+// Reports the doorway is clear.  The doors close after the dwell time.
+func (e *Elevator) ClearDoor() {
+	e.doorsMu.Lock()
+	defer e.doorsMu.Unlock()
+
+	e.Doors.Clear(e.now())
+}
+
 // Loads passengers into the elevator.
 // Checks against the WaitingPassengers list to see if any passengers match
 // If so, add them to the Passengers list and remove them from WaitingPassengers.
-func (e *Elevator) loadPassengers() {
+// Each passenger loaded is recorded as picked up at now.
+// Hall calls for the floor are answered instead: they are recorded as picked up and dropped off at now,
+// and whoever is waiting presses a button in the car.  Only hall calls in the direction the elevator leaves in
+// are answered, or any hall call if the elevator has no other work.
+func (e *Elevator) loadPassengers(now time.Time) {
 	if len(e.Waiting) > 0 {
 		// If waiting passengers for this floor exist, load them into passengers.
-		var waitingPassengers []*passenger.Passenger
+		var waitingPassengers, halls, loaded []*passenger.Passenger
 
 		e.WaitingPassengers.Lock()
 
 		for _, p := range e.Waiting {
 			// Get the passengers waiting for this floor add all that are still waiting.
-			if p.CurrentFloor != e.CurrentFloor {
+			// Passengers that don't fit wait for the elevator to come back around.
+			if p.CarCall || p.CurrentFloor != e.CurrentFloor || e.isFull() {
 				waitingPassengers = append(waitingPassengers, p)
+			} else if p.HallCall != "" {
+				halls = append(halls, p)
 			} else {
+				p.PickedUpAt = now
 				e.addNewPassenger(p)
+				loaded = append(loaded, p)
 			}
 		}
 
+		// Decide on the hall calls once everyone else has boarded, since their trips set the direction.
 		e.Waiting = waitingPassengers
+		for _, p := range halls {
+			if e.answers(p, e.CurrentFloor) {
+				p.PickedUpAt = now
+				p.DroppedOffAt = now
+				loaded = append(loaded, p)
+			} else {
+				e.Waiting = append(e.Waiting, p)
+			}
+		}
 		e.WaitingPassengers.Unlock()
+
+		for _, p := range loaded {
+			e.savePassenger(p)
+		}
 	}
 }
 
 // Unloads passengers from the elevator.
 // Checks against the Passengers list to see if any passengers' destination floor matches the current floor.
 // If yes, remove them from the passengers list.
-func (e *Elevator) unloadPassengers() {
+// Each passenger unloaded is recorded as dropped off at now.
+func (e *Elevator) unloadPassengers(now time.Time) {
 
 	if len(e.Passengers) > 0 {
 
@@ -321,21 +723,112 @@ func (e *Elevator) unloadPassengers() {
 			// These will be the remaining passengers on the elevator.
 			if p.DestinationFloor != e.CurrentFloor {
 				passengers = append(passengers, p)
+			} else {
+				p.DroppedOffAt = now
+				e.savePassenger(p)
 			}
 		}
 		e.Passengers = passengers
 	}
 }
 
-// Returns a count of passengers to load for the current floor.
-func (e *Elevator) getLoadPassengerCountForFloor() int {
+// Saves the record of a passenger's trip so it can be looked up by id.
+// Passengers without an id, e.g. queued before ids were generated, aren't recorded.
+func (e *Elevator) savePassenger(p *passenger.Passenger) {
+	if p.Id == "" {
+		return
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		fmt.Printf("Could not marshal passenger.  Error: %v\n", err)
+		return
+	}
+
+	if err := e.Store.SavePassenger(p.Id, data, passenger.RECORD_TTL); err != nil {
+		fmt.Printf("Could not save passenger %s.  Error: %v\n", p.Id, err)
+	}
+}
+
+// Returns true if no more passengers can board the elevator.
+func (e *Elevator) isFull() bool {
+	return e.MaxCapacity > 0 && len(e.Passengers) >= e.MaxCapacity
+}
+
+// Moves the car in the given direction for the elapsed time.
+// Without a motion profile, the car moves exactly one floor.
+// Returns true once the car is at rest on a floor, ready to check for passengers.
+func (e *Elevator) travel(elapsed time.Duration, direction int) bool {
+	e.heading = direction
+
+	if !e.Motion.Enabled() {
+		e.CurrentFloor += direction
+		e.Position = float64(e.CurrentFloor)
+		return true
+	}
+
+	if e.car.Velocity == 0 {
+		// Starting from rest.
+		e.car.Height = e.Motion.Height(e.CurrentFloor)
+	}
+
+	lastFloor := e.MaxFloor
+	if direction < 0 {
+		lastFloor = e.MinFloor
+	}
+
+	floor, stopped := e.Motion.Travel(&e.car, direction, lastFloor, elapsed, e.shouldStopAt)
+
+	e.CurrentFloor = floor
+	e.Position = e.Motion.FloorAt(e.car.Height)
+	e.Velocity = e.car.Velocity
+
+	return stopped
+}
+
+// Returns true if the elevator has passengers to unload or load at the floor, or is parking there.
+func (e *Elevator) shouldStopAt(floor int) bool {
+	if e.CurrentState == STATE_DRAINING {
+		return floor == e.parkingFloor()
+	}
+	return e.getUnloadPassengerCountForFloor(floor) > 0 || e.getLoadPassengerCountForFloor(floor) > 0
+}
+
+// Returns true if the elevator stops at the floors the call needs.
+// Car calls only need the floor pressed, since the rider is already on board.
+func (e *Elevator) accepts(p *passenger.Passenger) bool {
+	if !e.ServedFloors.Serves(p.DestinationFloor) {
+		return false
+	}
+	return p.CarCall || e.ServedFloors.Serves(p.CurrentFloor)
+}
+
+// Returns the waiting passengers the elevator stops for.  The rest are dropped.
+func (e *Elevator) servedOnly(waiting []*passenger.Passenger) []*passenger.Passenger {
+	served := make([]*passenger.Passenger, 0, len(waiting))
+	for _, p := range waiting {
+		if !e.accepts(p) {
+			fmt.Printf("Elevator %s doesn't stop at floors %d and %d.  Dropping passenger %s.\n", e.getKey(), p.CurrentFloor, p.DestinationFloor, p.Id)
+			continue
+		}
+		served = append(served, p)
+	}
+	return served
+}
+
+// Returns a count of passengers to load for the given floor.
+// Passengers are never loaded at a floor the elevator doesn't serve.  Riders are still let off at one, so none are stranded.
+func (e *Elevator) getLoadPassengerCountForFloor(floor int) int {
+	if !e.ServedFloors.Serves(floor) {
+		return 0
+	}
 
 	count := 0
 	e.WaitingPassengers.Lock()
 
 	for _, p := range e.WaitingPassengers.Waiting {
 
-		if p.CurrentFloor == e.CurrentFloor {
+		if p.CurrentFloor == floor && !p.CarCall && (p.HallCall == "" || e.answers(p, floor)) {
 			count++
 		}
 	}
@@ -343,12 +836,58 @@ func (e *Elevator) getLoadPassengerCountForFloor() int {
 	return count
 }
 
-// Returns a count of the passengers to unload for the current floor.
-func (e *Elevator) getUnloadPassengerCountForFloor() int {
+// Returns true if the elevator should answer the hall call when it stops at the floor:
+// the call is in the direction the elevator will leave in, or the elevator has no other work.
+// Must be called with the WaitingPassengers lock held.
+func (e *Elevator) answers(hall *passenger.Passenger, floor int) bool {
+	direction := e.directionFrom(floor)
+	return direction == DIRECTION_NONE || direction == hall.HallCall
+}
+
+// Returns the direction the elevator will leave the floor in.
+// On a run, it keeps going while it has riders to drop off or calls to answer further on, and turns back otherwise.
+// Starting from idle, it follows its first rider.  Returns DIRECTION_NONE if there is nothing else to do.
+// Must be called with the WaitingPassengers lock held.
+func (e *Elevator) directionFrom(floor int) string {
+	if e.heading == 0 {
+		for _, p := range e.Passengers {
+			if p.DestinationFloor > floor {
+				return DIRECTION_UP
+			} else if p.DestinationFloor < floor {
+				return DIRECTION_DOWN
+			}
+		}
+		return DIRECTION_NONE
+	}
+
+	above, below := false, false
+	for _, p := range e.Passengers {
+		above = above || p.DestinationFloor > floor
+		below = below || p.DestinationFloor < floor
+	}
+	for _, p := range e.Waiting {
+		if !p.CarCall {
+			above = above || p.CurrentFloor > floor
+			below = below || p.CurrentFloor < floor
+		}
+	}
+
+	// Keep going the way the run is heading while there is work that way.
+	if (e.heading > 0 && above) || (e.heading < 0 && above && !below) {
+		return DIRECTION_UP
+	}
+	if below {
+		return DIRECTION_DOWN
+	}
+	return DIRECTION_NONE
+}
+
+// Returns a count of the passengers to unload for the given floor.
+func (e *Elevator) getUnloadPassengerCountForFloor(floor int) int {
 
 	count := 0
 	for _, p := range e.Passengers {
-		if p.DestinationFloor == e.CurrentFloor {
+		if p.DestinationFloor == floor {
 			count++
 		}
 	}
@@ -358,23 +897,24 @@ func (e *Elevator) getUnloadPassengerCountForFloor() int {
 
 // Gets the key uniquely identifying the elevator in the cluster.
 func (e *Elevator) getKey() string {
-	return strconv.Itoa(e.GroupId) + "-" + strconv.Itoa(e.Id)
+	return store.Key(e.GroupId, e.Id)
 }
 
-// Loads existing status from etcd cluster.
+// Loads existing status from the store.
 func (e *Elevator) loadExistingStatus() error {
-	resp, err := e.KeysApi.Get(context.Background(), "elevators/"+e.getKey(), nil)
-	if err != nil {
-		fmt.Printf("Cannot get status.  Error: %+v\n", err)
+	data, err := e.Store.GetState(e.getKey())
+	if err != nil || data == nil {
 		return err
 	}
 
 	var status ElevatorStatus
-	if err = json.Unmarshal([]byte(resp.Node.Value), &status); err != nil {
-		fmt.Printf("Cannott unmarshal json from etcd. Error: %v\n", err)
+	if err = json.Unmarshal(data, &status); err != nil {
+		fmt.Printf("Cannott unmarshal json from store. Error: %v\n", err)
 		return err
 	}
 
+	waiting := e.servedOnly(e.keepAssigned(status.Waiting))
+
 	e.ElevatorStatus.Lock()
 	// Copying this manually because setting the whole status causes a go vet error on TravisCI.
 	// but not on my local machine running 1.6.2.
@@ -383,68 +923,109 @@ func (e *Elevator) loadExistingStatus() error {
 	e.ElevatorStatus.CurrentFloor = status.CurrentFloor
 	e.ElevatorStatus.CurrentState = status.CurrentState
 	e.ElevatorStatus.Passengers = status.Passengers
-	e.ElevatorStatus.Waiting = status.Waiting
+	e.ElevatorStatus.Waiting = waiting
+	e.ElevatorStatus.LastCallIndex = status.LastCallIndex
+	e.ElevatorStatus.MaintenanceRequested = status.MaintenanceRequested
 	e.ElevatorStatus.Unlock()
 	return nil
 }
 
+// Returns the waiting passengers still assigned to the elevator.
+// Passengers whose record shows their call was moved to another elevator while this one was down are dropped.
+func (e *Elevator) keepAssigned(waiting []*passenger.Passenger) []*passenger.Passenger {
+	kept := make([]*passenger.Passenger, 0, len(waiting))
+	for _, p := range waiting {
+		if p.Id != "" {
+			var record passenger.Passenger
+			data, err := e.Store.GetPassenger(p.Id)
+			if err == nil && data != nil && json.Unmarshal(data, &record) == nil &&
+				record.Elevator != "" && record.Elevator != e.getKey() {
+				fmt.Printf("Passenger %s was reassigned to elevator %s while %s was down.\n", p.Id, record.Elevator, e.getKey())
+				continue
+			}
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
 // Saves the current state of the elevator.
 // This is called on each full elevator Move.
 func (e *Elevator) saveState() error {
 
 	e.WaitingPassengers.Lock()
-	data, err := json.Marshal(e.ElevatorStatus)
-	e.WaitingPassengers.Unlock()
-
-	// Once with /elevators/<key>
-	// Current set to 3 seconds, but needs to change once the upper timer changes.
-	setOptions := client.SetOptions{TTL: time.Duration(2) * time.Second}
-	_, err = e.Etcd.KeysApi.Set(context.Background(), "elevator_status/"+e.getKey(), string(data), &setOptions)
-	if err != nil {
-		fmt.Printf("Error setting key to etcd.  Error: %s\n", err.Error())
-		return err
+	// Publish the capacity so the scheduler can avoid overfilling the elevator.
+	e.ElevatorStatus.MaxCapacity = e.MaxCapacity
+	e.CommittedLoad = len(e.Passengers) + len(e.Waiting)
+	e.DoorState = door.StateName(e.Doors.State())
+	e.HallButtons, e.CarButtons = e.litButtons()
+	if e.Velocity == 0 {
+		e.Position = float64(e.CurrentFloor)
 	}
+	data, err := json.Marshal(&e.ElevatorStatus)
+	e.WaitingPassengers.Unlock()
 
-	_, err = e.Etcd.KeysApi.Set(context.Background(), "elevators/"+e.getKey(), string(data), nil)
 	if err != nil {
-		fmt.Printf("Error setting key to etcd.  Error: %s\n", err.Error())
+		fmt.Printf("Could not marshal status.  Error: %v\n", err)
 		return err
 	}
 
-	return nil
+	// Current set to 2 seconds, but needs to change once the upper timer changes.
+	return e.Store.SetStatus(e.getKey(), data, STATUS_TTL)
 }
 
-func (e *Elevator) updateMaintenanceModeFromNode(node *client.Node) bool {
-	maintMode, err := strconv.ParseBool(node.Value)
+// Records a maintenance request.  The run loop drains the elevator on its next move.
+// Only the flag is set here, since the store may call this while holding its own locks.
+func (e *Elevator) updateMaintenanceMode(mode string) bool {
+	maintMode, err := strconv.ParseBool(mode)
 	if err != nil {
 		fmt.Printf("Could not update maintenance mode.  Error: %+v\n", err)
 		return false
 	}
 
-	if maintMode {
-		e.CurrentState = STATE_MAINTENANCE
-	} else {
-		e.CurrentState = STATE_IDLE
-	}
+	e.WaitingPassengers.Lock()
+	e.MaintenanceRequested = maintMode
+	e.WaitingPassengers.Unlock()
 
 	return true
 }
 
-// Adds a new passenger to the WaitingPassengers list.
-func (e *Elevator) addNewWaitingPassengerFromNode(node *client.Node) bool {
+// Consumes a passenger from the waiting queue and acknowledges it.
+// The consumed index is saved with the elevator's state before the call is acknowledged,
+// so a call left in the queue by a restart is never added twice.
+func (e *Elevator) consumeQueuedPassenger(c *store.Call) bool {
+	if c.Index <= e.LastCallIndex {
+		// Already consumed, but never acknowledged.
+		e.Store.AckCall(e.getKey(), c)
+		return false
+	}
+
 	var p passenger.Passenger
-	err := json.Unmarshal([]byte(node.Value), &p)
+	err := json.Unmarshal(c.Data, &p)
 	if err != nil {
 		fmt.Printf("Could not unmarshal passenger.  Error: %+v\n", err)
+		e.Store.AckCall(e.getKey(), c)
 		return false
 	}
 
-	ok := e.addNewWaitingPassenger(&p)
-	if ok {
-		e.saveState()
+	if !e.accepts(&p) {
+		fmt.Printf("Elevator %s doesn't stop at floors %d and %d.  Dropping call %s.\n", e.getKey(), p.CurrentFloor, p.DestinationFloor, c.Id)
+		e.Store.AckCall(e.getKey(), c)
+		return false
 	}
 
-	return ok
+	e.addNewWaitingPassenger(&p)
+
+	e.WaitingPassengers.Lock()
+	e.LastCallIndex = c.Index
+	e.WaitingPassengers.Unlock()
+
+	if err := e.saveState(); err != nil {
+		// Leave the call in the queue.  It will be picked up again on restart.
+		return false
+	}
+
+	return e.Store.AckCall(e.getKey(), c) == nil
 }
 
 func (e *Elevator) addNewWaitingPassenger(p *passenger.Passenger) bool {
@@ -472,28 +1053,45 @@ func (e *Elevator) addNewPassenger(p *passenger.Passenger) bool {
 	return true
 }
 
-// Translates the const States into human-readable text and returns a string representation of
-// the current state of the elevator.
-func (e *Elevator) prettyPrintStatus() string {
-	var currState string
-	switch e.CurrentState {
+// Returns the direction the elevator is travelling in.
+func (es *ElevatorStatus) Direction() string {
+	switch es.CurrentState {
+	case STATE_MOVING_UP:
+		return DIRECTION_UP
+	case STATE_MOVING_DOWN:
+		return DIRECTION_DOWN
+	}
+	return DIRECTION_NONE
+}
+
+// Translates one of the const States into human-readable text.
+func StateName(state int) string {
+	switch state {
 	case STATE_IDLE:
-		currState = "IDLE"
+		return "IDLE"
 	case STATE_MOVING_UP:
-		currState = "MOVING_UP"
+		return "MOVING_UP"
 	case STATE_MOVING_DOWN:
-		currState = "MOVING_DOWN"
+		return "MOVING_DOWN"
 	case STATE_LOADING:
-		currState = "LOADING"
+		return "LOADING"
 	case STATE_UNLOADING:
-		currState = "UNLOADING"
+		return "UNLOADING"
 	case STATE_MAINTENANCE:
-		currState = "MAINTENANCE"
+		return "MAINTENANCE"
+	case STATE_ERROR:
+		return "ERROR"
+	case STATE_DRAINING:
+		return "DRAINING"
 	}
+	return "UNKNOWN"
+}
 
+// Returns a string representation of the current state of the elevator.
+func (e *Elevator) prettyPrintStatus() string {
 	e.WaitingPassengers.Lock()
 	status := fmt.Sprintf("Elevator %d is on floor %d in state %s with %d passengers and %d waiting passengers.\n",
-		e.DisplayId, e.CurrentFloor, currState, len(e.Passengers), len(e.WaitingPassengers.Waiting))
+		e.DisplayId, e.CurrentFloor, StateName(e.CurrentState), len(e.Passengers), len(e.WaitingPassengers.Waiting))
 	e.WaitingPassengers.Unlock()
 
 	return status
@@ -1,11 +1,42 @@
 package elevator
 
 import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/davepersing/elevator-platform/door"
+	"github.com/davepersing/elevator-platform/memory_store"
+	"github.com/davepersing/elevator-platform/motion"
 	"github.com/davepersing/elevator-platform/passenger"
+	"github.com/davepersing/elevator-platform/store"
 )
 
+// An in-memory store that records every status saved and call acknowledged, in order.
+type recordingStore struct {
+	*memory_store.MemoryStore
+
+	ops        []string
+	failStatus bool // Fails every status save if set, like an unreachable store.
+}
+
+func (r *recordingStore) SetStatus(key string, data []byte, ttl time.Duration) error {
+	if r.failStatus {
+		return errors.New("store is unavailable")
+	}
+
+	r.ops = append(r.ops, "status "+key)
+	return r.MemoryStore.SetStatus(key, data, ttl)
+}
+
+func (r *recordingStore) AckCall(key string, c *store.Call) error {
+	r.ops = append(r.ops, "ack "+c.Id)
+	return r.MemoryStore.AckCall(key, c)
+}
+
 func TestMoveUpWithWaitingPassenger(t *testing.T) {
 	e := getBaseElevator()
 
@@ -14,7 +45,7 @@ func TestMoveUpWithWaitingPassenger(t *testing.T) {
 		t.Error("Error adding passenger to waiting list.")
 	}
 
-	e.move()
+	e.move(time.Now())
 
 	if e.CurrentState != STATE_MOVING_UP {
 		t.Error("Elevator should be moving up.  Passenger is waiting on floor 2")
@@ -30,7 +61,7 @@ func TestMoveDownWithWaitingPassenger(t *testing.T) {
 		t.Error("Error adding passenger to waiting list.")
 	}
 
-	e.move()
+	e.move(time.Now())
 
 	if e.CurrentState != STATE_MOVING_DOWN {
 		t.Errorf("Expected state is STATE_MOVING_DOWN but got %d", e.CurrentState)
@@ -46,13 +77,13 @@ func TestLoadPassengerAndMoveDown(t *testing.T) {
 		t.Error("Elevator should have loaded passenger.")
 	}
 
-	e.move()
+	e.move(time.Now())
 
 	if e.CurrentState != STATE_LOADING {
 		t.Errorf("Expected state is STATE_LOADING, but got %d", e.CurrentState)
 	}
 
-	e.move()
+	e.move(time.Now())
 	if len(e.Passengers) <= 0 {
 		t.Error("Passenger should have been loaded.")
 	}
@@ -73,13 +104,13 @@ func TestUnloadPassengerAndMoveUpToWaitingPassenger(t *testing.T) {
 		t.Error("Should have added passenger to waiting list.")
 	}
 
-	e.move()
+	e.move(time.Now())
 
 	if e.CurrentState != STATE_UNLOADING {
 		t.Errorf("State should be STATE_UNLOADING but got %d\n", e.CurrentState)
 	}
 
-	e.move()
+	e.move(time.Now())
 	if len(e.Passengers) > 0 {
 		t.Error("Should have unloaded all passengers.")
 	}
@@ -105,3 +136,208 @@ func getBaseElevator() *Elevator {
 		},
 	}
 }
+
+func TestLoadPassengersUpToCapacity(t *testing.T) {
+	e := getBaseElevator()
+	e.MaxCapacity = 2
+	e.CurrentFloor = 3
+
+	for i := 0; i < 3; i++ {
+		e.addNewWaitingPassenger(&passenger.Passenger{CurrentFloor: 3, DestinationFloor: 10})
+	}
+
+	e.loadPassengers(time.Now())
+
+	if len(e.Passengers) != 2 {
+		t.Errorf("Expected 2 passengers to board but got %d", len(e.Passengers))
+	}
+
+	if len(e.Waiting) != 1 {
+		t.Errorf("Expected 1 passenger left waiting but got %d", len(e.Waiting))
+	}
+}
+
+func TestServedFloorsWithExpressZone(t *testing.T) {
+	sf := ServedFloors{Ranges: []FloorRange{{Min: 1, Max: 1}, {Min: 20, Max: 25}}, Skip: []int{22}}
+
+	for floor, want := range map[int]bool{1: true, 2: false, 19: false, 20: true, 22: false, 25: true, 26: false} {
+		if sf.Serves(floor) != want {
+			t.Errorf("Serves(%d) should be %t", floor, want)
+		}
+	}
+
+	floors := sf.Floors()
+	if len(floors) != 6 || floors[0] != 1 || floors[1] != 20 || floors[3] != 23 {
+		t.Errorf("Unexpected served floors: %v", floors)
+	}
+}
+
+func TestServedFloorsDefaultToEveryFloor(t *testing.T) {
+	sf := ServedFloors{}
+
+	if !sf.Serves(100) {
+		t.Error("Elevator without published floors should serve every floor.")
+	}
+
+	if sf.Floors() != nil {
+		t.Error("Elevator without published floors should not list its floors.")
+	}
+}
+
+func TestDoorsMustCloseBeforeMoving(t *testing.T) {
+	e := getBaseElevator()
+	e.Doors.Timings = door.Timings{OpenTime: 2 * time.Second, DwellTime: 3 * time.Second, CloseTime: 2 * time.Second}
+	e.addNewWaitingPassenger(&passenger.Passenger{CurrentFloor: 1, DestinationFloor: 3})
+
+	start := time.Now()
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+
+	e.move(at(0))
+	if e.CurrentState != STATE_LOADING || e.Doors.State() != door.STATE_OPENING {
+		t.Fatalf("Expected loading with doors opening but got %d with doors %s", e.CurrentState, door.StateName(e.Doors.State()))
+	}
+
+	e.move(at(1))
+	if len(e.Passengers) != 0 {
+		t.Error("Passenger boarded before the doors opened.")
+	}
+
+	e.move(at(2))
+	if len(e.Passengers) != 1 || e.CurrentState != STATE_LOADING {
+		t.Errorf("Expected the passenger to board with the elevator still loading but got %d passengers in state %d", len(e.Passengers), e.CurrentState)
+	}
+
+	// Something blocks the doors as they close.  They reopen and the elevator waits.
+	e.move(at(6))
+	if !e.Doors.Obstruct(at(6)) {
+		t.Fatal("Expected closing doors to be obstructed.")
+	}
+
+	e.move(at(20))
+	if e.CurrentState != STATE_LOADING || e.Doors.State() != door.STATE_OBSTRUCTED {
+		t.Errorf("Expected the elevator to wait for the obstruction but got %d with doors %s", e.CurrentState, door.StateName(e.Doors.State()))
+	}
+
+	e.Doors.Clear(at(20))
+	e.move(at(24))
+	if e.CurrentState != STATE_LOADING {
+		t.Errorf("Expected the elevator to wait for the doors to close but got %d", e.CurrentState)
+	}
+
+	e.move(at(25))
+	if e.CurrentState != STATE_MOVING_UP {
+		t.Errorf("Expected STATE_MOVING_UP once the doors closed but got %d", e.CurrentState)
+	}
+}
+
+func TestMotionProfileMovesBetweenFloors(t *testing.T) {
+	e := getBaseElevator()
+	e.Motion = motion.Profile{Speed: 2, Acceleration: 1, FloorHeight: 3}
+	e.addNewWaitingPassenger(&passenger.Passenger{CurrentFloor: 5, DestinationFloor: 1})
+
+	start := time.Now()
+	e.move(start)
+	if e.CurrentState != STATE_MOVING_UP {
+		t.Fatalf("Expected STATE_MOVING_UP but got %d", e.CurrentState)
+	}
+
+	// 12 meters takes 8 seconds.  Halfway there, the car is between floors at rated speed.
+	e.move(start.Add(4 * time.Second))
+	if e.CurrentFloor != 3 || e.Position <= 3 || e.Position >= 4 || e.Velocity <= 0 {
+		t.Errorf("Expected the car moving up past floor 3 but got floor %d at %v moving %v m/s", e.CurrentFloor, e.Position, e.Velocity)
+	}
+
+	e.move(start.Add(7 * time.Second))
+	if e.CurrentState != STATE_MOVING_UP {
+		t.Errorf("Expected the car still moving but got %d", e.CurrentState)
+	}
+
+	e.move(start.Add(9 * time.Second))
+	if e.CurrentState != STATE_LOADING || e.CurrentFloor != 5 || e.Position != 5 || e.Velocity != 0 {
+		t.Errorf("Expected the car loading at rest on floor 5 but got state %d on floor %d at %v moving %v m/s",
+			e.CurrentState, e.CurrentFloor, e.Position, e.Velocity)
+	}
+}
+
+func TestSkippedFloorIsNeverALoadingStop(t *testing.T) {
+	e := getBaseElevator()
+	e.ServedFloors = ServedFloors{Ranges: []FloorRange{{Min: 1, Max: 16}}, Skip: []int{13}}
+	e.addNewWaitingPassenger(&passenger.Passenger{CurrentFloor: 13, DestinationFloor: 1})
+
+	if e.shouldStopAt(13) {
+		t.Error("Expected the elevator to pass floor 13 without stopping.")
+	}
+
+	e.addNewPassenger(&passenger.Passenger{CurrentFloor: 1, DestinationFloor: 13})
+	if !e.shouldStopAt(13) {
+		t.Error("Expected the elevator to let a rider off at floor 13 rather than strand them.")
+	}
+}
+
+// Returns a base elevator backed by st.
+func getQueueElevator(st *recordingStore) *Elevator {
+	st.MemoryStore = &memory_store.MemoryStore{}
+	st.Init()
+
+	e := getBaseElevator()
+	e.Store = st
+	return e
+}
+
+// Returns a queued call at index.
+func queuedCall(index uint64, p *passenger.Passenger) *store.Call {
+	data, _ := json.Marshal(p)
+	return &store.Call{Id: "0-0/" + strconv.FormatUint(index, 10), Index: index, Data: data}
+}
+
+func TestConsumeQueuedPassengerSavesStateBeforeAcknowledging(t *testing.T) {
+	st := &recordingStore{}
+	e := getQueueElevator(st)
+
+	if !e.consumeQueuedPassenger(queuedCall(7, &passenger.Passenger{CurrentFloor: 5, DestinationFloor: 1})) {
+		t.Fatal("Expected the call to be consumed")
+	}
+
+	if len(e.Waiting) != 1 || e.LastCallIndex != 7 {
+		t.Errorf("Expected 1 passenger waiting and last call index 7 but got %d and %d", len(e.Waiting), e.LastCallIndex)
+	}
+
+	// The index is saved before the call leaves the queue, so a restart in between can't add it twice.
+	expected := []string{"status 0-0", "ack 0-0/7"}
+	if !reflect.DeepEqual(st.ops, expected) {
+		t.Errorf("Expected %v but got %v", expected, st.ops)
+	}
+}
+
+func TestConsumeQueuedPassengerSkipsCallsAlreadyConsumed(t *testing.T) {
+	st := &recordingStore{}
+	e := getQueueElevator(st)
+
+	// The elevator saved index 7 with its state, then went down before acknowledging the call.
+	e.LastCallIndex = 7
+	if e.consumeQueuedPassenger(queuedCall(7, &passenger.Passenger{CurrentFloor: 5, DestinationFloor: 1})) {
+		t.Error("Expected the call consumed before the restart to be skipped")
+	}
+
+	if len(e.Waiting) != 0 {
+		t.Errorf("Expected no passengers waiting but got %d", len(e.Waiting))
+	}
+
+	if expected := []string{"ack 0-0/7"}; !reflect.DeepEqual(st.ops, expected) {
+		t.Errorf("Expected the call acknowledged but got %v", st.ops)
+	}
+}
+
+func TestConsumeQueuedPassengerLeavesCallQueuedWhenStateIsNotSaved(t *testing.T) {
+	st := &recordingStore{failStatus: true}
+	e := getQueueElevator(st)
+
+	if e.consumeQueuedPassenger(queuedCall(7, &passenger.Passenger{CurrentFloor: 5, DestinationFloor: 1})) {
+		t.Error("Expected the call to stay queued")
+	}
+
+	// Left in the queue, the call is delivered again when the elevator restarts.
+	if len(st.ops) != 0 {
+		t.Errorf("Expected the call left unacknowledged but got %v", st.ops)
+	}
+}
@@ -1,10 +1,16 @@
 package elevator_test
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
+	"github.com/davepersing/elevator-platform/clock"
+	"github.com/davepersing/elevator-platform/door"
 	"github.com/davepersing/elevator-platform/elevator"
+	"github.com/davepersing/elevator-platform/memory_store"
 	"github.com/davepersing/elevator-platform/passenger"
+	"github.com/davepersing/elevator-platform/store"
 )
 
 func TestNewElevator(t *testing.T) {
@@ -24,6 +30,443 @@ func TestNewElevator(t *testing.T) {
 	}
 
 	if e.MaxFloor != 16 || e.MinFloor != 1 {
-		t.Errorf("Did not create elevator with correct parameters. %v\n", e)
+		t.Errorf("Did not create elevator with correct parameters. %v\n", &e)
+	}
+}
+
+func TestStepDeliversPassenger(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	fake := clock.NewFake(time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC))
+
+	e := &elevator.Elevator{
+		MaxFloor:    16,
+		MinFloor:    1,
+		MaxCapacity: 16,
+		Doors:       door.Door{Timings: door.Timings{OpenTime: 2 * time.Second, DwellTime: 3 * time.Second, CloseTime: 2 * time.Second}},
+		Store:       st,
+		Clock:       fake,
+		Stepped:     true,
+		ElevatorStatus: elevator.ElevatorStatus{
+			CurrentFloor:      1,
+			CurrentState:      elevator.STATE_IDLE,
+			WaitingPassengers: elevator.WaitingPassengers{Waiting: make([]*passenger.Passenger, 0)},
+			Passengers:        make([]*passenger.Passenger, 0),
+		},
+	}
+	e.Init()
+
+	data, _ := json.Marshal(&passenger.Passenger{CurrentFloor: 3, DestinationFloor: 1})
+	st.EnqueueCall(store.Key(0, 0), data)
+
+	// A day's worth of steps runs instantly.  The passenger is delivered well before then.
+	delivered := -1
+	for i := 0; i < 24*60*60 && delivered < 0; i++ {
+		e.Step()
+		fake.Advance(elevator.TICK_INTERVAL)
+
+		if e.CurrentFloor == 1 && len(e.Waiting) == 0 && len(e.Passengers) == 0 && e.CurrentState == elevator.STATE_IDLE {
+			delivered = i
+		}
+	}
+
+	// Up 2 floors, a door cycle, down 2 floors, another door cycle.  Each door cycle takes 7 seconds.
+	if delivered < 0 {
+		t.Fatal("Passenger was never delivered.")
+	}
+
+	if delivered < 18 || delivered > 24 {
+		t.Errorf("Expected the passenger to be delivered after about 20 steps but took %d", delivered)
+	}
+}
+
+// Returns a Stepped elevator on floor 1 of a 16 floor shaft that hands waiting passengers to reassign.
+func newDrainingElevator(st store.Store, fake *clock.Fake, reassign func(p *passenger.Passenger) bool) *elevator.Elevator {
+	e := &elevator.Elevator{
+		MaxFloor:     16,
+		MinFloor:     1,
+		MaxCapacity:  16,
+		ParkingFloor: 1,
+		Store:        st,
+		Clock:        fake,
+		Stepped:      true,
+		Reassign:     reassign,
+		ElevatorStatus: elevator.ElevatorStatus{
+			CurrentFloor:      1,
+			CurrentState:      elevator.STATE_IDLE,
+			WaitingPassengers: elevator.WaitingPassengers{Waiting: make([]*passenger.Passenger, 0)},
+			Passengers:        make([]*passenger.Passenger, 0),
+		},
+	}
+	e.Init()
+	return e
+}
+
+// Steps the elevator until done returns true.  Returns false if it never does within an hour of steps.
+func stepUntil(e *elevator.Elevator, fake *clock.Fake, done func() bool) bool {
+	for i := 0; i < 60*60; i++ {
+		if done() {
+			return true
+		}
+		e.Step()
+		fake.Advance(elevator.TICK_INTERVAL)
+	}
+	return done()
+}
+
+func TestMaintenanceDrainsBeforeParking(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	fake := clock.NewFake(time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC))
+
+	var reassigned []*passenger.Passenger
+	e := newDrainingElevator(st, fake, func(p *passenger.Passenger) bool {
+		reassigned = append(reassigned, p)
+		return true
+	})
+
+	data, _ := json.Marshal(&passenger.Passenger{CurrentFloor: 1, DestinationFloor: 5})
+	st.EnqueueCall(store.Key(0, 0), data)
+	if !stepUntil(e, fake, func() bool { return len(e.Passengers) == 1 }) {
+		t.Fatal("Passenger never boarded.")
+	}
+
+	data, _ = json.Marshal(&passenger.Passenger{CurrentFloor: 8, DestinationFloor: 2})
+	st.EnqueueCall(store.Key(0, 0), data)
+
+	st.SetMaintenanceMode(store.Key(0, 0), "true")
+
+	delivered := false
+	parked := stepUntil(e, fake, func() bool {
+		if e.CurrentFloor == 5 && len(e.Passengers) == 0 {
+			delivered = true
+		}
+		return e.CurrentState == elevator.STATE_MAINTENANCE
+	})
+
+	if !parked || e.CurrentFloor != 1 {
+		t.Fatalf("Expected the elevator parked in maintenance on floor 1 but got state %s on floor %d",
+			elevator.StateName(e.CurrentState), e.CurrentFloor)
+	}
+
+	if !delivered {
+		t.Error("Expected the rider delivered to floor 5 before parking.")
+	}
+
+	if len(reassigned) != 1 || reassigned[0].CurrentFloor != 8 || len(e.Waiting) != 0 {
+		t.Errorf("Expected the waiting passenger on floor 8 reassigned but got %d reassigned and %d waiting",
+			len(reassigned), len(e.Waiting))
+	}
+
+	var status elevator.ElevatorStatus
+	data, _ = st.GetState(store.Key(0, 0))
+	if err := json.Unmarshal(data, &status); err != nil || !status.MaintenanceRequested {
+		t.Errorf("Expected the maintenance request in the stored status but got %s", data)
+	}
+
+	st.SetMaintenanceMode(store.Key(0, 0), "false")
+	e.Step()
+	if e.CurrentState != elevator.STATE_IDLE {
+		t.Errorf("Expected the elevator back in service but got %s", elevator.StateName(e.CurrentState))
+	}
+}
+
+func TestMaintenanceServesPassengersThatCannotBeReassigned(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	fake := clock.NewFake(time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC))
+
+	e := newDrainingElevator(st, fake, func(p *passenger.Passenger) bool { return false })
+
+	data, _ := json.Marshal(&passenger.Passenger{CurrentFloor: 8, DestinationFloor: 2})
+	st.EnqueueCall(store.Key(0, 0), data)
+
+	st.SetMaintenanceMode(store.Key(0, 0), "true")
+
+	picked := false
+	parked := stepUntil(e, fake, func() bool {
+		if len(e.Passengers) == 1 {
+			picked = true
+		}
+		return e.CurrentState == elevator.STATE_MAINTENANCE
+	})
+
+	if !parked || !picked || len(e.Passengers) != 0 || e.CurrentFloor != 1 {
+		t.Errorf("Expected the passenger on floor 8 delivered before parking on floor 1 but got state %s on floor %d",
+			elevator.StateName(e.CurrentState), e.CurrentFloor)
+	}
+}
+
+func TestHallCallIsAnsweredAndCarCallCarried(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	fake := clock.NewFake(time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC))
+
+	e := newDrainingElevator(st, fake, nil)
+
+	hall := &passenger.Passenger{Id: "hall", CurrentFloor: 5, DestinationFloor: 6, HallCall: "up", Elevator: store.Key(0, 0)}
+	data, _ := json.Marshal(hall)
+	st.SavePassenger(hall.Id, data, passenger.RECORD_TTL)
+	st.EnqueueCall(store.Key(0, 0), data)
+
+	e.Step()
+	if len(e.HallButtons) != 1 || e.HallButtons[0].Floor != 5 || e.HallButtons[0].Direction != "up" {
+		t.Fatalf("Expected the up button lit on floor 5 but got %+v", e.HallButtons)
+	}
+
+	if !stepUntil(e, fake, func() bool { return len(e.HallButtons) == 0 }) || e.CurrentFloor != 5 || len(e.Passengers) != 0 {
+		t.Fatalf("Expected the hall call answered on floor 5 without boarding but got floor %d with %d riders",
+			e.CurrentFloor, len(e.Passengers))
+	}
+
+	var record passenger.Passenger
+	data, _ = st.GetPassenger(hall.Id)
+	if json.Unmarshal(data, &record); record.State() != passenger.STATE_DELIVERED {
+		t.Errorf("Expected the hall call recorded as answered but got state %s", record.State())
+	}
+
+	// Whoever was waiting gets on and presses 9, then 9 again.
+	for i := 0; i < 2; i++ {
+		data, _ = json.Marshal(&passenger.Passenger{CurrentFloor: 5, DestinationFloor: 9, CarCall: true})
+		st.EnqueueCall(store.Key(0, 0), data)
+	}
+
+	e.Step()
+	if len(e.CarButtons) != 1 || e.CarButtons[0] != 9 {
+		t.Fatalf("Expected the button for floor 9 lit once but got %v", e.CarButtons)
+	}
+
+	if !stepUntil(e, fake, func() bool { return len(e.CarButtons) == 0 }) || e.CurrentFloor != 9 || len(e.Passengers) != 0 {
+		t.Errorf("Expected both presses carried to floor 9 but got floor %d with %d riders", e.CurrentFloor, len(e.Passengers))
+	}
+}
+
+func TestCarCallForCurrentFloorReopensDoors(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	fake := clock.NewFake(time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC))
+
+	e := newDrainingElevator(st, fake, nil)
+	e.Doors.Timings = door.Timings{OpenTime: time.Second, DwellTime: 3 * time.Second, CloseTime: time.Second}
+
+	pressed := &passenger.Passenger{Id: "pressed", DestinationFloor: 1, CarCall: true, Elevator: store.Key(0, 0)}
+	data, _ := json.Marshal(pressed)
+	st.EnqueueCall(store.Key(0, 0), data)
+
+	e.Step()
+	if e.CurrentState != elevator.STATE_UNLOADING || e.Doors.IsClosed() || len(e.Passengers) != 0 {
+		t.Fatalf("Expected the doors reopened on floor 1 but got state %s with doors %s",
+			elevator.StateName(e.CurrentState), door.StateName(e.Doors.State()))
+	}
+
+	var record passenger.Passenger
+	data, _ = st.GetPassenger(pressed.Id)
+	if json.Unmarshal(data, &record); record.State() != passenger.STATE_DELIVERED {
+		t.Errorf("Expected the press recorded as answered but got state %s", record.State())
+	}
+
+	if !stepUntil(e, fake, func() bool { return e.CurrentState == elevator.STATE_IDLE }) || !e.Doors.IsClosed() {
+		t.Errorf("Expected the elevator idle with its doors closed again but got doors %s", door.StateName(e.Doors.State()))
+	}
+}
+
+func TestHallCallIsOnlyAnsweredInItsDirection(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	fake := clock.NewFake(time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC))
+
+	e := newDrainingElevator(st, fake, nil)
+
+	for _, p := range []*passenger.Passenger{
+		{Id: "rider", CurrentFloor: 1, DestinationFloor: 9},
+		{Id: "down", CurrentFloor: 5, DestinationFloor: 4, HallCall: "down"},
+	} {
+		data, _ := json.Marshal(p)
+		st.EnqueueCall(store.Key(0, 0), data)
+	}
+
+	answered := func(id string) bool {
+		var record passenger.Passenger
+		data, _ := st.GetPassenger(id)
+		return data != nil && json.Unmarshal(data, &record) == nil && record.State() == passenger.STATE_DELIVERED
+	}
+
+	// The car passes the down call on its way up, and answers it on the way back.
+	riderFirst := false
+	if !stepUntil(e, fake, func() bool {
+		if e.CurrentFloor == 5 && e.CurrentState == elevator.STATE_LOADING && !answered("rider") {
+			t.Fatalf("Expected the car going up to pass the down call on floor 5")
+		}
+		if answered("down") {
+			riderFirst = answered("rider")
+			return true
+		}
+		return false
+	}) || !riderFirst {
+		t.Errorf("Expected the down call answered after the rider got off on floor 9")
+	}
+}
+
+func TestRestartedElevatorSkipsCallsItAlreadyConsumed(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	st.Init()
+	fake := clock.NewFake(time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC))
+
+	consumed := &passenger.Passenger{Id: "consumed", CurrentFloor: 3, DestinationFloor: 9}
+	for _, p := range []*passenger.Passenger{consumed, {Id: "new", CurrentFloor: 5, DestinationFloor: 1}} {
+		data, _ := json.Marshal(p)
+		st.EnqueueCall(store.Key(0, 0), data)
+	}
+
+	// The elevator saved the first call with its state, then went down before acknowledging it.
+	state, _ := json.Marshal(&elevator.ElevatorStatus{
+		CurrentFloor:      1,
+		CurrentState:      elevator.STATE_IDLE,
+		LastCallIndex:     1,
+		WaitingPassengers: elevator.WaitingPassengers{Waiting: []*passenger.Passenger{consumed}},
+		Passengers:        make([]*passenger.Passenger, 0),
+	})
+	st.SetStatus(store.Key(0, 0), state, time.Second)
+
+	e := newDrainingElevator(st, fake, nil)
+
+	if len(e.Waiting) != 2 || e.Waiting[0].Id != "consumed" || e.Waiting[1].Id != "new" {
+		t.Errorf("Expected the consumed call once, then the new one, but got %d waiting", len(e.Waiting))
+	}
+
+	if e.LastCallIndex != 2 {
+		t.Errorf("Expected last call index 2 but got %d", e.LastCallIndex)
+	}
+
+	if pending, _ := st.PendingCalls(store.Key(0, 0)); len(pending) != 0 {
+		t.Errorf("Expected both calls acknowledged but %d are still queued", len(pending))
+	}
+}
+
+func TestCallsForUnservedFloorsAreDropped(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	st.Init()
+	fake := clock.NewFake(time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC))
+
+	for _, p := range []*passenger.Passenger{
+		{Id: "from-13", CurrentFloor: 13, DestinationFloor: 1},
+		{Id: "to-13", CurrentFloor: 1, DestinationFloor: 13, CarCall: true},
+		{Id: "served", CurrentFloor: 2, DestinationFloor: 14},
+	} {
+		data, _ := json.Marshal(p)
+		st.EnqueueCall(store.Key(0, 0), data)
+	}
+
+	e := &elevator.Elevator{
+		MaxFloor:    16,
+		MinFloor:    1,
+		MaxCapacity: 16,
+		Store:       st,
+		Clock:       fake,
+		Stepped:     true,
+		ElevatorStatus: elevator.ElevatorStatus{
+			CurrentFloor:      1,
+			CurrentState:      elevator.STATE_IDLE,
+			ServedFloors:      elevator.ServedFloors{Skip: []int{13}},
+			WaitingPassengers: elevator.WaitingPassengers{Waiting: make([]*passenger.Passenger, 0)},
+			Passengers:        make([]*passenger.Passenger, 0),
+		},
+	}
+	e.Init()
+
+	if len(e.Waiting) != 1 || e.Waiting[0].Id != "served" {
+		t.Errorf("Expected only the call between served floors to be kept but got %d waiting", len(e.Waiting))
+	}
+
+	if pending, _ := st.PendingCalls(store.Key(0, 0)); len(pending) != 0 {
+		t.Errorf("Expected the dropped calls acknowledged but %d are still queued", len(pending))
+	}
+}
+
+func TestDoorRequestsWhileStepping(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	fake := clock.NewFake(time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC))
+
+	e := newDrainingElevator(st, fake, nil)
+	e.Doors.Timings = door.Timings{OpenTime: time.Second, DwellTime: time.Second, CloseTime: time.Second}
+
+	data, _ := json.Marshal(&passenger.Passenger{Id: "rider", CurrentFloor: 1, DestinationFloor: 4})
+	st.EnqueueCall(store.Key(0, 0), data)
+
+	// Press the door buttons from another goroutine, like the HTTP API does, while the run loop steps.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			if e.ObstructDoor() {
+				e.ClearDoor()
+			}
+			if e.HoldDoor(time.Second) {
+				e.ReleaseDoor()
+			}
+		}
+	}()
+
+	for stepping := true; stepping; {
+		select {
+		case <-done:
+			stepping = false
+		default:
+			e.Step()
+			fake.Advance(elevator.TICK_INTERVAL)
+		}
+	}
+
+	delivered := func() bool {
+		var record passenger.Passenger
+		data, _ := st.GetPassenger("rider")
+		return data != nil && json.Unmarshal(data, &record) == nil && record.State() == passenger.STATE_DELIVERED
+	}
+	if !stepUntil(e, fake, delivered) {
+		t.Error("Expected the rider delivered once the door requests stopped.")
+	}
+}
+
+func TestMaintenanceReassignsWithoutHoldingUpTheRunLoop(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	fake := clock.NewFake(time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC))
+
+	// Reassigning blocks until the test lets it finish, like a dispatch against a slow store.
+	reassigning, finish := make(chan struct{}), make(chan struct{})
+	e := newDrainingElevator(st, fake, func(p *passenger.Passenger) bool {
+		close(reassigning)
+		<-finish
+		return false
+	})
+	// The run loop only ticks when the fake clock is advanced, so the test still steps the elevator itself.
+	e.Stepped = false
+
+	data, _ := json.Marshal(&passenger.Passenger{Id: "waiting", CurrentFloor: 8, DestinationFloor: 2})
+	st.EnqueueCall(store.Key(0, 0), data)
+	st.SetMaintenanceMode(store.Key(0, 0), "true")
+
+	stepped := make(chan struct{})
+	go func() {
+		e.Step()
+		close(stepped)
+	}()
+
+	select {
+	case <-stepped:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the move to finish while the passenger is being reassigned")
+	}
+
+	<-reassigning
+	close(finish)
+
+	// The passenger couldn't be reassigned, so the elevator waits for them again.
+	deadline := time.Now().Add(time.Second)
+	for {
+		e.WaitingPassengers.Lock()
+		waiting := len(e.Waiting)
+		e.WaitingPassengers.Unlock()
+
+		if waiting == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the passenger back on the waiting list")
+		}
+		time.Sleep(time.Millisecond)
 	}
 }
@@ -0,0 +1,59 @@
+package elevator
+
+import "sort"
+
+type (
+	// An inclusive range of floors.
+	FloorRange struct {
+		Min int `json:"min"`
+		Max int `json:"max"`
+	}
+
+	// Defines the floors an elevator stops at.
+	// Express zones are modeled as gaps between ranges, e.g. [1-1, 20-40] for a car
+	// that runs express from the lobby to the upper floors.
+	ServedFloors struct {
+		Ranges []FloorRange `json:"ranges"` // Floors the elevator stops at.  Empty means every floor.
+		Skip   []int        `json:"skip"`   // Floors within the ranges the elevator passes without stopping.
+	}
+)
+
+// Returns true if the elevator stops at the given floor.
+func (sf *ServedFloors) Serves(floor int) bool {
+	for _, skip := range sf.Skip {
+		if skip == floor {
+			return false
+		}
+	}
+
+	// Older statuses don't publish their floors, so assume every floor is served.
+	if len(sf.Ranges) == 0 {
+		return true
+	}
+
+	for _, r := range sf.Ranges {
+		if floor >= r.Min && floor <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns every floor the elevator stops at in ascending order.
+// Returns nil if the floors are unknown.
+func (sf *ServedFloors) Floors() []int {
+	seen := make(map[int]bool)
+	var floors []int
+
+	for _, r := range sf.Ranges {
+		for floor := r.Min; floor <= r.Max; floor++ {
+			if !seen[floor] && sf.Serves(floor) {
+				seen[floor] = true
+				floors = append(floors, floor)
+			}
+		}
+	}
+
+	sort.Ints(floors)
+	return floors
+}
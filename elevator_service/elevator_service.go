@@ -3,6 +3,7 @@ package elevator_service
 import (
 	"github.com/davepersing/elevator-platform/elevator"
 	"github.com/davepersing/elevator-platform/http_api"
+	"github.com/davepersing/elevator-platform/passenger"
 )
 
 type (
@@ -17,6 +18,14 @@ type (
 
 // INitializes the overall elevator service.
 func (es *ElevatorService) Init() {
+	// Waiting passengers of an elevator going into maintenance are dispatched to another elevator.
+	if es.Elevator.Reassign == nil {
+		es.Elevator.Reassign = func(p *passenger.Passenger) bool {
+			_, err := es.HttpApi.Reassign(p, passenger.REASSIGN_MAINTENANCE)
+			return err == nil
+		}
+	}
+
 	// Initialize the elevator API.
 	es.HttpApi.Init()
 	es.Elevator.Init()
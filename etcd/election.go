@@ -0,0 +1,113 @@
+package etcd
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/davepersing/elevator-platform/election"
+	"golang.org/x/net/context"
+)
+
+// How long the leader's session outlives it.  A leader that stops responding is replaced once this expires.
+const LEADER_TTL = 10 * time.Second
+
+// Elects a leader among the nodes sharing the etcd cluster.
+// Each campaign runs in a session of its own, so a leader that dies loses leadership when its session lease expires.
+// Implements election.Elector.
+type Election struct {
+	etcd *Etcd
+	id   string
+
+	mu        sync.Mutex
+	session   *concurrency.Session
+	candidate *concurrency.Election
+}
+
+// Returns an election of the nodes sharing the cluster, campaigning as id.
+func (e *Etcd) NewElection(id string) *Election {
+	return &Election{etcd: e, id: id}
+}
+
+// Blocks until the node is the leader, or stop is closed.
+// Returns a channel that is closed when the node's session expires.
+func (el *Election) Campaign(stop <-chan struct{}) (<-chan struct{}, error) {
+	if err := el.etcd.Init(); err != nil {
+		return nil, err
+	}
+
+	session, err := concurrency.NewSession(el.etcd.Client, concurrency.WithTTL(int(leaseSeconds(LEADER_TTL))))
+	if err != nil {
+		fmt.Printf("Cannot start leader session.  Error: %+v\n", err)
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	candidate := concurrency.NewElection(session, strings.TrimSuffix(el.etcd.Keys.Leader, "/"))
+	if err := candidate.Campaign(ctx, el.id); err != nil {
+		// Closing the session revokes its lease, which withdraws the candidacy.
+		session.Close()
+		if ctx.Err() != nil {
+			return nil, election.ErrStopped
+		}
+		return nil, err
+	}
+
+	el.mu.Lock()
+	el.session, el.candidate = session, candidate
+	el.mu.Unlock()
+
+	return session.Done(), nil
+}
+
+// Gives up leadership and closes the node's session.
+func (el *Election) Resign() error {
+	el.mu.Lock()
+	session, candidate := el.session, el.candidate
+	el.session, el.candidate = nil, nil
+	el.mu.Unlock()
+
+	if candidate == nil {
+		return nil
+	}
+
+	err := candidate.Resign(context.Background())
+	if err != nil {
+		fmt.Printf("Error resigning leadership.  Error: %+v\n", err)
+	}
+	session.Close()
+	return err
+}
+
+// Returns the id of the current leader, or "" if there is none.
+// The leader is the candidate with the oldest key under the leader prefix.
+func (el *Election) Leader() (string, error) {
+	if err := el.etcd.Init(); err != nil {
+		return "", err
+	}
+
+	resp, err := el.etcd.Client.Get(context.Background(), el.etcd.Keys.Leader, clientv3.WithPrefix(),
+		clientv3.WithSort(clientv3.SortByCreateRevision, clientv3.SortAscend), clientv3.WithLimit(1))
+	if err != nil {
+		fmt.Printf("Cannot get leader.  Error: %+v\n", err)
+		return "", err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return "", nil
+	}
+	return string(resp.Kvs[0].Value), nil
+}
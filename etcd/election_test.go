@@ -0,0 +1,41 @@
+package etcd
+
+import (
+	"testing"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+// etcd sorts the candidates by create revision, so the only one read is the oldest.
+func TestLeaderIsTheOldestCandidate(t *testing.T) {
+	kv := &fakeKV{gets: map[string][]*clientv3.GetResponse{"/leader/": {
+		getResponse(9, &mvccpb.KeyValue{Key: []byte("/leader/694d"), Value: []byte("node-b"), CreateRevision: 3}),
+	}}}
+	el := newFakeEtcd(kv, &fakeLease{}, nil).NewElection("node-a")
+
+	leader, err := el.Leader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if leader != "node-b" {
+		t.Errorf("Expected node-b to lead but got %s", leader)
+	}
+}
+
+func TestNoLeaderWithoutCandidates(t *testing.T) {
+	el := newFakeEtcd(&fakeKV{}, &fakeLease{}, nil).NewElection("node-a")
+
+	if leader, err := el.Leader(); err != nil || leader != "" {
+		t.Errorf("Expected no leader but got %q.  Error: %v", leader, err)
+	}
+}
+
+func TestResignWithoutCampaigningIsANoOp(t *testing.T) {
+	el := newFakeEtcd(&fakeKV{}, &fakeLease{}, nil).NewElection("node-a")
+
+	if err := el.Resign(); err != nil {
+		t.Errorf("Expected resigning before campaigning to do nothing but got %v", err)
+	}
+}
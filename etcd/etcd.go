@@ -1,74 +1,471 @@
 package etcd
 
 import (
+	"errors"
 	"fmt"
-	"strconv"
+	"math"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/coreos/etcd/client"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/davepersing/elevator-platform/store"
+	"github.com/davepersing/elevator-platform/util"
 	"golang.org/x/net/context"
 )
 
+const (
+	// Bounds for the delay between watcher reconnection attempts.
+	WATCH_RETRY_MIN = 100 * time.Millisecond
+	WATCH_RETRY_MAX = 30 * time.Second
+
+	// How long to wait for a connection to the cluster.
+	DIAL_TIMEOUT = 5 * time.Second
+)
+
 type (
 	// Contains members needed to connect to Etcd cluster
-	//and references to an instance of the keys API with a client.
+	// and a reference to a v3 client.
+	// Implements store.Store.
 	Etcd struct {
-		Url     string // Url to the Etcd cluster.
-		KeysApi client.KeysAPI
-		Client  client.Client
+		Url    string           // Url to the Etcd cluster.  Multiple endpoints are separated by commas.
+		Keys   KeyLayout        // Where each kind of data lives in etcd.  Defaults to NewKeyLayout("").
+		Client *clientv3.Client // Dialed by Init unless already set.
+
+		initOnce sync.Once
+		initErr  error
+
+		leasesMu sync.Mutex
+		leases   map[string]clientv3.LeaseID // The lease keeping each elevator's status alive.
+	}
+
+	// Defines the key prefixes used in etcd.
+	KeyLayout struct {
+		Status      string // Statuses bound by a lease.
+		State       string // Persisted states.
+		Wait        string // Waiting call queues.
+		Maintenance string // Maintenance modes.
+		Passengers  string // Passenger records bound by a lease.
+		Leader      string // Candidates for leader, each bound by its session's lease.
+		Assignments string // Assignment records, versioned by mod revision.
 	}
 )
 
+// Returns the key layout used since the original v2 implementation, nested under root.
+// An empty root keeps the keys at the top level, e.g. /elevator_status/0-0.
+func NewKeyLayout(root string) KeyLayout {
+	root = strings.TrimSuffix(root, "/")
+	return KeyLayout{
+		Status:      root + "/elevator_status/",
+		State:       root + "/elevators/",
+		Wait:        root + "/wait/",
+		Maintenance: root + "/maintenance/",
+		Passengers:  root + "/passengers/",
+		Leader:      root + "/leader/",
+		Assignments: root + "/assignments/",
+	}
+}
+
 // Initializes the Etcd module.
-func (e *Etcd) Init() {
-	config := client.Config{
-		Endpoints:               []string{e.Url},
-		Transport:               client.DefaultTransport,
-		HeaderTimeoutPerRequest: time.Second,
+func (e *Etcd) Init() error {
+	e.initOnce.Do(func() {
+		if e.Keys == (KeyLayout{}) {
+			e.Keys = NewKeyLayout("")
+		}
+		e.leases = make(map[string]clientv3.LeaseID)
+
+		// A client set by the caller is used as is.
+		if e.Client != nil {
+			return
+		}
+
+		config := clientv3.Config{
+			Endpoints:   strings.Split(e.Url, ","),
+			DialTimeout: DIAL_TIMEOUT,
+		}
+
+		c, err := clientv3.New(config)
+		if err != nil {
+			fmt.Printf("Cannot connect to etcd. Error: %v\n", err)
+			e.initErr = err
+			return
+		}
+
+		e.Client = c
+	})
+
+	return e.initErr
+}
+
+// Returns the persisted state of an elevator.
+func (e *Etcd) GetState(key string) ([]byte, error) {
+	resp, err := e.Client.Get(context.Background(), e.Keys.State+key)
+	if err != nil {
+		fmt.Printf("Cannot get status.  Error: %+v\n", err)
+		return nil, err
 	}
 
-	c, err := client.New(config)
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	return resp.Kvs[0].Value, nil
+}
+
+// Saves the state of an elevator.
+// Once with the status key attached to a lease of ttl, and once with the persisted state key.
+func (e *Etcd) SetStatus(key string, data []byte, ttl time.Duration) error {
+	lease, err := e.statusLease(key, ttl)
 	if err != nil {
-		fmt.Printf("Cannot connect to etcd. Error: %v\n", err)
-		return
+		fmt.Printf("Error getting status lease from etcd.  Error: %s\n", err.Error())
+		return err
 	}
 
-	e.Client = c
-	e.KeysApi = client.NewKeysAPI(c)
+	_, err = e.Client.Txn(context.Background()).Then(
+		clientv3.OpPut(e.Keys.Status+key, string(data), clientv3.WithLease(lease)),
+		clientv3.OpPut(e.Keys.State+key, string(data)),
+	).Commit()
+	if err != nil {
+		fmt.Printf("Error setting key to etcd.  Error: %s\n", err.Error())
+		return err
+	}
+
+	return nil
 }
 
-// Returns all statuses from the /elevator_status endpoint
-func (e *Etcd) GetAllStatuses() ([]*client.Node, error) {
-	resp, err := e.KeysApi.Get(context.Background(), "/elevator_status", nil)
+// Returns the lease for an elevator's status, refreshed for another ttl.
+// Grants a new lease if the elevator doesn't have one or it has already expired.
+func (e *Etcd) statusLease(key string, ttl time.Duration) (clientv3.LeaseID, error) {
+	e.leasesMu.Lock()
+	lease, ok := e.leases[key]
+	e.leasesMu.Unlock()
+
+	if ok {
+		if _, err := e.Client.KeepAliveOnce(context.Background(), lease); err == nil {
+			return lease, nil
+		}
+	}
+
+	resp, err := e.Client.Grant(context.Background(), leaseSeconds(ttl))
+	if err != nil {
+		return clientv3.NoLease, err
+	}
+
+	e.leasesMu.Lock()
+	e.leases[key] = resp.ID
+	e.leasesMu.Unlock()
+
+	return resp.ID, nil
+}
+
+// Returns the number of whole seconds to grant a lease for, at least 1.
+func leaseSeconds(ttl time.Duration) int64 {
+	seconds := int64(math.Ceil(ttl.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+// Returns all statuses that are still alive.
+func (e *Etcd) GetAllStatuses() ([][]byte, error) {
+	resp, err := e.Client.Get(context.Background(), e.Keys.Status, clientv3.WithPrefix())
 	if err != nil {
 		fmt.Printf("Cannot get all statuses.  Error: %+v\n", err)
 		return nil, err
 	}
 
-	return resp.Node.Nodes, nil
+	statuses := make([][]byte, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		statuses = append(statuses, kv.Value)
+	}
+
+	return statuses, nil
 }
 
-// Sets a passenger to the waiting key in etcd.  When this is set, the listening elevator will be notified.
-func (e *Etcd) SetPassenger(elevatorId, groupId int, jsonData []byte) error {
-	path := "/wait/" + strconv.Itoa(groupId) + "-" + strconv.Itoa(elevatorId)
+// Delivers the status of every live elevator, then watches for changes.
+// A status is deleted when its lease expires, which is delivered as nil data.
+func (e *Etcd) WatchStatuses(fn func(key string, data []byte), state func(string)) {
+	prefix := e.Keys.Status
+
+	// Reads every live status.  Returns the revision to watch for changes after.
+	resync := func() (int64, error) {
+		resp, err := e.Client.Get(context.Background(), prefix, clientv3.WithPrefix())
+		if err != nil {
+			fmt.Printf("Cannot get statuses.  Error: %+v\n", err)
+			return 0, err
+		}
+
+		for _, kv := range resp.Kvs {
+			fn(strings.TrimPrefix(string(kv.Key), prefix), kv.Value)
+		}
+		return resp.Header.Revision, nil
+	}
 
-	// TODO:  This needs to be fixed to include additionally scheduled passengers if the elevator hasn't
-	// been able to process the one that was there before.
+	go e.watch(prefix, true, func(ev *clientv3.Event) {
+		key := strings.TrimPrefix(string(ev.Kv.Key), prefix)
+		if ev.Type == clientv3.EventTypeDelete {
+			fn(key, nil)
+		} else {
+			fn(key, ev.Kv.Value)
+		}
+	}, resync, state)
+}
+
+// Returns the persisted states of all elevators, alive or not.
+func (e *Etcd) GetAllStates() ([][]byte, error) {
+	resp, err := e.Client.Get(context.Background(), e.Keys.State, clientv3.WithPrefix())
+	if err != nil {
+		fmt.Printf("Cannot get all states.  Error: %+v\n", err)
+		return nil, err
+	}
+
+	states := make([][]byte, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		states = append(states, kv.Value)
+	}
+
+	return states, nil
+}
+
+// Appends a call to the elevator's waiting queue.  When this is set, the listening elevator will be notified.
+// Each call gets its own key under the elevator's wait prefix, created in a transaction so
+// calls scheduled close together are never overwritten.  Calls are ordered by create revision.
+// Returns the key of the queued call.
+func (e *Etcd) EnqueueCall(key string, data []byte) (string, error) {
+	for {
+		callKey := fmt.Sprintf("%s%s/%020d", e.Keys.Wait, key, time.Now().UnixNano())
+
+		resp, err := e.Client.Txn(context.Background()).
+			If(clientv3.Compare(clientv3.CreateRevision(callKey), "=", 0)).
+			Then(clientv3.OpPut(callKey, string(data))).
+			Commit()
+		if err != nil {
+			fmt.Printf("Error enqueuing passenger to etcd.  Error: %s\n", err.Error())
+			return "", err
+		}
+
+		if resp.Succeeded {
+			return callKey, nil
+		}
+		// Another call took the same key.  Try again with a new one.
+	}
+}
 
-	_, err := e.KeysApi.Set(context.Background(), path, string(jsonData), nil)
+// Acknowledges a queued call by removing it from the elevator's queue.
+func (e *Etcd) AckCall(key string, c *store.Call) error {
+	_, err := e.Client.Delete(context.Background(), c.Id)
 	if err != nil {
-		fmt.Printf("Error setting passenger to etcd.  Error: %s\n", err.Error())
+		fmt.Printf("Error acknowledging call %s.  Error: %s\n", c.Id, err.Error())
 		return err
 	}
 	return nil
 }
 
-func (e *Etcd) SetMaintenanceMode(elevatorId, groupId, maintenance string) error {
-	path := "/maintenance/" + groupId + "-" + elevatorId
+// Returns the calls still in the elevator's waiting queue, ordered by create revision.
+func (e *Etcd) PendingCalls(key string) ([]*store.Call, error) {
+	resp, err := e.Client.Get(context.Background(), e.Keys.Wait+key+"/", clientv3.WithPrefix(),
+		clientv3.WithSort(clientv3.SortByCreateRevision, clientv3.SortAscend))
+	if err != nil {
+		fmt.Printf("Cannot get queued calls.  Error: %+v\n", err)
+		return nil, err
+	}
+
+	calls := make([]*store.Call, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		calls = append(calls, &store.Call{Id: string(kv.Key), Index: uint64(kv.CreateRevision), Data: kv.Value})
+	}
+	return calls, nil
+}
+
+// Delivers every call in the elevator's waiting queue, then watches for new calls.
+func (e *Etcd) WatchCalls(key string, fn func(*store.Call), state func(string)) {
+	prefix := e.Keys.Wait + key + "/"
+
+	// Reads the whole queue.  Returns the revision to watch for new calls after.
+	resync := func() (int64, error) {
+		resp, err := e.Client.Get(context.Background(), prefix, clientv3.WithPrefix(),
+			clientv3.WithSort(clientv3.SortByCreateRevision, clientv3.SortAscend))
+		if err != nil {
+			fmt.Printf("Cannot get queued calls.  Error: %+v\n", err)
+			return 0, err
+		}
 
-	if _, err := e.KeysApi.Set(context.Background(), path, maintenance, nil); err != nil {
+		for _, kv := range resp.Kvs {
+			fn(&store.Call{Id: string(kv.Key), Index: uint64(kv.CreateRevision), Data: kv.Value})
+		}
+		return resp.Header.Revision, nil
+	}
+
+	go e.watch(prefix, true, func(ev *clientv3.Event) {
+		// Acknowledging a call deletes its key, so only newly queued calls are delivered.
+		if ev.IsCreate() {
+			fn(&store.Call{Id: string(ev.Kv.Key), Index: uint64(ev.Kv.CreateRevision), Data: ev.Kv.Value})
+		}
+	}, resync, state)
+}
+
+// Sets the maintenance mode of an elevator.
+func (e *Etcd) SetMaintenanceMode(key string, mode string) error {
+	if _, err := e.Client.Put(context.Background(), e.Keys.Maintenance+key, mode); err != nil {
 		fmt.Printf("Error setting maintenance mode in etcd.  Error :%s\n", err.Error())
 		return err
 	}
 	return nil
 }
+
+// Delivers the current maintenance mode of an elevator, then watches for changes.  Removing the mode ends maintenance.
+func (e *Etcd) WatchMaintenance(key string, fn func(string), state func(string)) {
+	path := e.Keys.Maintenance + key
+
+	// Reads the current mode.  Returns the revision to watch for changes after.
+	resync := func() (int64, error) {
+		resp, err := e.Client.Get(context.Background(), path)
+		if err != nil {
+			fmt.Printf("Cannot get maintenance mode.  Error: %+v\n", err)
+			return 0, err
+		}
+
+		if len(resp.Kvs) > 0 {
+			fn(string(resp.Kvs[0].Value))
+		} else {
+			// Without a mode, the elevator is in service.
+			fn("false")
+		}
+		return resp.Header.Revision, nil
+	}
+
+	// Only this elevator's key is watched.  As a prefix, 0-1 would also match 0-10 and up.
+	go e.watch(path, false, func(ev *clientv3.Event) {
+		switch ev.Type {
+		case clientv3.EventTypePut:
+			fn(string(ev.Kv.Value))
+		case clientv3.EventTypeDelete:
+			fn("false")
+		}
+	}, resync, state)
+}
+
+// Watches a key, or every key under it if prefix is set, and calls fn with every change.
+// This never returns.  resync is called first to read the current data and returns the revision to watch after.
+// On error, the watcher reconnects with jittered exponential backoff and resumes after the last revision it saw.
+// If that revision has been compacted away, resync is called again to rebuild from a full read.
+// Connection changes are reported through state.
+func (e *Etcd) watch(key string, prefix bool, fn func(*clientv3.Event), resync func() (int64, error), state func(string)) {
+	backoff := util.Backoff{Min: WATCH_RETRY_MIN, Max: WATCH_RETRY_MAX}
+
+	rev, err := resync()
+	for err != nil {
+		state(store.WATCHER_RECONNECTING)
+		time.Sleep(backoff.Next())
+		rev, err = resync()
+	}
+
+	for {
+		state(store.WATCHER_CONNECTED)
+
+		opts := []clientv3.OpOption{clientv3.WithRev(rev + 1)}
+		if prefix {
+			opts = append(opts, clientv3.WithPrefix())
+		}
+
+		compacted := false
+		err = errors.New("watch closed")
+
+		// Require a leader so the watch fails instead of hanging when the member is partitioned.
+		ctx, cancel := context.WithCancel(clientv3.WithRequireLeader(context.Background()))
+		for wresp := range e.Client.Watch(ctx, key, opts...) {
+			if wresp.CompactRevision != 0 {
+				compacted = true
+				break
+			}
+
+			if werr := wresp.Err(); werr != nil {
+				err = werr
+				break
+			}
+
+			backoff.Reset()
+			for _, ev := range wresp.Events {
+				rev = ev.Kv.ModRevision
+				fn(ev)
+			}
+		}
+		cancel()
+
+		if compacted {
+			// Too far behind to resume from the last revision, so read everything again.
+			fmt.Printf("Watch revision %d on %s was compacted.  Re-reading.\n", rev, key)
+			var resyncRev int64
+			if resyncRev, err = resync(); err == nil {
+				rev = resyncRev
+				continue
+			}
+		}
+
+		state(store.WATCHER_RECONNECTING)
+		delay := backoff.Next()
+		fmt.Printf("Error from watcher on %s.  Retrying in %v.  Error: %v\n", key, delay, err)
+		time.Sleep(delay)
+	}
+}
+
+// Saves the record of a passenger's trip under a lease of ttl.
+// Records are saved far less often than statuses, so each save is granted its own lease.
+func (e *Etcd) SavePassenger(id string, data []byte, ttl time.Duration) error {
+	lease, err := e.Client.Grant(context.Background(), leaseSeconds(ttl))
+	if err != nil {
+		fmt.Printf("Error getting passenger lease from etcd.  Error: %s\n", err.Error())
+		return err
+	}
+
+	if _, err := e.Client.Put(context.Background(), e.Keys.Passengers+id, string(data), clientv3.WithLease(lease.ID)); err != nil {
+		fmt.Printf("Error saving passenger %s to etcd.  Error: %s\n", id, err.Error())
+		return err
+	}
+	return nil
+}
+
+// Returns the record of a passenger's trip, or nil if there is none.
+func (e *Etcd) GetPassenger(id string) ([]byte, error) {
+	resp, err := e.Client.Get(context.Background(), e.Keys.Passengers+id)
+	if err != nil {
+		fmt.Printf("Cannot get passenger.  Error: %+v\n", err)
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	return resp.Kvs[0].Value, nil
+}
+
+// Returns the assignment record of every elevator that has one.  Each is versioned by its mod revision.
+func (e *Etcd) GetAssignments() (map[string]*store.Versioned, error) {
+	resp, err := e.Client.Get(context.Background(), e.Keys.Assignments, clientv3.WithPrefix())
+	if err != nil {
+		fmt.Printf("Cannot get assignments.  Error: %+v\n", err)
+		return nil, err
+	}
+
+	assignments := make(map[string]*store.Versioned, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		key := strings.TrimPrefix(string(kv.Key), e.Keys.Assignments)
+		assignments[key] = &store.Versioned{Data: kv.Value, Version: kv.ModRevision}
+	}
+	return assignments, nil
+}
+
+// Replaces an elevator's assignment record in a transaction that only succeeds if its mod revision is still version.
+// A key that doesn't exist has a mod revision of 0.
+func (e *Etcd) SwapAssignment(key string, data []byte, version int64) (bool, error) {
+	path := e.Keys.Assignments + key
+	resp, err := e.Client.Txn(context.Background()).
+		If(clientv3.Compare(clientv3.ModRevision(path), "=", version)).
+		Then(clientv3.OpPut(path, string(data))).
+		Commit()
+	if err != nil {
+		fmt.Printf("Error swapping assignment of elevator %s.  Error: %s\n", key, err.Error())
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
@@ -0,0 +1,402 @@
+package etcd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	pb "github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/davepersing/elevator-platform/store"
+	"golang.org/x/net/context"
+)
+
+type (
+	// A fake KV.  Each Get returns the next response queued for its key, repeating the last one.
+	// Options such as prefixes and sorting are left to the responses.
+	fakeKV struct {
+		clientv3.KV
+
+		mu      sync.Mutex
+		gets    map[string][]*clientv3.GetResponse
+		getKeys []string // Key of every Get, in order.
+		puts    []string // Key of every Put, in order.
+		commits []bool   // Results of the next transactions.  Transactions succeed once these run out.
+		txns    int      // Number of transactions committed.
+		txnErr  error    // Returned from every commit if set.
+	}
+
+	// A transaction on a fakeKV.  Its comparisons and operations are ignored.
+	fakeTxn struct {
+		clientv3.Txn
+
+		kv *fakeKV
+	}
+
+	// A fake Lease.  Leases are granted with increasing ids and never expire unless marked expired.
+	fakeLease struct {
+		clientv3.Lease
+
+		mu        sync.Mutex
+		granted   []int64 // Ttl of every lease granted, in order.
+		keptAlive []clientv3.LeaseID
+		expired   map[clientv3.LeaseID]bool
+	}
+
+	// A fake Watcher.  Each Watch is served by the next channel sent to watches.
+	// Events outside the watched key, or prefix, are left out.
+	fakeWatcher struct {
+		clientv3.Watcher
+
+		watches chan chan clientv3.WatchResponse
+	}
+)
+
+func (kv *fakeKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	kv.getKeys = append(kv.getKeys, key)
+	responses := kv.gets[key]
+	if len(responses) == 0 {
+		return &clientv3.GetResponse{Header: &pb.ResponseHeader{}}, nil
+	}
+	if len(responses) > 1 {
+		kv.gets[key] = responses[1:]
+	}
+	return responses[0], nil
+}
+
+func (kv *fakeKV) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	kv.puts = append(kv.puts, key)
+	return &clientv3.PutResponse{}, nil
+}
+
+func (kv *fakeKV) Txn(ctx context.Context) clientv3.Txn {
+	return &fakeTxn{kv: kv}
+}
+
+func (txn *fakeTxn) If(cs ...clientv3.Cmp) clientv3.Txn   { return txn }
+func (txn *fakeTxn) Then(ops ...clientv3.Op) clientv3.Txn { return txn }
+func (txn *fakeTxn) Else(ops ...clientv3.Op) clientv3.Txn { return txn }
+
+func (txn *fakeTxn) Commit() (*clientv3.TxnResponse, error) {
+	kv := txn.kv
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	kv.txns++
+	if kv.txnErr != nil {
+		return nil, kv.txnErr
+	}
+
+	succeeded := true
+	if len(kv.commits) > 0 {
+		succeeded, kv.commits = kv.commits[0], kv.commits[1:]
+	}
+	return &clientv3.TxnResponse{Succeeded: succeeded}, nil
+}
+
+func (l *fakeLease) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.granted = append(l.granted, ttl)
+	return &clientv3.LeaseGrantResponse{ID: clientv3.LeaseID(len(l.granted)), TTL: ttl}, nil
+}
+
+func (l *fakeLease) KeepAliveOnce(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseKeepAliveResponse, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.keptAlive = append(l.keptAlive, id)
+	if l.expired[id] {
+		return nil, errors.New("requested lease not found")
+	}
+	return &clientv3.LeaseKeepAliveResponse{ID: id}, nil
+}
+
+func (w *fakeWatcher) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	served := <-w.watches
+	op := clientv3.OpGet(key, opts...)
+
+	watched := make(chan clientv3.WatchResponse)
+	go func() {
+		defer close(watched)
+
+		for wresp := range served {
+			var events []*clientv3.Event
+			for _, ev := range wresp.Events {
+				if watches(op, ev.Kv.Key) {
+					events = append(events, ev)
+				}
+			}
+			if len(wresp.Events) > 0 && len(events) == 0 {
+				continue
+			}
+			wresp.Events = events
+
+			select {
+			case watched <- wresp:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return watched
+}
+
+// Returns true if the key is the one the op reads, or falls within its range.
+func watches(op clientv3.Op, key []byte) bool {
+	if end := op.RangeBytes(); len(end) > 0 {
+		return bytes.Compare(key, op.KeyBytes()) >= 0 && bytes.Compare(key, end) < 0
+	}
+	return bytes.Equal(key, op.KeyBytes())
+}
+
+// Returns an Etcd store initialized with a client made of the fakes.
+func newFakeEtcd(kv *fakeKV, lease *fakeLease, watcher *fakeWatcher) *Etcd {
+	e := &Etcd{Client: &clientv3.Client{KV: kv, Lease: lease, Watcher: watcher}}
+	e.Init()
+	return e
+}
+
+// Returns a get response holding kvs at revision rev.
+func getResponse(rev int64, kvs ...*mvccpb.KeyValue) *clientv3.GetResponse {
+	return &clientv3.GetResponse{Header: &pb.ResponseHeader{Revision: rev}, Kvs: kvs}
+}
+
+// Returns a call queued under key at revision rev.
+func queued(key string, rev int64) *mvccpb.KeyValue {
+	return &mvccpb.KeyValue{Key: []byte(key), Value: []byte(key), CreateRevision: rev, ModRevision: rev}
+}
+
+// Returns the next n values sent to c, or fails the test if they don't arrive within a second.
+func receive(t *testing.T, c <-chan string, n int) []string {
+	values := make([]string, 0, n)
+	for len(values) < n {
+		select {
+		case v := <-c:
+			values = append(values, v)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %d values but got %v", n, values)
+		}
+	}
+	return values
+}
+
+func TestDefaultKeyLayoutMatchesV2Keys(t *testing.T) {
+	keys := NewKeyLayout("")
+
+	if keys.Status != "/elevator_status/" || keys.State != "/elevators/" ||
+		keys.Wait != "/wait/" || keys.Maintenance != "/maintenance/" || keys.Passengers != "/passengers/" ||
+		keys.Leader != "/leader/" || keys.Assignments != "/assignments/" {
+		t.Errorf("Unexpected default key layout: %+v", keys)
+	}
+}
+
+func TestKeyLayoutWithRoot(t *testing.T) {
+	keys := NewKeyLayout("/building-a/")
+
+	if keys.Status != "/building-a/elevator_status/" || keys.Wait != "/building-a/wait/" {
+		t.Errorf("Unexpected key layout: %+v", keys)
+	}
+}
+
+func TestEnqueueCallRetriesWhileItsKeyIsTaken(t *testing.T) {
+	kv := &fakeKV{commits: []bool{false, false}}
+	e := newFakeEtcd(kv, &fakeLease{}, nil)
+
+	callKey, err := e.EnqueueCall("0-0", []byte("call"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kv.txns != 3 {
+		t.Errorf("Expected 2 retries after the key was taken but got %d transactions", kv.txns)
+	}
+
+	if !strings.HasPrefix(callKey, "/wait/0-0/") {
+		t.Errorf("Expected the call queued under /wait/0-0/ but got %s", callKey)
+	}
+}
+
+func TestEnqueueCallReturnsTxnErrors(t *testing.T) {
+	kv := &fakeKV{txnErr: errors.New("no leader")}
+	e := newFakeEtcd(kv, &fakeLease{}, nil)
+
+	if _, err := e.EnqueueCall("0-0", []byte("call")); err == nil || kv.txns != 1 {
+		t.Errorf("Expected the error without retrying but got %v after %d transactions", err, kv.txns)
+	}
+}
+
+func TestStatusLeaseIsKeptAliveUntilItExpires(t *testing.T) {
+	lease := &fakeLease{expired: make(map[clientv3.LeaseID]bool)}
+	e := newFakeEtcd(&fakeKV{}, lease, nil)
+
+	e.SetStatus("0-0", []byte(`{"id":0}`), 1500*time.Millisecond)
+	e.SetStatus("0-0", []byte(`{"id":0}`), 1500*time.Millisecond)
+
+	if len(lease.granted) != 1 || lease.granted[0] != 2 {
+		t.Fatalf("Expected a single 2 second lease but got %v", lease.granted)
+	}
+
+	if len(lease.keptAlive) != 1 || lease.keptAlive[0] != 1 {
+		t.Errorf("Expected lease 1 kept alive on the second save but got %v", lease.keptAlive)
+	}
+
+	// The lease ran out between saves, so the next save is granted a new one.
+	lease.expired[1] = true
+	e.SetStatus("0-0", []byte(`{"id":0}`), 1500*time.Millisecond)
+
+	if len(lease.granted) != 2 || e.leases["0-0"] != 2 {
+		t.Errorf("Expected lease 2 granted after lease 1 expired but got %v granted and lease %d in use", lease.granted, e.leases["0-0"])
+	}
+}
+
+func TestEachElevatorHasItsOwnStatusLease(t *testing.T) {
+	lease := &fakeLease{}
+	e := newFakeEtcd(&fakeKV{}, lease, nil)
+
+	e.SetStatus("0-0", []byte(`{"id":0}`), time.Second)
+	e.SetStatus("0-1", []byte(`{"id":1}`), time.Second)
+
+	if len(lease.granted) != 2 || e.leases["0-0"] == e.leases["0-1"] {
+		t.Errorf("Expected a lease for each elevator but got %v", e.leases)
+	}
+}
+
+func TestSavePassengerGrantsEachRecordALease(t *testing.T) {
+	kv := &fakeKV{}
+	lease := &fakeLease{}
+	e := newFakeEtcd(kv, lease, nil)
+
+	e.SavePassenger("a", []byte(`{"id":"a"}`), time.Hour)
+	e.SavePassenger("a", []byte(`{"id":"a"}`), time.Hour)
+
+	if len(lease.granted) != 2 || lease.granted[0] != 3600 || len(lease.keptAlive) != 0 {
+		t.Errorf("Expected a new hour long lease for each save but got %v", lease.granted)
+	}
+
+	if len(kv.puts) != 2 || kv.puts[0] != "/passengers/a" {
+		t.Errorf("Expected the record saved to /passengers/a twice but got %v", kv.puts)
+	}
+}
+
+func TestPendingCallsAreIndexedByCreateRevision(t *testing.T) {
+	kv := &fakeKV{gets: map[string][]*clientv3.GetResponse{
+		"/wait/0-0/": {getResponse(9, queued("/wait/0-0/1", 4), queued("/wait/0-0/2", 7))},
+	}}
+	e := newFakeEtcd(kv, &fakeLease{}, nil)
+
+	calls, err := e.PendingCalls("0-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calls) != 2 || calls[0].Id != "/wait/0-0/1" || calls[0].Index != 4 || calls[1].Index != 7 ||
+		string(calls[1].Data) != "/wait/0-0/2" {
+		t.Errorf("Expected calls at 4 and 7 keyed by their paths but got %+v", calls)
+	}
+}
+
+func TestWatchRereadsTheQueueAfterCompaction(t *testing.T) {
+	prefix := "/wait/0-0/"
+	kv := &fakeKV{gets: map[string][]*clientv3.GetResponse{prefix: {
+		getResponse(10, queued(prefix+"a", 5)),
+		getResponse(20, queued(prefix+"a", 5), queued(prefix+"b", 15)),
+	}}}
+
+	watcher := &fakeWatcher{watches: make(chan chan clientv3.WatchResponse, 2)}
+	compacted := make(chan clientv3.WatchResponse, 1)
+	compacted <- clientv3.WatchResponse{CompactRevision: 12}
+	resumed := make(chan clientv3.WatchResponse, 1)
+	resumed <- clientv3.WatchResponse{Events: []*clientv3.Event{{Type: mvccpb.PUT, Kv: queued(prefix+"c", 21)}}}
+	watcher.watches <- compacted
+	watcher.watches <- resumed
+
+	e := newFakeEtcd(kv, &fakeLease{}, watcher)
+
+	delivered, states := make(chan string, 10), make(chan string, 10)
+	e.WatchCalls("0-0", func(c *store.Call) { delivered <- c.Id }, func(state string) { states <- state })
+
+	calls := receive(t, delivered, 4)
+	if calls[0] != prefix+"a" || calls[1] != prefix+"a" || calls[2] != prefix+"b" || calls[3] != prefix+"c" {
+		t.Errorf("Expected the queue read again after compaction, then the new call, but got %v", calls)
+	}
+
+	if s := receive(t, states, 2); s[0] != store.WATCHER_CONNECTED || s[1] != store.WATCHER_CONNECTED {
+		t.Errorf("Expected the watcher to stay connected through compaction but got %v", s)
+	}
+}
+
+func TestWatchResumesAfterErrorsWithoutRereading(t *testing.T) {
+	prefix := "/maintenance/0-0"
+	kv := &fakeKV{gets: map[string][]*clientv3.GetResponse{prefix: {
+		getResponse(10, &mvccpb.KeyValue{Key: []byte(prefix), Value: []byte("false"), ModRevision: 10}),
+	}}}
+
+	watcher := &fakeWatcher{watches: make(chan chan clientv3.WatchResponse, 2)}
+	dropped := make(chan clientv3.WatchResponse, 1)
+	dropped <- clientv3.WatchResponse{Events: []*clientv3.Event{{Type: mvccpb.PUT,
+		Kv: &mvccpb.KeyValue{Key: []byte(prefix), Value: []byte("true"), ModRevision: 11}}}}
+	close(dropped)
+	resumed := make(chan clientv3.WatchResponse, 1)
+	resumed <- clientv3.WatchResponse{Events: []*clientv3.Event{{Type: mvccpb.PUT,
+		Kv: &mvccpb.KeyValue{Key: []byte(prefix), Value: []byte("false"), ModRevision: 12}}}}
+	watcher.watches <- dropped
+	watcher.watches <- resumed
+
+	e := newFakeEtcd(kv, &fakeLease{}, watcher)
+
+	modes, states := make(chan string, 10), make(chan string, 10)
+	e.WatchMaintenance("0-0", func(mode string) { modes <- mode }, func(state string) { states <- state })
+
+	if m := receive(t, modes, 3); m[0] != "false" || m[1] != "true" || m[2] != "false" {
+		t.Errorf("Expected modes false, true, false but got %v", m)
+	}
+
+	s := receive(t, states, 3)
+	if s[0] != store.WATCHER_CONNECTED || s[1] != store.WATCHER_RECONNECTING || s[2] != store.WATCHER_CONNECTED {
+		t.Errorf("Expected the watcher to reconnect once but got %v", s)
+	}
+
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if len(kv.getKeys) != 1 {
+		t.Errorf("Expected the watch resumed without reading the mode again but got %d reads", len(kv.getKeys))
+	}
+}
+
+func TestWatchMaintenanceOnlyWatchesItsElevator(t *testing.T) {
+	path := "/maintenance/0-1"
+	kv := &fakeKV{gets: map[string][]*clientv3.GetResponse{path: {
+		getResponse(10, &mvccpb.KeyValue{Key: []byte(path), Value: []byte("false"), ModRevision: 10}),
+	}}}
+
+	// Elevator 0-10 goes into maintenance first.  Then 0-1 does, and its mode is removed.
+	watcher := &fakeWatcher{watches: make(chan chan clientv3.WatchResponse, 1)}
+	events := make(chan clientv3.WatchResponse, 1)
+	events <- clientv3.WatchResponse{Events: []*clientv3.Event{
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(path + "0"), Value: []byte("true"), ModRevision: 11}},
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(path), Value: []byte("true"), ModRevision: 12}},
+		{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: []byte(path), ModRevision: 13}},
+	}}
+	watcher.watches <- events
+
+	e := newFakeEtcd(kv, &fakeLease{}, watcher)
+
+	modes := make(chan string, 10)
+	e.WatchMaintenance("0-1", func(mode string) { modes <- mode }, func(string) {})
+
+	if m := receive(t, modes, 3); m[0] != "false" || m[1] != "true" || m[2] != "false" {
+		t.Errorf("Expected modes false, true, false but got %v", m)
+	}
+}
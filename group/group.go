@@ -0,0 +1,201 @@
+package group
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/davepersing/elevator-platform/elevator"
+)
+
+type (
+	// Defines a bank of elevators that serve the same range of floors.
+	Group struct {
+		Id            int `json:"id"`
+		ElevatorCount int `json:"elevatorCount"` // Number of elevators in the group.
+		MinFloor      int `json:"minFloor"`      // The lowest floor the group serves.
+		MaxFloor      int `json:"maxFloor"`      // The highest floor the group serves.
+		BasePort      int `json:"basePort"`      // Elevator i in the group serves its HTTP API on BasePort + i.
+
+		ServedFloors elevator.ServedFloors `json:"servedFloors"` // The floors the group's elevators stop at.
+	}
+)
+
+// Returns true if the group serves the given floor.
+func (g *Group) Serves(floor int) bool {
+	if floor < g.MinFloor || floor > g.MaxFloor {
+		return false
+	}
+	return g.ServedFloors.Serves(floor)
+}
+
+// Returns the port the HTTP API for an elevator in the group listens on.  e.g. ":8080"
+func (g *Group) Port(elevatorId int) string {
+	return ":" + strconv.Itoa(g.BasePort+elevatorId)
+}
+
+// Returns the groups serving both floors, ordered from the smallest range of floors to the largest.
+// Smaller groups are preferred so express banks are kept free for the floors only they can reach.
+func Serving(groups []*Group, fromFloor, toFloor int) []*Group {
+	var serving []*Group
+	for _, g := range groups {
+		if g.Serves(fromFloor) && g.Serves(toFloor) {
+			serving = append(serving, g)
+		}
+	}
+
+	sort.SliceStable(serving, func(i, j int) bool {
+		return serving[i].MaxFloor-serving[i].MinFloor < serving[j].MaxFloor-serving[j].MinFloor
+	})
+
+	return serving
+}
+
+// Creates count identical groups.
+// Group g's elevators listen on ports starting at basePort + 100 * g.
+// Returns an error if a group has so many elevators that its ports run into the next group's.
+func Uniform(count, elevatorCount, minFloor, maxFloor, basePort int) ([]*Group, error) {
+	groups := make([]*Group, 0, count)
+	for i := 0; i < count; i++ {
+		groups = append(groups, &Group{
+			Id:            i,
+			ElevatorCount: elevatorCount,
+			MinFloor:      minFloor,
+			MaxFloor:      maxFloor,
+			BasePort:      basePort + 100*i,
+			ServedFloors:  elevator.ServedFloors{Ranges: []elevator.FloorRange{{Min: minFloor, Max: maxFloor}}},
+		})
+	}
+
+	if err := checkPorts(groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// Parses a comma-separated list of groups in the form elevators:bottom-top[:port].
+// e.g. "4:1-20,4:1-40:8180" is a low-rise bank of 4 elevators and a high-rise bank of 4 elevators.
+// Express zones are written as several ranges joined by +.  e.g. "2:1+20-40" stops at the lobby and floors 20 through 40.
+// Groups without a port listen on ports starting at basePort + 100 * group.
+// Returns an error if two groups' elevators would listen on the same port.
+func Parse(spec string, basePort int) ([]*Group, error) {
+	var groups []*Group
+
+	for i, groupSpec := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(groupSpec), ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("Group %d: expected elevators:bottom-top[:port] but got %q", i, groupSpec)
+		}
+
+		count, err := strconv.Atoi(parts[0])
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("Group %d: invalid elevator count %q", i, parts[0])
+		}
+
+		ranges, err := parseRanges(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("Group %d: %s", i, err.Error())
+		}
+
+		maxFloor := ranges[0].Max
+		for _, r := range ranges {
+			if r.Max > maxFloor {
+				maxFloor = r.Max
+			}
+		}
+
+		port := basePort + 100*i
+		if len(parts) == 3 {
+			if port, err = strconv.Atoi(parts[2]); err != nil {
+				return nil, fmt.Errorf("Group %d: invalid port %q", i, parts[2])
+			}
+		}
+
+		groups = append(groups, &Group{
+			Id:            i,
+			ElevatorCount: count,
+			MinFloor:      ranges[0].Min,
+			MaxFloor:      maxFloor,
+			BasePort:      port,
+			ServedFloors:  elevator.ServedFloors{Ranges: ranges},
+		})
+	}
+
+	if len(groups) == 0 {
+		return nil, errors.New("At least one group is required.")
+	}
+
+	if err := checkPorts(groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// Returns an error if the ports of any two groups' elevators overlap.
+// Group g's elevators listen on BasePort through BasePort + ElevatorCount - 1.
+func checkPorts(groups []*Group) error {
+	for i, a := range groups {
+		for _, b := range groups[i+1:] {
+			if a.BasePort < b.BasePort+b.ElevatorCount && b.BasePort < a.BasePort+a.ElevatorCount {
+				return fmt.Errorf("Groups %d and %d share ports.  Group %d uses %d-%d and group %d uses %d-%d.",
+					a.Id, b.Id, a.Id, a.BasePort, a.BasePort+a.ElevatorCount-1, b.Id, b.BasePort, b.BasePort+b.ElevatorCount-1)
+			}
+		}
+	}
+	return nil
+}
+
+// Parses floor ranges joined by +, e.g. "1+20-40".  Returns the ranges sorted from lowest to highest.
+func parseRanges(spec string) ([]elevator.FloorRange, error) {
+	var ranges []elevator.FloorRange
+
+	for _, rangeSpec := range strings.Split(spec, "+") {
+		floors := strings.Split(rangeSpec, "-")
+		if len(floors) > 2 {
+			return nil, fmt.Errorf("expected a floor range bottom-top but got %q", rangeSpec)
+		}
+
+		minFloor, err := strconv.Atoi(floors[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bottom floor %q", floors[0])
+		}
+
+		maxFloor := minFloor
+		if len(floors) == 2 {
+			if maxFloor, err = strconv.Atoi(floors[1]); err != nil {
+				return nil, fmt.Errorf("invalid top floor %q", floors[1])
+			}
+		}
+
+		if minFloor <= 0 || maxFloor < minFloor {
+			return nil, fmt.Errorf("invalid floor range %d-%d", minFloor, maxFloor)
+		}
+
+		ranges = append(ranges, elevator.FloorRange{Min: minFloor, Max: maxFloor})
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Min < ranges[j].Min
+	})
+
+	return ranges, nil
+}
+
+// Parses a comma-separated list of floors, e.g. "13,14".
+func ParseFloors(spec string) ([]int, error) {
+	var floors []int
+	if strings.TrimSpace(spec) == "" {
+		return floors, nil
+	}
+
+	for _, floorSpec := range strings.Split(spec, ",") {
+		floor, err := strconv.Atoi(strings.TrimSpace(floorSpec))
+		if err != nil {
+			return nil, fmt.Errorf("invalid floor %q", floorSpec)
+		}
+		floors = append(floors, floor)
+	}
+	return floors, nil
+}
@@ -0,0 +1,101 @@
+package group_test
+
+import (
+	"testing"
+
+	"github.com/davepersing/elevator-platform/group"
+)
+
+func TestParseGroups(t *testing.T) {
+	groups, err := group.Parse("4:1-20, 2:1-40:9000", 8080)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups but got %d", len(groups))
+	}
+
+	low, high := groups[0], groups[1]
+	if low.Id != 0 || low.ElevatorCount != 4 || low.MinFloor != 1 || low.MaxFloor != 20 || low.BasePort != 8080 {
+		t.Errorf("Unexpected low-rise group: %+v", low)
+	}
+
+	if high.Id != 1 || high.ElevatorCount != 2 || high.MaxFloor != 40 || high.Port(1) != ":9001" {
+		t.Errorf("Unexpected high-rise group: %+v", high)
+	}
+}
+
+func TestParseInvalidGroups(t *testing.T) {
+	for _, spec := range []string{"", "4", "0:1-20", "4:20-1", "4:1-20:port", "4:1_20"} {
+		if _, err := group.Parse(spec, 8080); err == nil {
+			t.Errorf("Expected an error parsing %q", spec)
+		}
+	}
+}
+
+func TestParseRejectsOverlappingPorts(t *testing.T) {
+	// The first group listens on 8080-8083, so the second can't start at 8082.
+	if _, err := group.Parse("4:1-20, 2:1-40:8082", 8080); err == nil {
+		t.Error("Expected an error for groups sharing ports 8082 and 8083")
+	}
+
+	if _, err := group.Parse("4:1-20, 2:1-40:8084", 8080); err != nil {
+		t.Errorf("Expected adjacent port ranges to be accepted but got %v", err)
+	}
+}
+
+func TestUniformRejectsOverlappingPorts(t *testing.T) {
+	if _, err := group.Uniform(2, 100, 1, 16, 8080); err != nil {
+		t.Errorf("Expected 100 elevators to fit in each group's ports but got %v", err)
+	}
+
+	if _, err := group.Uniform(2, 101, 1, 16, 8080); err == nil {
+		t.Error("Expected an error for group 0's 101st elevator taking group 1's first port")
+	}
+}
+
+func TestServingPrefersSmallestGroup(t *testing.T) {
+	groups := []*group.Group{
+		{Id: 0, MinFloor: 1, MaxFloor: 40},
+		{Id: 1, MinFloor: 1, MaxFloor: 20},
+		{Id: 2, MinFloor: 20, MaxFloor: 40},
+	}
+
+	serving := group.Serving(groups, 1, 10)
+	if len(serving) != 2 || serving[0].Id != 1 || serving[1].Id != 0 {
+		t.Errorf("Expected groups [1 0] but got %v", serving)
+	}
+
+	serving = group.Serving(groups, 30, 1)
+	if len(serving) != 1 || serving[0].Id != 0 {
+		t.Errorf("Expected group [0] but got %v", serving)
+	}
+}
+
+func TestParseExpressZone(t *testing.T) {
+	groups, err := group.Parse("2:20-40+1", 8080)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := groups[0]
+	if g.MinFloor != 1 || g.MaxFloor != 40 {
+		t.Errorf("Expected floors 1-40 but got %d-%d", g.MinFloor, g.MaxFloor)
+	}
+
+	if !g.Serves(1) || g.Serves(10) || !g.Serves(30) {
+		t.Errorf("Expected the group to stop at the lobby and floors 20-40: %+v", g.ServedFloors)
+	}
+}
+
+func TestParseFloors(t *testing.T) {
+	floors, err := group.ParseFloors("13, 14")
+	if err != nil || len(floors) != 2 || floors[0] != 13 || floors[1] != 14 {
+		t.Errorf("Expected [13 14] but got %v, %v", floors, err)
+	}
+
+	if _, err := group.ParseFloors("13,a"); err == nil {
+		t.Error("Expected an error parsing an invalid floor.")
+	}
+}
@@ -0,0 +1,157 @@
+package http_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/davepersing/elevator-platform/elevator"
+	"github.com/davepersing/elevator-platform/passenger"
+	"github.com/davepersing/elevator-platform/store"
+)
+
+const (
+	// How many times a call is decided again after another dispatch assigned the same elevator first.
+	MAX_ASSIGNMENT_ATTEMPTS = 5
+
+	// How long a call counts in its elevator's assignment record.  The elevator's status shows the call well before then.
+	ASSIGNMENT_TTL = 5 * time.Second
+)
+
+type (
+	// The calls recently assigned to an elevator, kept until its status shows them.
+	// Records are written with compare-and-swap, so dispatches that read an elevator at the same time
+	// can't both assign it calls without one seeing the other's.
+	assignmentRecord struct {
+		Calls []*assignedCall `json:"calls"`
+	}
+
+	// A call in an assignment record.
+	assignedCall struct {
+		Passenger  *passenger.Passenger `json:"passenger"`
+		AssignedAt time.Time            `json:"assignedAt"`
+	}
+)
+
+// Returns the calls in each elevator's assignment record that are recent and not yet shown in its status, by key.
+// The calls are added to the statuses as waiting passengers, so the scheduler counts them.
+func applyAssignments(groupStatuses map[int]map[int]*elevator.ElevatorStatus, records map[string]*store.Versioned, now time.Time) map[string][]*assignedCall {
+	pending := make(map[string][]*assignedCall)
+
+	for groupId, statuses := range groupStatuses {
+		for id, es := range statuses {
+			key := store.Key(groupId, id)
+			versioned, ok := records[key]
+			if !ok {
+				continue
+			}
+
+			var record assignmentRecord
+			if err := json.Unmarshal(versioned.Data, &record); err != nil {
+				// Start the record over.
+				continue
+			}
+
+			shown := make(map[string]bool)
+			for _, p := range es.Waiting {
+				shown[p.Id] = true
+			}
+			for _, p := range es.Passengers {
+				shown[p.Id] = true
+			}
+
+			for _, c := range record.Calls {
+				if c.Passenger == nil || shown[c.Passenger.Id] || now.Sub(c.AssignedAt) >= ASSIGNMENT_TTL {
+					continue
+				}
+
+				pending[key] = append(pending[key], c)
+				es.Waiting = append(es.Waiting, c.Passenger)
+				es.CommittedLoad++
+			}
+
+			if calls := pending[key]; len(calls) > 0 && es.CurrentState == elevator.STATE_IDLE {
+				setOff(es, calls[0].Passenger)
+			}
+		}
+	}
+
+	return pending
+}
+
+// Shows an idle elevator on its way to a passenger it has been assigned, as it will be on its next move.
+// Otherwise the scheduler would keep picking it as the closest idle elevator for every call until it filled up.
+func setOff(es *elevator.ElevatorStatus, p *passenger.Passenger) {
+	switch {
+	case p.CurrentFloor > es.CurrentFloor:
+		es.CurrentState = elevator.STATE_MOVING_UP
+	case p.CurrentFloor < es.CurrentFloor:
+		es.CurrentState = elevator.STATE_MOVING_DOWN
+	default:
+		es.CurrentState = elevator.STATE_LOADING
+	}
+	es.CurrentTargetFloor = p.DestinationFloor
+}
+
+// Assigns the passenger to an elevator by adding them to its assignment record, as long as the record hasn't
+// changed since it was read at version.  pending holds the calls from the record still to keep.
+// Returns false if another dispatch wrote the record first.
+func (ha *HttpApi) claim(key string, version int64, pending []*assignedCall, p *passenger.Passenger, now time.Time) (bool, error) {
+	record := assignmentRecord{Calls: append(pending[:len(pending):len(pending)], &assignedCall{Passenger: p, AssignedAt: now})}
+
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return false, err
+	}
+
+	return ha.Store.SwapAssignment(key, data, version)
+}
+
+// Takes the passenger back out of an elevator's assignment record, after their call couldn't be sent to it.
+// If the record can't be rewritten, the passenger still drops out of it after ASSIGNMENT_TTL.
+func (ha *HttpApi) release(key string, p *passenger.Passenger) {
+	for attempt := 1; attempt <= MAX_ASSIGNMENT_ATTEMPTS; attempt++ {
+		records, err := ha.Store.GetAssignments()
+		if err != nil {
+			fmt.Printf("Could not release passenger %s from elevator %s.  Error: %v\n", p.Id, key, err)
+			return
+		}
+
+		versioned, ok := records[key]
+		if !ok {
+			return
+		}
+
+		var record assignmentRecord
+		if err := json.Unmarshal(versioned.Data, &record); err != nil {
+			return
+		}
+
+		calls := make([]*assignedCall, 0, len(record.Calls))
+		for _, c := range record.Calls {
+			if c.Passenger == nil || c.Passenger.Id != p.Id {
+				calls = append(calls, c)
+			}
+		}
+		if len(calls) == len(record.Calls) {
+			return
+		}
+
+		data, err := json.Marshal(&assignmentRecord{Calls: calls})
+		if err != nil {
+			fmt.Printf("Could not release passenger %s from elevator %s.  Error: %v\n", p.Id, key, err)
+			return
+		}
+
+		swapped, err := ha.Store.SwapAssignment(key, data, versioned.Version)
+		if err != nil {
+			fmt.Printf("Could not release passenger %s from elevator %s.  Error: %v\n", p.Id, key, err)
+			return
+		}
+		if swapped {
+			return
+		}
+	}
+
+	fmt.Printf("Could not release passenger %s from elevator %s.  The assignment record kept changing.\n", p.Id, key)
+}
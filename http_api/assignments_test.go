@@ -0,0 +1,159 @@
+package http_api_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davepersing/elevator-platform/elevator"
+	"github.com/davepersing/elevator-platform/http_api"
+	"github.com/davepersing/elevator-platform/memory_store"
+	"github.com/davepersing/elevator-platform/passenger"
+	"github.com/davepersing/elevator-platform/scheduler"
+	"github.com/davepersing/elevator-platform/store"
+)
+
+// A memory store whose statuses never change, like a cluster where elevators haven't consumed their calls yet.
+// Another dispatch claims the elevator just before each of the next conflicts swaps.
+type racingStore struct {
+	*memory_store.MemoryStore
+
+	conflicts int
+}
+
+// Writes a competing assignment first while conflicts remain, so this write finds the record changed.
+func (s *racingStore) SwapAssignment(key string, data []byte, version int64) (bool, error) {
+	if s.conflicts > 0 {
+		s.conflicts--
+
+		rival, _ := json.Marshal(map[string]interface{}{"calls": []map[string]interface{}{{
+			"passenger":  &passenger.Passenger{Id: "rival", CurrentFloor: 1, DestinationFloor: 8, Elevator: key},
+			"assignedAt": time.Now(),
+		}}})
+		s.MemoryStore.SwapAssignment(key, rival, version)
+	}
+
+	return s.MemoryStore.SwapAssignment(key, data, version)
+}
+
+// A racing store that can't take calls or passenger records.
+type failingStore struct {
+	*racingStore
+
+	failSave, failEnqueue bool
+}
+
+// Fails when the store is set to fail saving passengers.
+func (s *failingStore) SavePassenger(id string, data []byte, ttl time.Duration) error {
+	if s.failSave {
+		return errors.New("store unavailable")
+	}
+	return s.racingStore.SavePassenger(id, data, ttl)
+}
+
+// Fails when the store is set to fail enqueueing calls.
+func (s *failingStore) EnqueueCall(key string, data []byte) (string, error) {
+	if s.failEnqueue {
+		return "", errors.New("store unavailable")
+	}
+	return s.racingStore.EnqueueCall(key, data)
+}
+
+// Returns a store with idle elevators 0-0 on floor 1 and 0-1 on floor 10, each with room for capacity passengers.
+func newRacingStore(conflicts, capacity int) *racingStore {
+	st := &racingStore{MemoryStore: &memory_store.MemoryStore{}, conflicts: conflicts}
+	st.Init()
+
+	for id, floor := range []int{1, 10} {
+		data, _ := json.Marshal(&elevator.ElevatorStatus{
+			Id:           id,
+			CurrentFloor: floor,
+			CurrentState: elevator.STATE_IDLE,
+			MaxCapacity:  capacity,
+			ServedFloors: elevator.ServedFloors{Ranges: []elevator.FloorRange{{Min: 1, Max: 16}}},
+		})
+		st.SetStatus(store.Key(0, id), data, time.Hour)
+	}
+	return st
+}
+
+func TestDispatchCountsAssignmentsStatusesDontShowYet(t *testing.T) {
+	api := newTestApi(t, newRacingStore(0, 1), nil)
+
+	first, err := api.Dispatch(&passenger.Passenger{CurrentFloor: 1, DestinationFloor: 8})
+	if err != nil || first.ElevatorId != "0" {
+		t.Fatalf("Expected elevator 0 but got %+v, %v", first, err)
+	}
+
+	// Elevator 0's status still shows it empty, but its assignment record shows it full.
+	second, err := api.Dispatch(&passenger.Passenger{CurrentFloor: 1, DestinationFloor: 8})
+	if err != nil || second.ElevatorId != "1" {
+		t.Errorf("Expected elevator 1 once elevator 0 is full but got %+v, %v", second, err)
+	}
+}
+
+func TestDispatchDoesNotPileCallsOnAnIdleElevator(t *testing.T) {
+	api := newTestApi(t, newRacingStore(0, 0), nil)
+
+	first, err := api.Dispatch(&passenger.Passenger{CurrentFloor: 1, DestinationFloor: 8})
+	if err != nil || first.ElevatorId != "0" {
+		t.Fatalf("Expected elevator 0 but got %+v, %v", first, err)
+	}
+
+	// Elevator 0's status still shows it idle, but it has a call to answer, so it isn't the closest idle elevator.
+	second, err := api.Dispatch(&passenger.Passenger{CurrentFloor: 1, DestinationFloor: 8})
+	if err != nil || second.ElevatorId != "1" || second.Reason != scheduler.REASON_CLOSEST_IDLE {
+		t.Errorf("Expected the idle elevator 1 but got %+v, %v", second, err)
+	}
+}
+
+func TestDispatchDecidesAgainOnConflict(t *testing.T) {
+	api := newTestApi(t, newRacingStore(1, 1), nil)
+
+	// Another dispatch fills elevator 0 between this one reading it and claiming it.
+	result, err := api.Dispatch(&passenger.Passenger{CurrentFloor: 1, DestinationFloor: 8})
+	if err != nil || result.ElevatorId != "1" {
+		t.Errorf("Expected elevator 1 after losing elevator 0 but got %+v, %v", result, err)
+	}
+}
+
+func TestDispatchGivesUpAfterRepeatedConflicts(t *testing.T) {
+	api := newTestApi(t, newRacingStore(http_api.MAX_ASSIGNMENT_ATTEMPTS, 1), nil)
+
+	// Every claim loses to another dispatch.
+	_, err := api.Dispatch(&passenger.Passenger{CurrentFloor: 1, DestinationFloor: 8})
+	de, ok := err.(*http_api.DispatchError)
+	if !ok || de.Code != http.StatusConflict {
+		t.Errorf("Expected the dispatch to give up but got %v", err)
+	}
+}
+
+func TestFailedDispatchReleasesItsClaim(t *testing.T) {
+	for _, st := range []*failingStore{
+		{racingStore: newRacingStore(0, 1), failEnqueue: true},
+		{racingStore: newRacingStore(0, 1), failSave: true},
+	} {
+		api := newTestApi(t, st, nil)
+
+		_, err := api.Dispatch(&passenger.Passenger{Id: "failed", CurrentFloor: 1, DestinationFloor: 8})
+		de, ok := err.(*http_api.DispatchError)
+		if !ok || de.Code != http.StatusInternalServerError {
+			t.Errorf("Expected the dispatch to fail but got %v", err)
+		}
+
+		records, _ := st.GetAssignments()
+		if versioned, ok := records[store.Key(0, 0)]; ok && strings.Contains(string(versioned.Data), "failed") {
+			t.Errorf("Expected the failed passenger out of elevator 0's assignment record but got %s", versioned.Data)
+		}
+
+		// Elevator 0 has room for one passenger, which the failed dispatch no longer takes up.
+		st.failSave, st.failEnqueue = false, false
+		result, err := api.Dispatch(&passenger.Passenger{CurrentFloor: 1, DestinationFloor: 8})
+		if err != nil || result.ElevatorId != "0" {
+			t.Errorf("Expected elevator 0 but got %+v, %v", result, err)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package http_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/davepersing/elevator-platform/call"
+	"github.com/davepersing/elevator-platform/elevator"
+	"github.com/davepersing/elevator-platform/passenger"
+	"github.com/davepersing/elevator-platform/store"
+	"github.com/davepersing/elevator-platform/util"
+)
+
+// The reason given for a hall call whose button is already lit.  The elevator answering it is returned.
+const REASON_ALREADY_CALLED = "already_called"
+
+// A car call queued by POST /car_call.
+type carCallView struct {
+	ElevatorId string `json:"elevatorId"`
+	GroupId    string `json:"groupId"`
+	Floor      int    `json:"floor"`
+	CallId     string `json:"callId"` // Identifies the call in the elevator's waiting queue.
+
+	PassengerId string `json:"passengerId"` // Looks up the call at GET /passengers/{id}.
+}
+
+// Handles a press of an up or down hall button.
+func (ha *HttpApi) handleHallCall(w http.ResponseWriter, r *http.Request) {
+
+	decoder := json.NewDecoder(r.Body)
+	var hc call.HallCall
+
+	if err := decoder.Decode(&hc); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error decoding hall call struct: %v\n", err)
+		return
+	}
+
+	success, err := ha.DispatchHallCall(&hc)
+	if err != nil {
+		de := toDispatchError(err)
+		fmt.Printf("Could not schedule hall call.  %s\n", de.Result.Error)
+		writeError(w, de.Code, de.Result)
+		return
+	}
+
+	fmt.Printf("Scheduled %s hall call on floor %d on elevator %s-%s.  Reason: %s\n",
+		hc.Direction, hc.Floor, success.GroupId, success.ElevatorId, success.Reason)
+	writeJson(w, success)
+}
+
+// Handles a press of a floor button inside a car.
+func (ha *HttpApi) handleCarCall(w http.ResponseWriter, r *http.Request) {
+
+	decoder := json.NewDecoder(r.Body)
+	var cc call.CarCall
+
+	if err := decoder.Decode(&cc); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error decoding car call struct: %v\n", err)
+		return
+	}
+
+	p, callId, err := ha.QueueCarCall(&cc)
+	if err != nil {
+		de := toDispatchError(err)
+		fmt.Printf("Could not queue car call.  %s\n", de.Result.Error)
+		writeError(w, de.Code, de.Result)
+		return
+	}
+
+	writeJson(w, &carCallView{ElevatorId: cc.ElevatorId, GroupId: cc.GroupId, Floor: cc.Floor, CallId: callId, PassengerId: p.Id})
+}
+
+// Schedules a hall call on an elevator and queues it for the elevator, which answers it by stopping at the floor.
+// The call is dispatched like a passenger travelling to the next floor served in its direction.  That passenger
+// counts against the elevator's capacity like a real rider, though no one may board.  The caller's destination
+// is unknown, so the result has no EstimatedArrival.
+// If an elevator is already answering the same button, that elevator is returned instead.
+// Returns a *DispatchError if the call couldn't be scheduled.
+func (ha *HttpApi) DispatchHallCall(hc *call.HallCall) (*util.SuccessResult, error) {
+	if err := hc.Validate(); err != nil {
+		return nil, &DispatchError{Code: http.StatusBadRequest, Result: util.ErrorResult{Error: err.Error(), TransferFloor: -1}}
+	}
+
+	data, err := ha.Store.GetAllStatuses()
+	if err != nil {
+		return nil, internalError("Error getting all statuses.  Error: %v", err)
+	}
+
+	groupStatuses, _ := decodeStatuses(data)
+	statuses := flattenStatuses(groupStatuses, nil)
+
+	success, err := ha.answeringHallCall(groupStatuses, hc)
+	if err != nil {
+		return nil, err
+	}
+
+	if success != nil {
+		return success, nil
+	}
+
+	next, ok := nextServedFloor(statuses, hc)
+	if !ok {
+		return nil, &DispatchError{Code: http.StatusBadRequest, Result: util.ErrorResult{
+			Error:         fmt.Sprintf("No elevator goes %s from floor %d.", hc.Direction, hc.Floor),
+			TransferFloor: -1,
+		}}
+	}
+
+	success, err = ha.Dispatch(&passenger.Passenger{CurrentFloor: hc.Floor, DestinationFloor: next, HallCall: hc.Direction})
+	if err != nil {
+		return nil, err
+	}
+
+	success.EstimatedArrival = 0
+	return success, nil
+}
+
+// Queues a car call straight to the car, bypassing the scheduler.
+// The call is given an id and recorded like a passenger, so it can be looked up at GET /passengers/{id}.
+// Returns the call and its id in the elevator's waiting queue.
+// Returns a *DispatchError if the car isn't running, is going out of service, or doesn't stop at the floor.
+func (ha *HttpApi) QueueCarCall(cc *call.CarCall) (*passenger.Passenger, string, error) {
+	groupId, groupErr := strconv.Atoi(cc.GroupId)
+	elevatorId, elevatorErr := strconv.Atoi(cc.ElevatorId)
+	if groupErr != nil || elevatorErr != nil {
+		return nil, "", &DispatchError{Code: http.StatusNotFound, Result: util.ErrorResult{
+			Error: fmt.Sprintf("Elevator %s-%s doesn't exist.", cc.GroupId, cc.ElevatorId), TransferFloor: -1}}
+	}
+	key := store.Key(groupId, elevatorId)
+
+	data, err := ha.Store.GetAllStatuses()
+	if err != nil {
+		return nil, "", internalError("Error getting all statuses.  Error: %v", err)
+	}
+
+	groupStatuses, _ := decodeStatuses(data)
+	es := groupStatuses[groupId][elevatorId]
+
+	if es == nil {
+		return nil, "", &DispatchError{Code: http.StatusNotFound, Result: util.ErrorResult{
+			Error: fmt.Sprintf("Elevator %s is not running.", key), TransferFloor: -1}}
+	}
+
+	if es.MaintenanceRequested || es.CurrentState == elevator.STATE_MAINTENANCE {
+		return nil, "", &DispatchError{Code: http.StatusServiceUnavailable, Result: util.ErrorResult{
+			Error: fmt.Sprintf("Elevator %s is out of service.", key), TransferFloor: -1}}
+	}
+
+	if !es.ServedFloors.Serves(cc.Floor) {
+		return nil, "", &DispatchError{Code: http.StatusBadRequest, Result: util.ErrorResult{
+			Error: fmt.Sprintf("Elevator %s doesn't stop at floor %d.", key, cc.Floor), TransferFloor: -1}}
+	}
+
+	p := &passenger.Passenger{
+		Id:               passenger.NewId(),
+		CurrentFloor:     es.CurrentFloor,
+		DestinationFloor: cc.Floor,
+		CarCall:          true,
+		Elevator:         key,
+		CalledAt:         ha.now(),
+	}
+
+	jsonBytes, err := json.Marshal(p)
+	if err != nil {
+		return nil, "", internalError("Could not marshal car call json.  Error: %v", err)
+	}
+
+	// Record the call first, so it can be looked up as soon as the elevator has it.
+	if err := ha.Store.SavePassenger(p.Id, jsonBytes, passenger.RECORD_TTL); err != nil {
+		fmt.Printf("Could not save car call %s.  Error: %v\n", p.Id, err)
+	}
+
+	callId, err := ha.Store.EnqueueCall(key, jsonBytes)
+	if err != nil {
+		return nil, "", internalError("Could not send car call to %s.  Error: %v", key, err)
+	}
+	return p, callId, nil
+}
+
+// Returns the elevator already answering the hall call, or nil if its button isn't lit.
+// Besides the buttons each elevator's status shows lit, calls in its assignment record are checked,
+// so presses before the elevator next saves its status don't call a second elevator.
+func (ha *HttpApi) answeringHallCall(groupStatuses map[int]map[int]*elevator.ElevatorStatus, hc *call.HallCall) (*util.SuccessResult, error) {
+	records, err := ha.Store.GetAssignments()
+	if err != nil {
+		return nil, internalError("Error getting assignments.  Error: %v", err)
+	}
+	pending := applyAssignments(groupStatuses, records, ha.now())
+
+	for _, es := range flattenStatuses(groupStatuses, nil) {
+		for _, lit := range es.HallButtons {
+			if lit == *hc {
+				return answeredBy(es, hallCaller(es.Waiting, hc)), nil
+			}
+		}
+
+		for _, c := range pending[store.Key(es.GroupId, es.Id)] {
+			if isHallCall(c.Passenger, hc) && !ha.isAnswered(c.Passenger) {
+				return answeredBy(es, c.Passenger.Id), nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Returns the result for a hall call the elevator is already answering for the passenger with the id.
+func answeredBy(es *elevator.ElevatorStatus, passengerId string) *util.SuccessResult {
+	return &util.SuccessResult{
+		ElevatorId:   strconv.Itoa(es.Id),
+		GroupId:      strconv.Itoa(es.GroupId),
+		PassengerId:  passengerId,
+		CurrentFloor: es.CurrentFloor,
+		Direction:    es.Direction(),
+		Reason:       REASON_ALREADY_CALLED,
+	}
+}
+
+// Returns the id of the waiting passenger who made the hall call, or "" if none of them did.
+func hallCaller(waiting []*passenger.Passenger, hc *call.HallCall) string {
+	for _, p := range waiting {
+		if isHallCall(p, hc) {
+			return p.Id
+		}
+	}
+	return ""
+}
+
+// Returns true if the passenger stands for a press of the hall button.
+func isHallCall(p *passenger.Passenger, hc *call.HallCall) bool {
+	return p.HallCall == hc.Direction && p.CurrentFloor == hc.Floor
+}
+
+// Returns true if the passenger's record shows the call has been answered.
+// An elevator can answer a hall call before its assignment record expires.
+func (ha *HttpApi) isAnswered(p *passenger.Passenger) bool {
+	if p.Id == "" {
+		return false
+	}
+
+	data, err := ha.Store.GetPassenger(p.Id)
+	if err != nil || data == nil {
+		return false
+	}
+
+	var record passenger.Passenger
+	return json.Unmarshal(data, &record) == nil && record.State() != passenger.STATE_WAITING
+}
+
+// Returns the closest floor in the hall call's direction that an elevator stopping at the hall call's floor also stops at.
+// Returns false if no elevator goes that way from the floor.
+func nextServedFloor(statuses []*elevator.ElevatorStatus, hc *call.HallCall) (int, bool) {
+	step := hc.Step()
+	next, found := 0, false
+
+	for _, es := range statuses {
+		if !es.ServedFloors.Serves(hc.Floor) {
+			continue
+		}
+
+		floors := es.ServedFloors.Floors()
+		if floors == nil {
+			// The elevator's floors are unknown, so assume it stops at the next one.
+			floors = []int{hc.Floor + step}
+		}
+
+		for _, floor := range floors {
+			if (floor-hc.Floor)*step <= 0 {
+				continue
+			}
+
+			if !found || util.Abs(floor-hc.Floor) < util.Abs(next-hc.Floor) {
+				next, found = floor, true
+			}
+		}
+	}
+
+	return next, found
+}
@@ -0,0 +1,186 @@
+package http_api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/davepersing/elevator-platform/call"
+	"github.com/davepersing/elevator-platform/clock"
+	"github.com/davepersing/elevator-platform/elevator"
+	"github.com/davepersing/elevator-platform/http_api"
+	"github.com/davepersing/elevator-platform/passenger"
+	"github.com/davepersing/elevator-platform/store"
+	"github.com/davepersing/elevator-platform/util"
+)
+
+// Posts a call to one of the call endpoints.
+func postCall(t *testing.T, server *httptest.Server, path string, c interface{}) *http.Response {
+	data, _ := json.Marshal(c)
+	resp, err := http.Post(server.URL+path, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// Posts a hall call and decodes the successful response.
+func postHallCall(t *testing.T, server *httptest.Server, hc call.HallCall) util.SuccessResult {
+	resp := postCall(t, server, "/hall_call", hc)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 but got %d", resp.StatusCode)
+	}
+
+	var result util.SuccessResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestHallCallIsScheduledOnce(t *testing.T) {
+	e, server := newTestSystem(t)
+	defer server.Close()
+
+	first := postHallCall(t, server, call.HallCall{Floor: 5, Direction: call.DIRECTION_DOWN})
+	if first.ElevatorId != "0" || first.GroupId != "0" || first.PassengerId == "" {
+		t.Fatalf("Expected the hall call scheduled on elevator 0-0 but got %+v", first)
+	}
+
+	// The caller hasn't said where they're going.
+	if first.EstimatedArrival != 0 {
+		t.Errorf("Expected no arrival estimate for a hall call but got %ds", first.EstimatedArrival)
+	}
+
+	e.WaitingPassengers.Lock()
+	var waiting []passenger.Passenger
+	for _, p := range e.Waiting {
+		waiting = append(waiting, *p)
+	}
+	e.WaitingPassengers.Unlock()
+
+	if len(waiting) != 1 || waiting[0].HallCall != call.DIRECTION_DOWN || waiting[0].CurrentFloor != 5 || waiting[0].DestinationFloor != 4 {
+		t.Fatalf("Expected a down hall call waiting on floor 5 but got %+v", waiting)
+	}
+
+	// Pressing the lit button again doesn't call another elevator.
+	again := postHallCall(t, server, call.HallCall{Floor: 5, Direction: call.DIRECTION_DOWN})
+	if again.PassengerId != first.PassengerId || again.Reason != http_api.REASON_ALREADY_CALLED {
+		t.Errorf("Expected the first call returned but got %+v", again)
+	}
+}
+
+func TestHallCallRejectsImpossibleDirections(t *testing.T) {
+	_, server := newTestSystem(t)
+	defer server.Close()
+
+	for _, hc := range []call.HallCall{{Floor: 5, Direction: "sideways"}, {Floor: 16, Direction: call.DIRECTION_UP}} {
+		resp := postCall(t, server, "/hall_call", hc)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %+v but got %d", hc, resp.StatusCode)
+		}
+	}
+}
+
+func TestCarCallGoesStraightToCar(t *testing.T) {
+	e, server := newTestSystem(t)
+	defer server.Close()
+
+	resp := postCall(t, server, "/car_call", call.CarCall{GroupId: "0", ElevatorId: "0", Floor: 7})
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 but got %d", resp.StatusCode)
+	}
+
+	var result struct {
+		CallId      string `json:"callId"`
+		PassengerId string `json:"passengerId"`
+		Floor       int    `json:"floor"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.CallId == "" || result.PassengerId == "" || result.Floor != 7 {
+		t.Errorf("Expected a queued call for floor 7 but got %+v", result)
+	}
+
+	record, err := http.Get(server.URL + "/passengers/" + result.PassengerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Body.Close()
+
+	if record.StatusCode != http.StatusOK {
+		t.Errorf("Expected the car call recorded but got %d", record.StatusCode)
+	}
+
+	e.WaitingPassengers.Lock()
+	calls := len(e.Waiting) + len(e.Passengers)
+	e.WaitingPassengers.Unlock()
+
+	if calls != 1 {
+		t.Errorf("Expected the car call on elevator 0-0 but it has %d calls", calls)
+	}
+
+	for _, c := range []struct {
+		cc   call.CarCall
+		code int
+	}{
+		{call.CarCall{GroupId: "0", ElevatorId: "3", Floor: 7}, http.StatusNotFound},
+		{call.CarCall{GroupId: "0", ElevatorId: "0", Floor: 20}, http.StatusBadRequest},
+	} {
+		resp := postCall(t, server, "/car_call", c.cc)
+		resp.Body.Close()
+
+		if resp.StatusCode != c.code {
+			t.Errorf("Expected %d for %+v but got %d", c.code, c.cc, resp.StatusCode)
+		}
+	}
+}
+
+func TestHallCallIsScheduledOnceBeforeStatusesShowIt(t *testing.T) {
+	fake := clock.NewFake(time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC))
+	st := newRacingStore(0, 0)
+	api := newTestApi(t, st, nil)
+	api.Clock = fake
+
+	hc := &call.HallCall{Floor: 5, Direction: call.DIRECTION_UP}
+	first, err := api.DispatchHallCall(hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither elevator consumes its calls, so only the assignment record shows the first call.
+	second, err := api.DispatchHallCall(hc)
+	if err != nil || second.ElevatorId != first.ElevatorId || second.Reason != http_api.REASON_ALREADY_CALLED {
+		t.Fatalf("Expected elevator %s already called but got %+v, %v", first.ElevatorId, second, err)
+	}
+
+	// By the time the assignment record expires, the elevator's status shows the button lit.
+	id, _ := strconv.Atoi(first.ElevatorId)
+	data, _ := json.Marshal(&elevator.ElevatorStatus{
+		Id:                id,
+		CurrentFloor:      first.CurrentFloor,
+		CurrentState:      elevator.STATE_MOVING_UP,
+		ServedFloors:      elevator.ServedFloors{Ranges: []elevator.FloorRange{{Min: 1, Max: 16}}},
+		HallButtons:       []call.HallCall{*hc},
+		WaitingPassengers: elevator.WaitingPassengers{Waiting: []*passenger.Passenger{{Id: first.PassengerId, CurrentFloor: 5, DestinationFloor: 6, HallCall: call.DIRECTION_UP}}},
+	})
+	st.SetStatus(store.Key(0, id), data, time.Hour)
+
+	fake.Advance(http_api.ASSIGNMENT_TTL)
+	third, err := api.DispatchHallCall(hc)
+	if err != nil || third.PassengerId != first.PassengerId || third.Reason != http_api.REASON_ALREADY_CALLED {
+		t.Errorf("Expected the lit button's call returned but got %+v, %v", third, err)
+	}
+}
@@ -0,0 +1,188 @@
+package http_api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Handles GET /dashboard.  Serves a single page showing every group as a shaft diagram, kept live from /events.
+func (ha *HttpApi) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, dashboardHtml)
+}
+
+// The dashboard page.  Kept inline so the binary has no files to deploy alongside it.
+// Every elevator is drawn in a shaft beside its group's floors, using the same objects as GET /elevators.
+// Calls and maintenance go through POST /elevator_call and POST /maintenance.
+const dashboardHtml = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Elevator Status</title>
+<style>
+	body { font-family: sans-serif; margin: 16px; color: #222; }
+	h1 { font-size: 20px; }
+	h2 { font-size: 16px; margin-bottom: 4px; }
+	form { margin-bottom: 16px; }
+	input { width: 48px; }
+	.groups { display: flex; flex-wrap: wrap; gap: 32px; align-items: flex-start; }
+	table.shafts { border-collapse: collapse; }
+	table.shafts th, table.shafts td { border: 1px solid #ccc; width: 64px; height: 24px; text-align: center; font-size: 12px; }
+	table.shafts td.floor { width: 32px; font-weight: bold; }
+	table.shafts td.waiting { width: 48px; color: #b55; }
+	table.shafts td.skipped { background: #eee; }
+	.car { display: inline-block; width: 56px; border-radius: 3px; background: #4a7; color: #fff; }
+	.car.open { background: #e90; }
+	.car.maintenance { background: #888; }
+	.car.dead { background: #c44; }
+	.controls { font-size: 11px; }
+	#message { color: #555; }
+</style>
+</head>
+<body>
+<h1>Elevator Status</h1>
+
+<form id="call">
+	Call from floor <input id="from" type="number" required> to <input id="to" type="number" required>
+	<button type="submit">Call</button>
+	<span id="message"></span>
+</form>
+
+<div class="groups" id="groups"></div>
+
+<script>
+var elevators = {};
+
+function key(e) { return e.groupId + "-" + e.id; }
+
+function arrow(e) {
+	if (e.state === "MOVING_UP") { return "▲"; }
+	if (e.state === "MOVING_DOWN") { return "▼"; }
+	return "";
+}
+
+function doorOpen(e) {
+	if (e.door) { return e.door !== "CLOSED"; }
+	return e.state === "LOADING" || e.state === "UNLOADING";
+}
+
+function serves(e, floor) {
+	var ranges = (e.servedFloors && e.servedFloors.ranges) || [];
+	var skip = (e.servedFloors && e.servedFloors.skip) || [];
+	if (skip.indexOf(floor) >= 0) { return false; }
+	if (ranges.length === 0) { return true; }
+	return ranges.some(function (r) { return floor >= r.min && floor <= r.max; });
+}
+
+function floorBounds(cars) {
+	var min = Infinity, max = -Infinity;
+	cars.forEach(function (e) {
+		var ranges = (e.servedFloors && e.servedFloors.ranges) || [];
+		if (ranges.length === 0) { ranges = [{min: e.currentFloor, max: e.currentFloor}]; }
+		ranges.forEach(function (r) {
+			min = Math.min(min, r.min);
+			max = Math.max(max, r.max);
+		});
+	});
+	return {min: min, max: max};
+}
+
+function carLabel(e) {
+	var load = e.committedLoad + (e.maxCapacity ? "/" + e.maxCapacity : "");
+	return (e.id + 1) + " " + arrow(e) + "<br>" + load;
+}
+
+function carClass(e) {
+	if (!e.alive) { return "car dead"; }
+	if (e.state === "MAINTENANCE" || e.state === "DRAINING") { return "car maintenance"; }
+	if (doorOpen(e)) { return "car open"; }
+	return "car";
+}
+
+function render() {
+	var groups = {};
+	Object.keys(elevators).forEach(function (k) {
+		var e = elevators[k];
+		(groups[e.groupId] = groups[e.groupId] || []).push(e);
+	});
+
+	var html = "";
+	Object.keys(groups).sort(function (a, b) { return a - b; }).forEach(function (g) {
+		var cars = groups[g].sort(function (a, b) { return a.id - b.id; });
+		var bounds = floorBounds(cars);
+
+		html += "<div><h2>Group " + g + "</h2><table class=\"shafts\"><tr><th>Floor</th><th>Waiting</th>";
+		cars.forEach(function (e) {
+			var state = e.alive ? e.state : "OFFLINE";
+			html += "<th>Car " + (e.id + 1) + "<div class=\"controls\">" + state + "<br>" +
+				"<button onclick=\"maintenance(" + e.groupId + "," + e.id + "," + !e.maintenanceRequested + ")\">" +
+				(e.maintenanceRequested ? "Resume" : "Maintain") + "</button></div></th>";
+		});
+		html += "</tr>";
+
+		for (var floor = bounds.max; floor >= bounds.min; floor--) {
+			var waiting = 0;
+			cars.forEach(function (e) {
+				(e.waitingPassengers || []).forEach(function (p) {
+					if (p.currentFloor === floor) { waiting++; }
+				});
+			});
+
+			html += "<tr><td class=\"floor\">" + floor + "</td><td class=\"waiting\">" + (waiting || "") + "</td>";
+			cars.forEach(function (e) {
+				var cls = serves(e, floor) ? "" : " class=\"skipped\"";
+				var car = e.currentFloor === floor ? "<span class=\"" + carClass(e) + "\">" + carLabel(e) + "</span>" : "";
+				html += "<td" + cls + ">" + car + "</td>";
+			});
+			html += "</tr>";
+		}
+		html += "</table></div>";
+	});
+
+	document.getElementById("groups").innerHTML = html;
+}
+
+function post(path, body) {
+	return fetch(path, {method: "POST", headers: {"Content-Type": "application/json"}, body: JSON.stringify(body)})
+		.then(function (resp) { return resp.json(); });
+}
+
+function maintenance(groupId, elevatorId, on) {
+	post("/maintenance", {groupId: String(groupId), elevatorId: String(elevatorId), maintenance: String(on)});
+}
+
+document.getElementById("call").addEventListener("submit", function (ev) {
+	ev.preventDefault();
+	var message = document.getElementById("message");
+	var p = {
+		currentFloor: parseInt(document.getElementById("from").value, 10),
+		destinationFloor: parseInt(document.getElementById("to").value, 10)
+	};
+
+	post("/elevator_call", p).then(function (result) {
+		if (result.error) {
+			message.textContent = result.error + (result.transferFloor >= 0 ? "  Change elevators at floor " + result.transferFloor + "." : "");
+		} else {
+			message.textContent = "Take car " + (parseInt(result.elevatorId, 10) + 1) + " in group " + result.groupId +
+				", arriving in ~" + result.estimatedPickup + "s.";
+		}
+	}).catch(function (err) {
+		message.textContent = "Call failed: " + err;
+	});
+});
+
+var source = new EventSource("/events");
+source.addEventListener("status", function (ev) {
+	var e = JSON.parse(ev.data);
+	elevators[key(e)] = e;
+	render();
+});
+</script>
+</body>
+</html>
+`
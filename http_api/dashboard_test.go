@@ -0,0 +1,34 @@
+package http_api_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davepersing/elevator-platform/memory_store"
+)
+
+func TestDashboardIsServed(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	st.Init()
+
+	server := httptest.NewServer(newTestApi(t, st, nil).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/dashboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("Expected 200 text/html but got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `new EventSource("/events")`) {
+		t.Error("Expected the dashboard to subscribe to /events")
+	}
+}
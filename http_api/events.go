@@ -0,0 +1,175 @@
+package http_api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/davepersing/elevator-platform/elevator"
+	"github.com/davepersing/elevator-platform/store"
+)
+
+const (
+	// Events buffered for each subscriber.  Subscribers that fall further behind are disconnected.
+	EVENT_BUFFER = 64
+
+	// How often an idle stream sends a comment so proxies don't close it.
+	EVENT_HEARTBEAT = 15 * time.Second
+)
+
+type (
+	// Fans a single store status watch out to every /events subscriber.
+	// Only statuses that changed since the last one saved by the same elevator are sent.
+	eventHub struct {
+		startOnce sync.Once
+
+		mu          sync.Mutex
+		last        map[string][]byte        // The last status saved by each elevator.
+		views       map[string]*elevatorView // The last event sent for each elevator.
+		subscribers map[chan []byte]bool
+	}
+)
+
+// Starts watching statuses.  Safe to call more than once.
+func (h *eventHub) start(st store.Store) {
+	h.startOnce.Do(func() {
+		h.mu.Lock()
+		h.last = make(map[string][]byte)
+		h.views = make(map[string]*elevatorView)
+		h.subscribers = make(map[chan []byte]bool)
+		h.mu.Unlock()
+
+		st.WatchStatuses(h.update, func(state string) {
+			fmt.Printf("Status event watcher is %s.\n", state)
+		})
+	})
+}
+
+// Sends an elevator's status to every subscriber if it changed.  nil data means the elevator's status expired.
+func (h *eventHub) update(key string, data []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if bytes.Equal(h.last[key], data) {
+		return
+	}
+
+	var view *elevatorView
+	if data == nil {
+		prev, ok := h.views[key]
+		if !ok {
+			return
+		}
+		view = &elevatorView{ElevatorStatus: prev.ElevatorStatus, State: prev.State, Alive: false}
+	} else {
+		es := &elevator.ElevatorStatus{}
+		if err := json.Unmarshal(data, es); err != nil {
+			fmt.Printf("Could not decode status event.  Error: %v\n", err)
+			return
+		}
+		view = &elevatorView{ElevatorStatus: es, State: elevator.StateName(es.CurrentState), Alive: true}
+	}
+
+	event, err := json.Marshal(view)
+	if err != nil {
+		fmt.Printf("Could not encode status event.  Error: %v\n", err)
+		return
+	}
+
+	h.last[key] = data
+	h.views[key] = view
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Too far behind.  Drop the subscriber rather than block every other one.
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Returns a channel receiving the latest status of every known elevator, then every change.
+// The channel is closed if the subscriber falls too far behind.
+func (h *eventHub) subscribe() chan []byte {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	views := make([]*elevatorView, 0, len(h.views))
+	for _, view := range h.views {
+		views = append(views, view)
+	}
+	sort.Sort(byGroupAndId(views))
+
+	ch := make(chan []byte, len(views)+EVENT_BUFFER)
+	for _, view := range views {
+		if event, err := json.Marshal(view); err == nil {
+			ch <- event
+		}
+	}
+
+	h.subscribers[ch] = true
+	return ch
+}
+
+// Stops sending events to the channel.
+func (h *eventHub) unsubscribe(ch chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subscribers[ch] {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Handles GET /events.  Streams elevator status changes as Server-Sent Events until the client disconnects.
+// Every event is named status and holds the same elevator object as GET /elevators/{group}/{id}.
+func (ha *HttpApi) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, "Streaming is not supported.")
+		return
+	}
+
+	// Done once the client disconnects.
+	closed := r.Context().Done()
+
+	ha.events.start(ha.Store)
+	ch := ha.events.subscribe()
+	defer ha.events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(EVENT_HEARTBEAT)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "event: status\ndata: %s\n\n", event)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-closed:
+			return
+		}
+		flusher.Flush()
+	}
+}
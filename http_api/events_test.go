@@ -0,0 +1,152 @@
+package http_api_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davepersing/elevator-platform/clock"
+	"github.com/davepersing/elevator-platform/elevator"
+	"github.com/davepersing/elevator-platform/memory_store"
+	"github.com/davepersing/elevator-platform/passenger"
+	"github.com/davepersing/elevator-platform/store"
+)
+
+// The fields of a status event checked by these tests.
+type statusEvent struct {
+	Id                int                    `json:"id"`
+	GroupId           int                    `json:"groupId"`
+	Alive             bool                   `json:"alive"`
+	WaitingPassengers []*passenger.Passenger `json:"waitingPassengers"`
+	Passengers        []*passenger.Passenger `json:"passengers"`
+}
+
+// Reads status events from an event stream until fn returns true.  Fails the test after a timeout.
+func waitForEvent(t *testing.T, events <-chan statusEvent, fn func(statusEvent) bool) statusEvent {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatal("Event stream closed")
+			}
+			if fn(ev) {
+				return ev
+			}
+		case <-timeout:
+			t.Fatal("Timed out waiting for a status event")
+		}
+	}
+}
+
+// Decodes the status events of a Server-Sent Events stream.
+func readEvents(resp *http.Response) <-chan statusEvent {
+	events := make(chan statusEvent)
+	go func() {
+		defer close(events)
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+
+			var ev statusEvent
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev); err == nil {
+				events <- ev
+			}
+		}
+	}()
+	return events
+}
+
+func TestEventsStreamStatusChanges(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	st.Init()
+
+	newTestElevator(st, 0, 0, 1, 16)
+
+	server := httptest.NewServer(newTestApi(t, st, nil).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream but got %s", ct)
+	}
+
+	events := readEvents(resp)
+
+	// The current status is sent as soon as the stream opens.
+	ev := waitForEvent(t, events, func(ev statusEvent) bool { return true })
+	if ev.GroupId != 0 || ev.Id != 0 || !ev.Alive {
+		t.Errorf("Expected live elevator 0-0 but got %+v", ev)
+	}
+
+	postElevatorCall(t, server, passenger.Passenger{CurrentFloor: 12, DestinationFloor: 3}).Body.Close()
+
+	waitForEvent(t, events, func(ev statusEvent) bool {
+		return len(ev.WaitingPassengers)+len(ev.Passengers) == 1
+	})
+}
+
+func TestEventsStreamEndsWhenClientGoesAway(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	st.Init()
+	handler := newTestApi(t, st, nil).Handler()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/events", nil).WithContext(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the stream to end once the request was cancelled")
+	}
+}
+
+func TestEventsShowExpiredElevatorsAsDead(t *testing.T) {
+	fake := clock.NewFake(time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC))
+	st := &memory_store.MemoryStore{Clock: fake}
+	st.Init()
+
+	// An elevator that saves its status once and then stops responding.
+	data, _ := json.Marshal(&elevator.ElevatorStatus{Id: 0, GroupId: 0, CurrentFloor: 1})
+	st.SetStatus(store.Key(0, 0), data, elevator.STATUS_TTL)
+
+	server := httptest.NewServer(newTestApi(t, st, nil).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	events := readEvents(resp)
+	waitForEvent(t, events, func(ev statusEvent) bool { return ev.Alive })
+
+	fake.Advance(elevator.STATUS_TTL + memory_store.EXPIRY_INTERVAL)
+
+	ev := waitForEvent(t, events, func(ev statusEvent) bool { return !ev.Alive })
+	if ev.GroupId != 0 || ev.Id != 0 {
+		t.Errorf("Expected elevator 0-0 shown dead but got %+v", ev)
+	}
+}
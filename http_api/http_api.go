@@ -4,21 +4,40 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
+	"time"
 
-	"github.com/coreos/etcd/client"
+	"github.com/davepersing/elevator-platform/clock"
+	"github.com/davepersing/elevator-platform/election"
 	"github.com/davepersing/elevator-platform/elevator"
-	"github.com/davepersing/elevator-platform/etcd"
+	"github.com/davepersing/elevator-platform/group"
 	"github.com/davepersing/elevator-platform/passenger"
 	"github.com/davepersing/elevator-platform/scheduler"
-	"golang.org/x/net/context"
+	"github.com/davepersing/elevator-platform/store"
+	"github.com/davepersing/elevator-platform/util"
 )
 
 type (
 	HttpApi struct {
-		Hostname string // Hostname this server listens on.
-		Port     string // Port this http server listens on.
-		*etcd.Etcd
+		Hostname string      // Hostname this server listens on.
+		Port     string      // Port this http server listens on.
+		Store    store.Store // Backing data store shared with the rest of the cluster.
+
+		Scheduler scheduler.Scheduler // Strategy used to assign passengers to elevators.
+		Groups    []*group.Group      // Every elevator group in the building.  Calls are only scheduled within groups serving both floors.
+		Clock     clock.Clock         // Timestamps passenger calls.  Defaults to the system clock.
+
+		// Campaigns for leadership of the cluster and runs leader-only tasks while this node leads.  Optional.
+		Leadership *election.Leadership
+
+		events eventHub // Fans the status watch out to /events subscribers.
+	}
+
+	// A passenger call that couldn't be scheduled.
+	DispatchError struct {
+		Code   int              // The HTTP status code to respond with.
+		Result util.ErrorResult // The response body.
 	}
 
 	maintenanceRequest struct {
@@ -30,7 +49,7 @@ type (
 
 // Initializes the HTTP API module.
 func (ha *HttpApi) Init() {
-	ha.Etcd.Init()
+	ha.Store.Init()
 
 	if ha.Hostname == "" {
 		fmt.Println("Hostname is empty.  Running on localhost.")
@@ -40,17 +59,41 @@ func (ha *HttpApi) Init() {
 		panic("HttpApi Port must be specified.")
 	}
 
-	go func(ha *HttpApi) {
+	if ha.Scheduler == nil {
+		s, err := scheduler.Get(scheduler.DEFAULT_SCHEDULER)
+		if err != nil {
+			panic(err)
+		}
+		ha.Scheduler = s
+	}
+
+	if ha.Leadership != nil {
+		go ha.Leadership.Run(nil)
+	}
 
-		mux := http.NewServeMux()
-		mux.HandleFunc("/elevator_call", ha.handleElevatorCall)
-		mux.HandleFunc("/maintenance", ha.handleElevatorMaintenance)
-		http.ListenAndServe(ha.Hostname+ha.Port, mux)
+	go func(ha *HttpApi) {
+		http.ListenAndServe(ha.Hostname+ha.Port, ha.Handler())
 	}(ha)
 }
 
+// Returns the handler serving every endpoint of the HTTP API.
+func (ha *HttpApi) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/elevator_call", ha.handleElevatorCall)
+	mux.HandleFunc("/hall_call", ha.handleHallCall)
+	mux.HandleFunc("/car_call", ha.handleCarCall)
+	mux.HandleFunc("/maintenance", ha.handleElevatorMaintenance)
+	mux.HandleFunc("/elevators", ha.handleElevators)
+	mux.HandleFunc("/elevators/", ha.handleElevator)
+	mux.HandleFunc("/groups/", ha.handleGroup)
+	mux.HandleFunc("/passengers/", ha.handlePassenger)
+	mux.HandleFunc("/leader", ha.handleLeader)
+	mux.HandleFunc("/events", ha.handleEvents)
+	mux.HandleFunc("/dashboard", ha.handleDashboard)
+	return mux
+}
+
 // Handles request to put elevator in maintenance mode.
-//
 func (ha *HttpApi) handleElevatorMaintenance(w http.ResponseWriter, r *http.Request) {
 
 	decoder := json.NewDecoder(r.Body)
@@ -63,7 +106,7 @@ func (ha *HttpApi) handleElevatorMaintenance(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if err := ha.Etcd.SetMaintenanceMode(mr.ElevatorId, mr.GroupId, mr.Maintenance); err != nil {
+	if err := ha.Store.SetMaintenanceMode(mr.GroupId+"-"+mr.ElevatorId, mr.Maintenance); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(w, "Error setting maintenance mode for elevator: %v\n", err)
 		return
@@ -96,86 +139,272 @@ func (ha *HttpApi) handleElevatorCall(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	statuses, err := ha.Etcd.GetAllStatuses()
+	// A new call.  The id and timestamps are the server's to set.
+	p = passenger.Passenger{CurrentFloor: p.CurrentFloor, DestinationFloor: p.DestinationFloor}
+
+	success, err := ha.Dispatch(&p)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Printf("Error getting all statuses.  Error: %v", err)
+		de := toDispatchError(err)
+		fmt.Printf("Could not schedule passenger.  %s  Transfer floor: %d\n", de.Result.Error, de.Result.TransferFloor)
+		writeError(w, de.Code, de.Result)
 		return
 	}
 
-	elevatorStatuses, err := decodeStatuses(statuses)
-	if err != nil {
-		fmt.Printf("Error decoding statuses from etcd.  Error: %v\n", err)
+	fmt.Printf("Scheduled passenger on elevator %s-%s.  Reason: %s  ETA: %ds\n", success.GroupId, success.ElevatorId, success.Reason, success.EstimatedArrival)
+
+	// Update etcd with the status letting the elevator know it's status has change.
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(success); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error sending successful response.  %v\n", err)
 	}
+}
 
-	elevatorId, groupId := scheduler.FindElevator(elevatorStatuses, &p)
+// Schedules the passenger on an elevator and queues the call for it.
+// This is everything POST /elevator_call does besides decoding the request, so the simulator can dispatch calls in-process.
+// A passenger without an id is given one and timestamped as calling now.  The passenger's record is saved with the elevator assigned.
+// Returns a *DispatchError if the passenger couldn't be scheduled.
+func (ha *HttpApi) Dispatch(p *passenger.Passenger) (*util.SuccessResult, error) {
+	if p.Id == "" {
+		p.Id = passenger.NewId()
+		p.CalledAt = ha.now()
+	}
 
-	if elevatorId < 0 || groupId < 0 {
-		fmt.Println("Could not schedule passenger.  All elevators are busy.")
-		w.WriteHeader(http.StatusServiceUnavailable)
-		return
+	var assignment scheduler.Assignment
+	var es *elevator.ElevatorStatus
+
+	// Decide, then claim the elevator.  If another dispatch claimed it first, decide again with its call counted.
+	for attempt := 1; ; attempt++ {
+		now := ha.now()
+
+		statuses, err := ha.Store.GetAllStatuses()
+		if err != nil {
+			return nil, internalError("Error getting all statuses.  Error: %v", err)
+		}
+
+		groupStatuses, err := decodeStatuses(statuses)
+		if err != nil {
+			fmt.Printf("Error decoding statuses from store.  Error: %v\n", err)
+		}
+
+		records, err := ha.Store.GetAssignments()
+		if err != nil {
+			return nil, internalError("Error getting assignments.  Error: %v", err)
+		}
+		pending := applyAssignments(groupStatuses, records, now)
+
+		groupIds := ha.groupsServing(p, groupStatuses)
+		candidates := flattenStatuses(groupStatuses, groupIds)
+		if len(groupIds) == 0 || (len(candidates) > 0 && !scheduler.AnyServesTrip(candidates, p)) {
+			// No single elevator can take this trip.
+			return nil, rejectTrip(p, flattenStatuses(groupStatuses, nil))
+		}
+
+		assignment = ha.findElevator(groupIds, groupStatuses, p)
+		if assignment.ElevatorId < 0 || assignment.GroupId < 0 {
+			return nil, &DispatchError{Code: http.StatusServiceUnavailable, Result: util.ErrorResult{Error: "All elevators are busy.", TransferFloor: -1}}
+		}
+
+		key := store.Key(assignment.GroupId, assignment.ElevatorId)
+		p.Elevator = key
+
+		var version int64
+		if versioned, ok := records[key]; ok {
+			version = versioned.Version
+		}
+
+		claimed, err := ha.claim(key, version, pending[key], p, now)
+		if err != nil {
+			return nil, internalError("Could not assign elevator %s.  Error: %v", key, err)
+		}
+
+		if claimed {
+			es = groupStatuses[assignment.GroupId][assignment.ElevatorId]
+			break
+		}
+
+		if attempt == MAX_ASSIGNMENT_ATTEMPTS {
+			return nil, &DispatchError{Code: http.StatusConflict, Result: util.ErrorResult{
+				Error:         fmt.Sprintf("Elevator assignments kept changing.  Gave up after %d attempts.", attempt),
+				TransferFloor: -1,
+			}}
+		}
 	}
 
-	jsonBytes, err := json.Marshal(&p)
+	elevatorId, groupId := assignment.ElevatorId, assignment.GroupId
+
+	// From here on, a failed dispatch gives back its claim, so the elevator isn't counted busy with a call it never gets.
+	jsonBytes, err := json.Marshal(p)
 	if err != nil {
-		fmt.Printf("Could not marshal passenger json.  Error: %v\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		ha.release(p.Elevator, p)
+		return nil, internalError("Could not marshal passenger json.  Error: %v", err)
+	}
+
+	// Record the passenger first, so they can be looked up as soon as the elevator has them.
+	if err := ha.Store.SavePassenger(p.Id, jsonBytes, passenger.RECORD_TTL); err != nil {
+		ha.release(p.Elevator, p)
+		return nil, internalError("Could not save passenger %s.  Error: %v", p.Id, err)
 	}
 
-	err = ha.Etcd.SetPassenger(elevatorId, groupId, jsonBytes)
+	callId, err := ha.Store.EnqueueCall(p.Elevator, jsonBytes)
 	if err != nil {
-		fmt.Printf("Could not set passenger to %d\n", elevatorId)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		ha.release(p.Elevator, p)
+		return nil, internalError("Could not set passenger to %d-%d.  Error: %v", groupId, elevatorId, err)
 	}
 
-	// Update etcd with the status letting the elevator know it's status has change.
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	return &util.SuccessResult{
+		ElevatorId:       strconv.Itoa(elevatorId),
+		GroupId:          strconv.Itoa(groupId),
+		CallId:           callId,
+		PassengerId:      p.Id,
+		EstimatedPickup:  seconds(assignment.EstimatedPickup),
+		EstimatedArrival: seconds(assignment.EstimatedArrival),
+		CurrentFloor:     es.CurrentFloor,
+		Direction:        es.Direction(),
+		Reason:           assignment.Reason,
+	}, nil
+}
 
-	success := map[string]string{"elevatorId": strconv.Itoa(elevatorId), "groupId": strconv.Itoa(groupId)}
+// Dispatches a passenger's call again, away from the elevator it is assigned to, and records why.
+// The passenger keeps their id and call time.  p is left unchanged, so it can be kept if no other elevator is free.
+func (ha *HttpApi) Reassign(p *passenger.Passenger, reason string) (*util.SuccessResult, error) {
+	moved := *p
+	moved.Reassignments = append(moved.Reassignments[:len(moved.Reassignments):len(moved.Reassignments)],
+		passenger.Reassignment{From: p.Elevator, Reason: reason, At: ha.now()})
 
-	if err := json.NewEncoder(w).Encode(success); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "Error sending successful response.  %v\n", err)
+	return ha.Dispatch(&moved)
+}
+
+// Returns the current time on the API's clock.
+func (ha *HttpApi) now() time.Time {
+	if ha.Clock == nil {
+		return time.Now()
+	}
+	return ha.Clock.Now()
+}
+
+// Returns the reason a call couldn't be scheduled.
+func (e *DispatchError) Error() string {
+	return e.Result.Error
+}
+
+// Returns a DispatchError for a failure on the server's side.
+func internalError(format string, args ...interface{}) *DispatchError {
+	return &DispatchError{Code: http.StatusInternalServerError, Result: util.ErrorResult{Error: fmt.Sprintf(format, args...), TransferFloor: -1}}
+}
+
+// Returns err as a DispatchError.  Any other error is a failure on the server's side.
+func toDispatchError(err error) *DispatchError {
+	if de, ok := err.(*DispatchError); ok {
+		return de
 	}
+	return internalError("%v", err)
+}
+
+// Returns the duration in whole seconds, rounded up.
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
 }
 
-func decodeStatuses(statuses []*client.Node) (map[int]*elevator.ElevatorStatus, error) {
+// Rejects a trip no single elevator serves.
+// Suggests a floor to change elevators at if the trip can be split in two.
+func rejectTrip(p *passenger.Passenger, statuses []*elevator.ElevatorStatus) *DispatchError {
+	return &DispatchError{
+		Code: http.StatusBadRequest,
+		Result: util.ErrorResult{
+			Error:         fmt.Sprintf("No elevator serves floors %d and %d.", p.CurrentFloor, p.DestinationFloor),
+			TransferFloor: scheduler.FindTransferFloor(statuses, p),
+		},
+	}
+}
 
-	elStatuses := make(map[int]*elevator.ElevatorStatus)
+// Responds with a failed elevator call.
+func writeError(w http.ResponseWriter, code int, result util.ErrorResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 
-	for _, node := range statuses {
-		var elStat elevator.ElevatorStatus
-		err := json.Unmarshal([]byte(node.Value), &elStat)
-		if err != nil {
-			// skip this.
-			// Don't add to hash if the response can't be deciphered.
-		} else {
-			elStatuses[elStat.Id] = &elStat
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		fmt.Printf("Error sending error response.  %v\n", err)
+	}
+}
+
+// Returns the ids of the groups serving both of the passenger's floors, in order of preference.
+// Without configured groups, every group with a live elevator is considered.
+func (ha *HttpApi) groupsServing(p *passenger.Passenger, groupStatuses map[int]map[int]*elevator.ElevatorStatus) []int {
+	var groupIds []int
+
+	if len(ha.Groups) == 0 {
+		for groupId := range groupStatuses {
+			groupIds = append(groupIds, groupId)
 		}
+		sort.Ints(groupIds)
+		return groupIds
 	}
 
-	return elStatuses, nil
+	for _, g := range group.Serving(ha.Groups, p.CurrentFloor, p.DestinationFloor) {
+		groupIds = append(groupIds, g.Id)
+	}
+	return groupIds
 }
 
-func (ha *HttpApi) getAllStatuses() ([]*client.Node, error) {
-	resp, err := ha.KeysApi.Get(context.Background(), "/elevators", nil)
-	if err != nil {
-		fmt.Printf("Cannot get all statuses.  Error: %+v\n", err)
-		return nil, err
+// Schedules the passenger within each group in turn, so only elevators in the same group are compared.
+// Returns the first assignment found.
+func (ha *HttpApi) findElevator(groupIds []int, groupStatuses map[int]map[int]*elevator.ElevatorStatus, p *passenger.Passenger) scheduler.Assignment {
+	for _, groupId := range groupIds {
+		statuses, ok := groupStatuses[groupId]
+		if !ok {
+			// No live elevators in this group.
+			continue
+		}
+
+		assignment := ha.Scheduler.FindElevator(statuses, p)
+		if assignment.ElevatorId >= 0 {
+			return assignment
+		}
 	}
 
-	return resp.Node.Nodes, nil
+	return scheduler.Unavailable()
 }
 
-func (ha *HttpApi) setPassenger(elevatorId, groupId int, jsonData []byte) error {
-	path := "/wait/" + strconv.Itoa(groupId) + "-" + strconv.Itoa(elevatorId)
-	_, err := ha.KeysApi.Set(context.Background(), path, string(jsonData), nil)
-	if err != nil {
-		fmt.Printf("Error setting passenger to etcd.  Error: %s\n", err.Error())
-		return err
+// Returns the statuses of every elevator in the given groups, or in every group if groupIds is nil.
+func flattenStatuses(groupStatuses map[int]map[int]*elevator.ElevatorStatus, groupIds []int) []*elevator.ElevatorStatus {
+	var statuses []*elevator.ElevatorStatus
+
+	if groupIds == nil {
+		for groupId := range groupStatuses {
+			groupIds = append(groupIds, groupId)
+		}
+	}
+
+	for _, groupId := range groupIds {
+		for _, es := range groupStatuses[groupId] {
+			statuses = append(statuses, es)
+		}
+	}
+	return statuses
+}
+
+// Decodes the statuses into a hash of groups, each a hash of elevator statuses by elevator id.
+func decodeStatuses(statuses [][]byte) (map[int]map[int]*elevator.ElevatorStatus, error) {
+
+	groupStatuses := make(map[int]map[int]*elevator.ElevatorStatus)
+
+	for _, data := range statuses {
+		var elStat elevator.ElevatorStatus
+		err := json.Unmarshal(data, &elStat)
+		if err != nil {
+			// skip this.
+			// Don't add to hash if the response can't be deciphered.
+			continue
+		}
+
+		if groupStatuses[elStat.GroupId] == nil {
+			groupStatuses[elStat.GroupId] = make(map[int]*elevator.ElevatorStatus)
+		}
+		groupStatuses[elStat.GroupId][elStat.Id] = &elStat
 	}
-	return nil
+
+	return groupStatuses, nil
 }
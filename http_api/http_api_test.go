@@ -0,0 +1,195 @@
+package http_api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davepersing/elevator-platform/elevator"
+	"github.com/davepersing/elevator-platform/group"
+	"github.com/davepersing/elevator-platform/http_api"
+	"github.com/davepersing/elevator-platform/memory_store"
+	"github.com/davepersing/elevator-platform/passenger"
+	"github.com/davepersing/elevator-platform/scheduler"
+	"github.com/davepersing/elevator-platform/store"
+	"github.com/davepersing/elevator-platform/util"
+)
+
+// Runs an elevator and the HTTP API against the in-memory store.
+func newTestSystem(t *testing.T) (*elevator.Elevator, *httptest.Server) {
+	st := &memory_store.MemoryStore{}
+	st.Init()
+
+	e := newTestElevator(st, 0, 0, 1, 16)
+
+	return e, httptest.NewServer(newTestApi(t, st, nil).Handler())
+}
+
+// Creates an HTTP API using the default scheduler.
+func newTestApi(t *testing.T, st store.Store, groups []*group.Group) *http_api.HttpApi {
+	sched, err := scheduler.Get(scheduler.DEFAULT_SCHEDULER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &http_api.HttpApi{Store: st, Scheduler: sched, Groups: groups}
+}
+
+// Creates and starts an idle elevator on its group's bottom floor.
+func newTestElevator(st store.Store, groupId, id, minFloor, maxFloor int) *elevator.Elevator {
+	e := &elevator.Elevator{
+		MaxFloor:    maxFloor,
+		MinFloor:    minFloor,
+		MaxCapacity: 16,
+		Store:       st,
+		ElevatorStatus: elevator.ElevatorStatus{
+			Id:                id,
+			GroupId:           groupId,
+			CurrentFloor:      minFloor,
+			CurrentState:      elevator.STATE_IDLE,
+			WaitingPassengers: elevator.WaitingPassengers{Waiting: make([]*passenger.Passenger, 0)},
+			Passengers:        make([]*passenger.Passenger, 0),
+		},
+	}
+	e.Init()
+
+	return e
+}
+
+// Posts a passenger to /elevator_call.
+func postElevatorCall(t *testing.T, server *httptest.Server, p passenger.Passenger) *http.Response {
+	data, _ := json.Marshal(p)
+	resp, err := http.Post(server.URL+"/elevator_call", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestElevatorCallReachesElevator(t *testing.T) {
+	e, server := newTestSystem(t)
+	defer server.Close()
+
+	resp := postElevatorCall(t, server, passenger.Passenger{CurrentFloor: 12, DestinationFloor: 3})
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 but got %d", resp.StatusCode)
+	}
+
+	var result util.SuccessResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.ElevatorId != "0" || result.GroupId != "0" {
+		t.Errorf("Expected elevator 0-0 but got %s-%s", result.GroupId, result.ElevatorId)
+	}
+
+	if result.CallId == "" || result.PassengerId == "" {
+		t.Errorf("Expected a call id and a passenger id but got %+v", result)
+	}
+
+	if result.CurrentFloor != 1 || result.Direction != elevator.DIRECTION_NONE || result.Reason != scheduler.REASON_CLOSEST_IDLE {
+		t.Errorf("Expected an idle elevator on floor 1 but got %+v", result)
+	}
+
+	// 11 floors to the passenger, a stop, then 9 floors to their destination.
+	if result.EstimatedPickup != 11 || result.EstimatedArrival != 21 {
+		t.Errorf("Expected pickup in 11s and arrival in 21s but got %ds and %ds", result.EstimatedPickup, result.EstimatedArrival)
+	}
+
+	e.WaitingPassengers.Lock()
+	defer e.WaitingPassengers.Unlock()
+
+	waiting := len(e.Waiting) + len(e.Passengers)
+	if waiting != 1 {
+		t.Errorf("Expected the elevator to pick up 1 passenger but it has %d", waiting)
+	}
+}
+
+func TestElevatorCallIsScheduledWithinServingGroup(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	st.Init()
+
+	groups := []*group.Group{
+		{Id: 0, ElevatorCount: 1, MinFloor: 1, MaxFloor: 16},
+		{Id: 1, ElevatorCount: 1, MinFloor: 1, MaxFloor: 40},
+	}
+	newTestElevator(st, 0, 0, 1, 16)
+	newTestElevator(st, 1, 0, 1, 40)
+
+	server := httptest.NewServer(newTestApi(t, st, groups).Handler())
+	defer server.Close()
+
+	// Only the high-rise group serves floor 30.
+	resp := postElevatorCall(t, server, passenger.Passenger{CurrentFloor: 30, DestinationFloor: 1})
+	var result util.SuccessResult
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+
+	if result.GroupId != "1" {
+		t.Errorf("Expected group 1 but got %s", result.GroupId)
+	}
+
+	// Both groups serve floor 10, so the smaller low-rise group is preferred.
+	resp = postElevatorCall(t, server, passenger.Passenger{CurrentFloor: 10, DestinationFloor: 1})
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+
+	if result.GroupId != "0" {
+		t.Errorf("Expected group 0 but got %s", result.GroupId)
+	}
+
+	// No group serves floor 50.
+	resp = postElevatorCall(t, server, passenger.Passenger{CurrentFloor: 50, DestinationFloor: 1})
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 but got %d", resp.StatusCode)
+	}
+}
+
+func TestElevatorCallSuggestsTransferFloor(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	st.Init()
+
+	low := newTestElevator(st, 0, 0, 1, 20)
+	high := &elevator.Elevator{
+		MinFloor: 1,
+		MaxFloor: 40,
+		Store:    st,
+		ElevatorStatus: elevator.ElevatorStatus{
+			Id:           0,
+			GroupId:      1,
+			CurrentFloor: 1,
+			ServedFloors: elevator.ServedFloors{Ranges: []elevator.FloorRange{{Min: 1, Max: 1}, {Min: 20, Max: 40}}},
+		},
+	}
+	high.Init()
+
+	server := httptest.NewServer(newTestApi(t, st, nil).Handler())
+	defer server.Close()
+
+	resp := postElevatorCall(t, server, passenger.Passenger{CurrentFloor: 10, DestinationFloor: 30})
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected 400 but got %d", resp.StatusCode)
+	}
+
+	var rejection util.ErrorResult
+	json.NewDecoder(resp.Body).Decode(&rejection)
+
+	if rejection.TransferFloor != 20 {
+		t.Errorf("Expected transfer floor 20 but got %d", rejection.TransferFloor)
+	}
+
+	low.WaitingPassengers.Lock()
+	defer low.WaitingPassengers.Unlock()
+	if len(low.Waiting) != 0 {
+		t.Error("Rejected trip should not be queued.")
+	}
+}
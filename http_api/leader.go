@@ -0,0 +1,35 @@
+package http_api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// The cluster's leader as returned by GET /leader.
+type leaderView struct {
+	Leader   string `json:"leader"`   // Id of the current leader, or empty while there is none.
+	Id       string `json:"id"`       // Id of the node answering.
+	IsLeader bool   `json:"isLeader"` // True if the node answering is the leader.
+}
+
+// Handles GET /leader.  Responds with the node currently elected leader.
+func (ha *HttpApi) handleLeader(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	if ha.Leadership == nil {
+		// This node doesn't take part in leader election.
+		http.NotFound(w, r)
+		return
+	}
+
+	leader, err := ha.Leadership.Elector.Leader()
+	if err != nil {
+		fmt.Printf("Error loading leader.  Error: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJson(w, leaderView{Leader: leader, Id: ha.Leadership.Id, IsLeader: ha.Leadership.IsLeader()})
+}
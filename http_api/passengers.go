@@ -0,0 +1,59 @@
+package http_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/davepersing/elevator-platform/passenger"
+)
+
+// A passenger's trip as returned by GET /passengers/{id}.
+type passengerView struct {
+	*passenger.Passenger
+
+	State    string `json:"state"`    // waiting, riding or delivered.
+	WaitTime int    `json:"waitTime"` // Seconds the passenger waited to be picked up, or has waited so far.
+	RideTime int    `json:"rideTime"` // Seconds the passenger rode the elevator, or has ridden so far.
+}
+
+// Handles GET /passengers/{id}.  Responds with the passenger's trip, from their call to their drop-off.
+func (ha *HttpApi) handlePassenger(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/passengers/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := ha.Store.GetPassenger(id)
+	if err != nil {
+		fmt.Printf("Error loading passenger %s.  Error: %v\n", id, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if data == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var p passenger.Passenger
+	if err := json.Unmarshal(data, &p); err != nil {
+		fmt.Printf("Error decoding passenger %s.  Error: %v\n", id, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	now := ha.now()
+	writeJson(w, &passengerView{
+		Passenger: &p,
+		State:     p.State(),
+		WaitTime:  seconds(p.WaitTime(now)),
+		RideTime:  seconds(p.RideTime(now)),
+	})
+}
@@ -0,0 +1,120 @@
+package http_api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/davepersing/elevator-platform/clock"
+	"github.com/davepersing/elevator-platform/elevator"
+	"github.com/davepersing/elevator-platform/memory_store"
+	"github.com/davepersing/elevator-platform/passenger"
+	"github.com/davepersing/elevator-platform/store"
+	"github.com/davepersing/elevator-platform/util"
+)
+
+// The fields of a passenger's trip checked by these tests.
+type passengerTrip struct {
+	Id           string    `json:"id"`
+	Elevator     string    `json:"elevator"`
+	CalledAt     time.Time `json:"calledAt"`
+	PickedUpAt   time.Time `json:"pickedUpAt"`
+	DroppedOffAt time.Time `json:"droppedOffAt"`
+	State        string    `json:"state"`
+	WaitTime     int       `json:"waitTime"`
+	RideTime     int       `json:"rideTime"`
+}
+
+// Gets a passenger's trip from /passengers/{id}.
+func getPassenger(t *testing.T, server *httptest.Server, id string) (passengerTrip, int) {
+	resp, err := http.Get(server.URL + "/passengers/" + id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var trip passengerTrip
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&trip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return trip, resp.StatusCode
+}
+
+// Creates and starts an idle elevator 0-0 on floor 1 that only moves when stepped.
+func newSteppedElevator(st store.Store, c clock.Clock) *elevator.Elevator {
+	e := &elevator.Elevator{
+		MaxFloor:    16,
+		MinFloor:    1,
+		MaxCapacity: 16,
+		Store:       st,
+		Clock:       c,
+		Stepped:     true,
+		ElevatorStatus: elevator.ElevatorStatus{
+			CurrentFloor:      1,
+			CurrentState:      elevator.STATE_IDLE,
+			WaitingPassengers: elevator.WaitingPassengers{Waiting: make([]*passenger.Passenger, 0)},
+			Passengers:        make([]*passenger.Passenger, 0),
+		},
+	}
+	e.Init()
+
+	return e
+}
+
+func TestPassengerTripIsRecorded(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	st.Init()
+
+	start := time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+
+	e := newSteppedElevator(st, fake)
+
+	api := newTestApi(t, st, nil)
+	api.Clock = fake
+
+	server := httptest.NewServer(api.Handler())
+	defer server.Close()
+
+	resp := postElevatorCall(t, server, passenger.Passenger{CurrentFloor: 1, DestinationFloor: 3})
+	var result util.SuccessResult
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+
+	trip, code := getPassenger(t, server, result.PassengerId)
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200 but got %d", code)
+	}
+
+	if trip.Id != result.PassengerId || trip.Elevator != "0-0" || !trip.CalledAt.Equal(start) || trip.State != passenger.STATE_WAITING {
+		t.Errorf("Expected passenger waiting for elevator 0-0 since %v but got %+v", start, trip)
+	}
+
+	// Open the doors, load, up 2 floors, unload.
+	for i := 0; i < 5; i++ {
+		e.Step()
+		fake.Advance(elevator.TICK_INTERVAL)
+	}
+
+	trip, _ = getPassenger(t, server, result.PassengerId)
+	if trip.State != passenger.STATE_DELIVERED || !trip.PickedUpAt.Equal(start.Add(time.Second)) || !trip.DroppedOffAt.Equal(start.Add(4*time.Second)) {
+		t.Errorf("Expected passenger picked up after 1s and dropped off after 4s but got %+v", trip)
+	}
+
+	if trip.WaitTime != 1 || trip.RideTime != 3 {
+		t.Errorf("Expected a 1s wait and a 3s ride but got %ds and %ds", trip.WaitTime, trip.RideTime)
+	}
+}
+
+func TestUnknownPassengerNotFound(t *testing.T) {
+	_, server := newTestSystem(t)
+	defer server.Close()
+
+	if _, code := getPassenger(t, server, "nobody"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 but got %d", code)
+	}
+}
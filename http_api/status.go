@@ -0,0 +1,206 @@
+package http_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/davepersing/elevator-platform/elevator"
+	"github.com/davepersing/elevator-platform/group"
+)
+
+type (
+	// An elevator's persisted state as returned by the status endpoints.
+	elevatorView struct {
+		*elevator.ElevatorStatus
+
+		State string `json:"state"` // Human-readable name of CurrentState.
+		Alive bool   `json:"alive"` // True while the elevator keeps its status alive in the store.
+	}
+
+	// A group and its elevators as returned by GET /groups/{group}.
+	groupView struct {
+		*group.Group
+
+		Elevators []*elevatorView `json:"elevators"`
+	}
+)
+
+// Handles GET /elevators.  Responds with every known elevator, ordered by group and id.
+func (ha *HttpApi) handleElevators(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	views, err := ha.loadElevators()
+	if err != nil {
+		fmt.Printf("Error loading elevators.  Error: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJson(w, views)
+}
+
+// Handles GET /elevators/{group}/{id}.  Responds with a single elevator.
+func (ha *HttpApi) handleElevator(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	ids, ok := parsePathIds(r.URL.Path, "/elevators/", 2)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	views, err := ha.loadElevators()
+	if err != nil {
+		fmt.Printf("Error loading elevators.  Error: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	for _, view := range views {
+		if view.GroupId == ids[0] && view.Id == ids[1] {
+			writeJson(w, view)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+// Handles GET /groups/{group}.  Responds with the group's configuration and its elevators.
+func (ha *HttpApi) handleGroup(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	ids, ok := parsePathIds(r.URL.Path, "/groups/", 1)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	views, err := ha.loadElevators()
+	if err != nil {
+		fmt.Printf("Error loading elevators.  Error: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	gv := groupView{Elevators: make([]*elevatorView, 0)}
+	for _, g := range ha.Groups {
+		if g.Id == ids[0] {
+			gv.Group = g
+		}
+	}
+
+	for _, view := range views {
+		if view.GroupId == ids[0] {
+			gv.Elevators = append(gv.Elevators, view)
+		}
+	}
+
+	if gv.Group == nil {
+		if len(gv.Elevators) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Not configured on this node.  Report what the elevators know.
+		gv.Group = &group.Group{Id: ids[0], ElevatorCount: len(gv.Elevators)}
+	}
+
+	writeJson(w, gv)
+}
+
+// Returns the persisted state of every elevator, ordered by group and id.
+// An elevator is alive if its status hasn't expired.
+func (ha *HttpApi) loadElevators() ([]*elevatorView, error) {
+	states, err := ha.Store.GetAllStates()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, err := ha.Store.GetAllStatuses()
+	if err != nil {
+		return nil, err
+	}
+
+	alive, err := decodeStatuses(statuses)
+	if err != nil {
+		fmt.Printf("Error decoding statuses from store.  Error: %v\n", err)
+	}
+
+	views := make([]*elevatorView, 0, len(states))
+	for _, data := range states {
+		es := &elevator.ElevatorStatus{}
+		if err := json.Unmarshal(data, es); err != nil {
+			// Skip states that can't be deciphered.
+			continue
+		}
+
+		_, ok := alive[es.GroupId][es.Id]
+		views = append(views, &elevatorView{ElevatorStatus: es, State: elevator.StateName(es.CurrentState), Alive: ok})
+	}
+
+	sort.Sort(byGroupAndId(views))
+	return views, nil
+}
+
+// Sorts elevator views by group, then by id.
+type byGroupAndId []*elevatorView
+
+func (v byGroupAndId) Len() int      { return len(v) }
+func (v byGroupAndId) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v byGroupAndId) Less(i, j int) bool {
+	if v[i].GroupId != v[j].GroupId {
+		return v[i].GroupId < v[j].GroupId
+	}
+	return v[i].Id < v[j].Id
+}
+
+// Parses the integer ids following prefix in a path.  e.g. /elevators/0/1
+// Returns false unless there are exactly count ids.
+func parsePathIds(path, prefix string, count int) ([]int, bool) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, prefix), "/"), "/")
+	if len(parts) != count {
+		return nil, false
+	}
+
+	ids := make([]int, count)
+	for i, part := range parts {
+		id, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, false
+		}
+		ids[i] = id
+	}
+
+	return ids, true
+}
+
+// Responds with 405 Method Not Allowed unless the request is a GET.
+func allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+// Responds with v encoded as JSON.
+func writeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Printf("Error sending response.  %v\n", err)
+	}
+}
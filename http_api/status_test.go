@@ -0,0 +1,154 @@
+package http_api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davepersing/elevator-platform/election"
+	"github.com/davepersing/elevator-platform/elevator"
+	"github.com/davepersing/elevator-platform/group"
+	"github.com/davepersing/elevator-platform/memory_store"
+	"github.com/davepersing/elevator-platform/store"
+)
+
+// The fields of the status endpoints' responses checked by these tests.
+type elevatorResponse struct {
+	Id      int    `json:"id"`
+	GroupId int    `json:"groupId"`
+	State   string `json:"state"`
+	Alive   bool   `json:"alive"`
+}
+
+// Runs a live elevator in group 0 and a dead one in group 1 that only left its state behind.
+func newStatusTestServer(t *testing.T) *httptest.Server {
+	st := &memory_store.MemoryStore{}
+	st.Init()
+
+	newTestElevator(st, 0, 0, 1, 16)
+
+	data, _ := json.Marshal(&elevator.ElevatorStatus{Id: 0, GroupId: 1, CurrentFloor: 7, CurrentState: elevator.STATE_MAINTENANCE})
+	st.SetStatus(store.Key(1, 0), data, -1)
+
+	groups := []*group.Group{{Id: 0, ElevatorCount: 1, MinFloor: 1, MaxFloor: 16}}
+	return httptest.NewServer(newTestApi(t, st, groups).Handler())
+}
+
+// Gets path and decodes the response into v.  Returns the status code.
+func getJson(t *testing.T, server *httptest.Server, path string, v interface{}) int {
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestGetElevators(t *testing.T) {
+	server := newStatusTestServer(t)
+	defer server.Close()
+
+	var elevators []elevatorResponse
+	if code := getJson(t, server, "/elevators", &elevators); code != http.StatusOK {
+		t.Fatalf("Expected 200 but got %d", code)
+	}
+
+	if len(elevators) != 2 {
+		t.Fatalf("Expected 2 elevators but got %d", len(elevators))
+	}
+
+	live, dead := elevators[0], elevators[1]
+	if live.GroupId != 0 || !live.Alive || live.State != "IDLE" {
+		t.Errorf("Expected live idle elevator 0-0 but got %+v", live)
+	}
+
+	if dead.GroupId != 1 || dead.Alive || dead.State != "MAINTENANCE" {
+		t.Errorf("Expected dead elevator 1-0 in maintenance but got %+v", dead)
+	}
+}
+
+func TestGetElevator(t *testing.T) {
+	server := newStatusTestServer(t)
+	defer server.Close()
+
+	var e elevatorResponse
+	if code := getJson(t, server, "/elevators/1/0", &e); code != http.StatusOK {
+		t.Fatalf("Expected 200 but got %d", code)
+	}
+
+	if e.GroupId != 1 || e.Id != 0 {
+		t.Errorf("Expected elevator 1-0 but got %+v", e)
+	}
+
+	for _, path := range []string{"/elevators/0/9", "/elevators/0", "/elevators/a/b"} {
+		if code := getJson(t, server, path, &e); code != http.StatusNotFound {
+			t.Errorf("Expected 404 for %s but got %d", path, code)
+		}
+	}
+}
+
+func TestGetGroup(t *testing.T) {
+	server := newStatusTestServer(t)
+	defer server.Close()
+
+	var g struct {
+		Id        int                `json:"id"`
+		MaxFloor  int                `json:"maxFloor"`
+		Elevators []elevatorResponse `json:"elevators"`
+	}
+	if code := getJson(t, server, "/groups/0", &g); code != http.StatusOK {
+		t.Fatalf("Expected 200 but got %d", code)
+	}
+
+	if g.Id != 0 || g.MaxFloor != 16 || len(g.Elevators) != 1 {
+		t.Errorf("Expected configured group 0 with 1 elevator but got %+v", g)
+	}
+
+	if code := getJson(t, server, "/groups/5", &g); code != http.StatusNotFound {
+		t.Errorf("Expected 404 but got %d", code)
+	}
+
+	resp, err := http.Post(server.URL+"/groups/0", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 but got %d", resp.StatusCode)
+	}
+}
+
+func TestGetLeader(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	st.Init()
+
+	if _, err := st.NewElection("a:8080").Campaign(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	api := newTestApi(t, st, nil)
+	api.Leadership = &election.Leadership{Id: "b:8081", Elector: st.NewElection("b:8081")}
+	server := httptest.NewServer(api.Handler())
+	defer server.Close()
+
+	var leader struct {
+		Leader   string `json:"leader"`
+		Id       string `json:"id"`
+		IsLeader bool   `json:"isLeader"`
+	}
+	if code := getJson(t, server, "/leader", &leader); code != http.StatusOK {
+		t.Fatalf("Expected 200 but got %d", code)
+	}
+
+	if leader.Leader != "a:8080" || leader.Id != "b:8081" || leader.IsLeader {
+		t.Errorf("Expected a:8080 to lead but got %+v", leader)
+	}
+}
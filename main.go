@@ -8,23 +8,39 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/davepersing/elevator-platform/door"
+	"github.com/davepersing/elevator-platform/election"
 	"github.com/davepersing/elevator-platform/elevator"
 	"github.com/davepersing/elevator-platform/elevator_service"
 	"github.com/davepersing/elevator-platform/etcd"
+	"github.com/davepersing/elevator-platform/group"
 	"github.com/davepersing/elevator-platform/http_api"
+	"github.com/davepersing/elevator-platform/memory_store"
+	"github.com/davepersing/elevator-platform/motion"
 	"github.com/davepersing/elevator-platform/passenger"
+	"github.com/davepersing/elevator-platform/reconciler"
+	"github.com/davepersing/elevator-platform/scheduler"
+	"github.com/davepersing/elevator-platform/store"
 	"github.com/davepersing/elevator-platform/util"
 )
 
 type StartupParams struct {
-	ElevatorGroups int    // Number of elevator groups to start with n elevators.
-	ElevatorCount  int    // Number of elevators to start up
-	MaxFloor       int    // The maximum floor the elevator is able to access.
-	MinFloor       int    // The minimum floor the elevator is able to access.
-	MaxCapacity    int    // The maximum number of persons allowed in an elevator at any given time.
-	EtcdUrl        string // The URL to the etcd cluster.
+	ElevatorGroups int                 // Number of elevator groups to start with n elevators.
+	ElevatorCount  int                 // Number of elevators to start up
+	MaxFloor       int                 // The maximum floor the elevator is able to access.
+	MinFloor       int                 // The minimum floor the elevator is able to access.
+	MaxCapacity    int                 // The maximum number of persons allowed in an elevator at any given time.
+	EtcdUrl        string              // The URL to the etcd cluster.
+	EtcdPrefix     string              // The root all etcd keys are nested under.
+	StoreType      string              // The backing data store.  Either etcd or memory.
+	Scheduler      scheduler.Scheduler // The dispatch strategy used by every HttpApi.
+	DoorTimings    door.Timings        // How long the doors of every elevator take to open, dwell and close.
+	Motion         motion.Profile      // How every elevator moves between floors.
+	Groups         []*group.Group      // The elevator groups to start.
+	ParkingFloor   *int                // The floor elevators park at before maintenance.  nil parks at each group's bottom floor.
 }
 
 // 1.  `-groups=1` - Specifies the number of elevator groups to create.
@@ -32,9 +48,34 @@ type StartupParams struct {
 // 3.  `-capacity=16` - Specifies the maximum capacity of an elevator in persons.
 // 4.  `-bottom-floor=1` - Specifies the bottom floor the elevator is allowed to access.
 // 5.  `-top-floor=16` - Specifies the top floor the elevator is allowed to access.
+// 6.  `-scheduler=nearest` - Specifies the dispatch strategy used to assign passengers.
+// 7.  `-store=etcd` - Specifies the backing data store.  `memory` runs without an etcd cluster.
+// 8.  `-etcd-prefix=` - Specifies the root all etcd keys are nested under.
+// 9.  `-group-spec=4:1-20,4:1-40` - Specifies each group as elevators:bottom-top[:port].  Overrides flags 1, 2, 4 and 5.
+// 10. `-port=8080` - Specifies the first HTTP port.  Group g listens on ports starting at port + 100 * g.
+// 11. `-skip-floors=13` - Specifies floors no elevator stops at.
+// 12. `-floor-travel-time=1s` - Specifies the time an elevator takes to travel one floor, used to estimate arrival times.
+// 13. `-dwell-time=1s` - Specifies the time an elevator spends stopped at a floor, used to estimate arrival times.
+// 14. `-door-open-time=0s`, `-door-dwell-time=0s`, `-door-close-time=0s` - Specify how long the doors take to open, stay open, and close.
+// 15. `-speed=0`, `-acceleration=0`, `-deceleration=0`, `-floor-height=3` - Specify the motion of the elevators in meters and seconds.  Elevators move one floor per second without a speed and acceleration.
+// 16. `-parking-floor=1` - Specifies the floor elevators park at before maintenance.  Defaults to each group's bottom floor.
 
 // Starts the application.
+// `elevator-platform simulate [flags]` runs the simulator instead.  See runSimulation.
+// `elevator-platform traffic [flags]` sends generated traffic to a running cluster.  See runTraffic.
+// `elevator-platform replay [flags] calls.jsonl` sends recorded calls to a running cluster.  See runReplay.
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "simulate":
+			os.Exit(runSimulation(os.Args[2:]))
+		case "traffic":
+			os.Exit(runTraffic(os.Args[2:]))
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		}
+	}
+
 	initHTTPDefaults()
 
 	fmt.Println("Enter 'new' to add a new passenger, 'maint' to set an elevator to maintenance mode, or 'exit' to leave.")
@@ -45,9 +86,61 @@ func main() {
 	var topFloor = flag.Int("top-floor", 16, "The top floor the elevator can access.")
 	var maxCapacity = flag.Int("capacity", 16, "The maximum number of persons an elevator can carry at one time.")
 	var etcdUrl = flag.String("etcd-url", "http://localhost:2379", "The url to the etcd cluster.  e.g. http://localhost:2379")
+	var etcdPrefix = flag.String("etcd-prefix", "", "The root all etcd keys are nested under.  e.g. /building-a")
+	var groupSpec = flag.String("group-spec", "", "Each group as elevators:bottom-top[:port], separated by commas.  e.g. 4:1-20,4:1-40")
+	var skipFloors = flag.String("skip-floors", "", "Floors no elevator stops at, separated by commas.  e.g. 13")
+	var basePort = flag.Int("port", 8080, "The first HTTP port.  Group g listens on ports starting at port + 100 * g.")
+	var storeType = flag.String("store", "etcd", "The backing data store.  Either etcd, or memory to run without an etcd cluster.")
+	var schedulerName = flag.String("scheduler", scheduler.DEFAULT_SCHEDULER,
+		"The dispatch strategy used to assign passengers.  One of: "+strings.Join(scheduler.Names(), ", "))
+	var floorTravelTime = flag.Duration("floor-travel-time", scheduler.DEFAULT_FLOOR_TRAVEL_TIME,
+		"The time an elevator takes to travel one floor.  Used to estimate arrival times.")
+	var dwellTime = flag.Duration("dwell-time", scheduler.DEFAULT_DWELL_TIME,
+		"The time an elevator spends stopped at a floor.  Used to estimate arrival times.")
+	var doorOpenTime = flag.Duration("door-open-time", 0, "The time the doors take to open.")
+	var doorDwellTime = flag.Duration("door-dwell-time", 0, "The time the doors stay open before closing.")
+	var doorCloseTime = flag.Duration("door-close-time", 0, "The time the doors take to close.")
+	var speed = flag.Float64("speed", 0, "The rated speed of the elevators in meters per second.  0 moves one floor per second.")
+	var acceleration = flag.Float64("acceleration", 0, "The acceleration of the elevators in meters per second squared.")
+	var deceleration = flag.Float64("deceleration", 0, "The deceleration of the elevators in meters per second squared.  Defaults to the acceleration.")
+	var floorHeight = flag.Float64("floor-height", 3, "The height of each floor in meters.")
+	var parkingFloor = flag.Int("parking-floor", 0, "The floor elevators park at before maintenance.  Defaults to each group's bottom floor.")
 
 	flag.Parse()
 
+	profile := motion.Profile{Speed: *speed, Acceleration: *acceleration, Deceleration: *deceleration, FloorHeight: *floorHeight}
+	if profile.Enabled() && !flagSet(flag.CommandLine, "floor-travel-time") {
+		// Estimate arrival times from the time to cross a floor at rated speed.
+		*floorTravelTime = time.Duration(*floorHeight / *speed * float64(time.Second))
+	}
+
+	sched, err := scheduler.New(*schedulerName, scheduler.Options{FloorTravelTime: *floorTravelTime, DwellTime: *dwellTime})
+	if err != nil {
+		fmt.Printf("Cannot start elevators.  Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	var groups []*group.Group
+	if *groupSpec != "" {
+		groups, err = group.Parse(*groupSpec, *basePort)
+	} else {
+		groups, err = group.Uniform(*groupCount, *elevatorCount, *bottomFloor, *topFloor, *basePort)
+	}
+	if err != nil {
+		fmt.Printf("Cannot start elevators.  Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	skip, err := group.ParseFloors(*skipFloors)
+	if err != nil {
+		fmt.Printf("Cannot start elevators.  Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	for _, g := range groups {
+		g.ServedFloors.Skip = skip
+	}
+
 	startupParams := StartupParams{
 		ElevatorGroups: *groupCount,
 		ElevatorCount:  *elevatorCount,
@@ -55,9 +148,25 @@ func main() {
 		MinFloor:       *bottomFloor,
 		MaxCapacity:    *maxCapacity,
 		EtcdUrl:        *etcdUrl,
+		EtcdPrefix:     *etcdPrefix,
+		StoreType:      *storeType,
+		Scheduler:      sched,
+		DoorTimings:    door.Timings{OpenTime: *doorOpenTime, DwellTime: *doorDwellTime, CloseTime: *doorCloseTime},
+		Motion:         profile,
+		Groups:         groups,
+	}
+
+	if flagSet(flag.CommandLine, "parking-floor") {
+		startupParams.ParkingFloor = parkingFloor
 	}
 
-	knownNodes := startupParams.initElevators()
+	st, err := startupParams.newStore()
+	if err != nil {
+		fmt.Printf("Cannot start elevators.  Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	knownNodes := startupParams.initElevators(st)
 
 	// Init the scheduler in a goroutine.
 	scanner := bufio.NewScanner(os.Stdin)
@@ -80,7 +189,7 @@ func main() {
 
 func (s *StartupParams) processMaintenance(knownNodes map[int]string) {
 	fmt.Println("Enter the group number for the elevator: ")
-	groupId, err := s.getElevatorMaintenanceInput()
+	g, err := s.getGroupInput()
 	if err != nil {
 		fmt.Printf("Error processing groupId: %s\n", err.Error())
 		return
@@ -88,7 +197,7 @@ func (s *StartupParams) processMaintenance(knownNodes map[int]string) {
 
 	// This is very poor UX.  Identify the elevator by it's named ID.
 	fmt.Println("Enter the elevator ID (0 indexed): ")
-	elevatorId, err := s.getElevatorMaintenanceInput()
+	elevatorId, err := s.getElevatorMaintenanceInput(g)
 	if err != nil {
 		fmt.Printf("Error processing elevatorId: %s\n", err.Error())
 		return
@@ -102,13 +211,13 @@ func (s *StartupParams) processMaintenance(knownNodes map[int]string) {
 
 	randomIndex := util.GetRandomIndex(len(knownNodes) - 1)
 	port := knownNodes[randomIndex]
-	_, _, err = util.SendMaintenancePost(port, elevatorId, groupId, maintMode)
+	_, _, err = util.SendMaintenancePost(port, elevatorId, g.Id, maintMode)
 	if err != nil {
 		fmt.Printf("Could not send maintenance request.  Error: %s\n", err.Error())
 		return
 	}
 
-	fmt.Printf("Elevator %d-%d set to maintenance mode: %s\n", groupId, elevatorId, strconv.FormatBool(maintMode))
+	fmt.Printf("Elevator %d-%d set to maintenance mode: %s\n", g.Id, elevatorId, strconv.FormatBool(maintMode))
 }
 
 // Processes a new passenger from user input.
@@ -140,13 +249,13 @@ func (s *StartupParams) processNewPassenger(knownNodes map[int]string) {
 	// This is "load balancing".  Could implement round-robin, but this will do for now.
 	randomIndex := util.GetRandomIndex(len(knownNodes) - 1)
 	port := knownNodes[randomIndex]
-	elevatorId, groupId, err := util.SendPassengerPost(port, currFloor, destFloor)
+	result, err := util.SendPassengerPost(port, currFloor, destFloor)
 	if err != nil {
 		fmt.Printf("Could not send request.  Error: %s\n", err.Error())
 		return
 	}
 
-	fmt.Printf("Take Elevator %s-%s\n", groupId, elevatorId)
+	fmt.Printf("Take Elevator %s-%s, arriving in ~%ds.\n", result.GroupId, result.ElevatorId, result.EstimatedPickup)
 }
 
 // Gets the passenger input from Stdin
@@ -158,12 +267,14 @@ func (s *StartupParams) getFloorInput() (int, error) {
 			return -1, err
 		}
 
-		if parsed <= 0 {
-			return -1, errors.New("Floor must be greater than 0!")
+		bottomFloor, topFloor := s.floorRange()
+
+		if parsed < bottomFloor {
+			return -1, errors.New("Floor is too low!  The bottom floor is " + strconv.Itoa(bottomFloor))
 		}
 
-		if parsed > s.MaxFloor {
-			return -1, errors.New("Floor is too high!  The top floor is " + strconv.Itoa(s.MaxFloor))
+		if parsed > topFloor {
+			return -1, errors.New("Floor is too high!  The top floor is " + strconv.Itoa(topFloor))
 		}
 
 		return parsed, nil
@@ -171,8 +282,41 @@ func (s *StartupParams) getFloorInput() (int, error) {
 	return -1, nil
 }
 
-// This should be refactored to be more generic.
-func (s *StartupParams) getElevatorMaintenanceInput() (int, error) {
+// Returns the lowest and highest floors served by any group.
+func (s *StartupParams) floorRange() (int, int) {
+	bottomFloor, topFloor := s.MinFloor, s.MaxFloor
+	for i, g := range s.Groups {
+		if i == 0 || g.MinFloor < bottomFloor {
+			bottomFloor = g.MinFloor
+		}
+		if i == 0 || g.MaxFloor > topFloor {
+			topFloor = g.MaxFloor
+		}
+	}
+	return bottomFloor, topFloor
+}
+
+// Gets an existing group from Stdin.
+func (s *StartupParams) getGroupInput() (*group.Group, error) {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		parsed, err := strconv.Atoi(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+
+		if parsed < 0 || parsed >= len(s.Groups) {
+			return nil, errors.New("Group does not exist.")
+		}
+
+		return s.Groups[parsed], nil
+	}
+
+	return nil, errors.New("No group entered.")
+}
+
+// Gets the id of an elevator in the group from Stdin.
+func (s *StartupParams) getElevatorMaintenanceInput(g *group.Group) (int, error) {
 	scanner := bufio.NewScanner(os.Stdin)
 	for scanner.Scan() {
 		parsed, err := strconv.Atoi(scanner.Text())
@@ -184,7 +328,7 @@ func (s *StartupParams) getElevatorMaintenanceInput() (int, error) {
 			return -1, errors.New("Must enter a positive elevator id.")
 		}
 
-		if parsed > s.ElevatorCount {
+		if parsed >= g.ElevatorCount {
 			return -1, errors.New("Elevator does not exist.")
 		}
 
@@ -208,51 +352,110 @@ func (s *StartupParams) getElevatorMaintenanceMode() (bool, error) {
 	return false, nil
 }
 
-// Initializes the elevators.
-func (s StartupParams) initElevators() map[int]string {
+// Creates the backing data store shared by every elevator service in this process.
+func (s StartupParams) newStore() (store.Store, error) {
+	switch s.StoreType {
+	case "etcd":
+		return &etcd.Etcd{Url: s.EtcdUrl, Keys: etcd.NewKeyLayout(s.EtcdPrefix)}, nil
+	case "memory":
+		return &memory_store.MemoryStore{}, nil
+	}
 
-	// TODO:  Create elevator Groups.
-	//
-	// Generate the cluster info based on the number of elevators.
+	return nil, errors.New("Unknown store: " + s.StoreType)
+}
+
+// Initializes the elevators in every group.
+// Returns the ports of every HttpApi.  Any of them can schedule a call for any group.
+func (s StartupParams) initElevators(st store.Store) map[int]string {
+
+	// Generate the cluster info based on the groups and the number of elevators in each.
 	knownNodes := make(map[int]string)
 	services := make(map[int]*elevator_service.ElevatorService)
 
-	for i := 0; i < s.ElevatorCount; i++ {
-		knownNodes[i] = ":" + strconv.Itoa(8080+i)
-
-		es := &elevator_service.ElevatorService{
-			HttpApi: &http_api.HttpApi{
-				Hostname: "",
-				Port:     knownNodes[i],
-				Etcd:     &etcd.Etcd{Url: s.EtcdUrl}, // Shouldn't have to pass mulitple refs around.
-			},
-			Elevator: &elevator.Elevator{
-				MaxFloor:    s.MaxFloor,
-				MinFloor:    s.MinFloor,
-				MaxCapacity: s.MaxCapacity,
-				Etcd:        &etcd.Etcd{Url: s.EtcdUrl},
-				ElevatorStatus: elevator.ElevatorStatus{
-					DisplayId:         i + 1,
-					GroupId:           0, // This is zero because only dealing with a single bank
-					Id:                i, // Make this not 0-based.
-					CurrentFloor:      s.MinFloor,
-					CurrentState:      elevator.STATE_IDLE,
-					WaitingPassengers: elevator.WaitingPassengers{Waiting: make([]*passenger.Passenger, 0)},
-					Passengers:        make([]*passenger.Passenger, 0),
-				},
-			},
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	for _, g := range s.Groups {
+		parkingFloor := g.MinFloor
+		if s.ParkingFloor != nil {
+			parkingFloor = *s.ParkingFloor
 		}
-		es.Init()
 
-		services[i] = es
+		for i := 0; i < g.ElevatorCount; i++ {
+			node := len(knownNodes)
+			knownNodes[node] = g.Port(i)
+
+			es := &elevator_service.ElevatorService{
+				HttpApi: &http_api.HttpApi{
+					Hostname:  "",
+					Port:      knownNodes[node],
+					Store:     st,
+					Scheduler: s.Scheduler,
+					Groups:    s.Groups,
+				},
+				Elevator: &elevator.Elevator{
+					MaxFloor:     g.MaxFloor,
+					MinFloor:     g.MinFloor,
+					MaxCapacity:  s.MaxCapacity,
+					Doors:        door.Door{Timings: s.DoorTimings},
+					Motion:       s.Motion,
+					Store:        st,
+					ParkingFloor: parkingFloor,
+					ElevatorStatus: elevator.ElevatorStatus{
+						ServedFloors:      g.ServedFloors,
+						DisplayId:         i + 1,
+						GroupId:           g.Id,
+						Id:                i, // Make this not 0-based.
+						CurrentFloor:      g.MinFloor,
+						CurrentState:      elevator.STATE_IDLE,
+						WaitingPassengers: elevator.WaitingPassengers{Waiting: make([]*passenger.Passenger, 0)},
+						Passengers:        make([]*passenger.Passenger, 0),
+					},
+				},
+			}
+			// Every service campaigns for leader.  Only the leader moves calls off elevators that went down.
+			if elector := newElection(st, hostname+knownNodes[node]); elector != nil {
+				es.HttpApi.Leadership = &election.Leadership{Id: hostname + knownNodes[node], Elector: elector}
+				es.HttpApi.Leadership.Register((&reconciler.Reconciler{Store: st, Dispatcher: es.HttpApi}).Run)
+			}
+
+			es.Init()
+
+			services[node] = es
+		}
 	}
 
 	return knownNodes
 }
 
+// Returns the leader election among the nodes sharing the store, campaigning as id.
+// Returns nil if the store can't elect a leader.
+func newElection(st store.Store, id string) election.Elector {
+	switch s := st.(type) {
+	case *etcd.Etcd:
+		return s.NewElection(id)
+	case *memory_store.MemoryStore:
+		return s.NewElection(id)
+	}
+	return nil
+}
+
 // Initializes default parameters for HTTP requests using http.DefaultClient.
 func initHTTPDefaults() {
 	http.DefaultClient = &http.Client{
 		Timeout: 100 * time.Millisecond,
 	}
 }
+
+// Returns true if the named flag was given on the command line of the flag set.
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
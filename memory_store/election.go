@@ -0,0 +1,63 @@
+package memory_store
+
+import "github.com/davepersing/elevator-platform/election"
+
+// Elects a leader among the nodes sharing the store.  Implements election.Elector.
+type Election struct {
+	store *MemoryStore
+	id    string
+}
+
+// Returns an election of the nodes sharing the store, campaigning as id.
+func (m *MemoryStore) NewElection(id string) *Election {
+	return &Election{store: m, id: id}
+}
+
+// Blocks until the node is the leader, or stop is closed.
+// Returns a channel that is closed when the node resigns.
+func (el *Election) Campaign(stop <-chan struct{}) (<-chan struct{}, error) {
+	m := el.store
+	for {
+		m.mu.Lock()
+		if m.leader == "" {
+			m.leader = el.id
+			m.leaderLost = make(chan struct{})
+		}
+
+		lost := m.leaderLost
+		leading := m.leader == el.id
+		m.mu.Unlock()
+
+		if leading {
+			return lost, nil
+		}
+
+		// Wait for the current leader to resign.
+		select {
+		case <-lost:
+		case <-stop:
+			return nil, election.ErrStopped
+		}
+	}
+}
+
+// Gives up leadership, if the node has it.
+func (el *Election) Resign() error {
+	m := el.store
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.leader == el.id {
+		m.leader = ""
+		close(m.leaderLost)
+	}
+	return nil
+}
+
+// Returns the id of the current leader, or "" if there is none.
+func (el *Election) Leader() (string, error) {
+	el.store.mu.Lock()
+	defer el.store.mu.Unlock()
+
+	return el.store.leader, nil
+}
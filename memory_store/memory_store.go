@@ -0,0 +1,341 @@
+package memory_store
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/davepersing/elevator-platform/clock"
+	"github.com/davepersing/elevator-platform/store"
+)
+
+// How often expired statuses are removed and their watchers notified.
+const EXPIRY_INTERVAL = 500 * time.Millisecond
+
+type (
+	// An in-process store.Store.  Lets the whole system run without an etcd cluster.
+	// Watchers are notified synchronously, in order, from the goroutine that made the change.
+	// A single MemoryStore should be shared by every elevator and HttpApi in the process.
+	MemoryStore struct {
+		Clock clock.Clock // Expires statuses and passenger records.  Defaults to the system clock.
+
+		mu sync.Mutex
+
+		// Held while notifying watchers so notifications are delivered in order.
+		statusMu      sync.Mutex
+		callsMu       sync.Mutex
+		maintenanceMu sync.Mutex
+
+		states      map[string][]byte
+		statuses    map[string]*status
+		queues      map[string][]*store.Call
+		maintenance map[string]string
+		passengers  map[string]*status
+		assignments map[string]*store.Versioned
+
+		statusWatchers      []func(string, []byte)
+		callWatchers        map[string][]func(*store.Call)
+		maintenanceWatchers map[string][]func(string)
+
+		index uint64 // Incremented for every queued call.
+
+		leader     string        // Id of the node elected leader.
+		leaderLost chan struct{} // Closed when the leader resigns.
+	}
+
+	// A status or passenger record with the time it expires.
+	status struct {
+		data    []byte
+		expires time.Time
+	}
+)
+
+// Initializes the store.  Safe to call more than once.
+func (m *MemoryStore) Init() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.states == nil {
+		m.states = make(map[string][]byte)
+		m.statuses = make(map[string]*status)
+		m.queues = make(map[string][]*store.Call)
+		m.maintenance = make(map[string]string)
+		m.passengers = make(map[string]*status)
+		m.assignments = make(map[string]*store.Versioned)
+		m.callWatchers = make(map[string][]func(*store.Call))
+		m.maintenanceWatchers = make(map[string][]func(string))
+
+		// Ask for the ticks now, so a fake clock advanced straight after Init still expires statuses.
+		ticks := m.clock().Tick(EXPIRY_INTERVAL)
+		go func() {
+			for range ticks {
+				m.expireStatuses()
+			}
+		}()
+	}
+	return nil
+}
+
+// Returns the store's clock.
+func (m *MemoryStore) clock() clock.Clock {
+	if m.Clock == nil {
+		return clock.Real{}
+	}
+	return m.Clock
+}
+
+// Returns the current time on the store's clock.
+func (m *MemoryStore) now() time.Time {
+	return m.clock().Now()
+}
+
+// Returns the persisted state of an elevator, or nil if none has been saved.
+func (m *MemoryStore) GetState(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.states[key], nil
+}
+
+// Saves the state and the status of an elevator and notifies status watchers.  The status expires after ttl.
+func (m *MemoryStore) SetStatus(key string, data []byte, ttl time.Duration) error {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+
+	m.mu.Lock()
+	m.states[key] = data
+	m.statuses[key] = &status{data: data, expires: m.now().Add(ttl)}
+	watchers := m.statusWatchers
+	m.mu.Unlock()
+
+	for _, fn := range watchers {
+		fn(key, data)
+	}
+	return nil
+}
+
+// Returns the statuses of all elevators that haven't expired.
+func (m *MemoryStore) GetAllStatuses() ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	statuses := make([][]byte, 0, len(m.statuses))
+	for _, s := range m.statuses {
+		// Expired statuses are left for expireStatuses to remove, so their watchers are told.
+		if now.After(s.expires) {
+			continue
+		}
+		statuses = append(statuses, s.data)
+	}
+
+	return statuses, nil
+}
+
+// Removes the statuses that have expired and notifies status watchers of each with nil data.
+func (m *MemoryStore) expireStatuses() {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+
+	m.mu.Lock()
+	now := m.now()
+	var expired []string
+	for key, s := range m.statuses {
+		if now.After(s.expires) {
+			delete(m.statuses, key)
+			expired = append(expired, key)
+		}
+	}
+	watchers := m.statusWatchers
+	m.mu.Unlock()
+
+	sort.Strings(expired)
+	for _, key := range expired {
+		for _, fn := range watchers {
+			fn(key, nil)
+		}
+	}
+}
+
+// Delivers the status of every live elevator and registers fn for statuses saved after.
+// fn is called with nil data when a status expires, within EXPIRY_INTERVAL on the store's clock.
+func (m *MemoryStore) WatchStatuses(fn func(key string, data []byte), state func(string)) {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+
+	m.mu.Lock()
+	now := m.now()
+	live := make(map[string][]byte)
+	for key, s := range m.statuses {
+		if !now.After(s.expires) {
+			live[key] = s.data
+		}
+	}
+	m.statusWatchers = append(m.statusWatchers, fn)
+	m.mu.Unlock()
+
+	state(store.WATCHER_CONNECTED)
+	for key, data := range live {
+		fn(key, data)
+	}
+}
+
+// Returns the persisted states of all elevators.
+func (m *MemoryStore) GetAllStates() ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	states := make([][]byte, 0, len(m.states))
+	for _, data := range m.states {
+		states = append(states, data)
+	}
+
+	return states, nil
+}
+
+// Appends a call to an elevator's waiting queue and notifies its watchers.
+// Returns the id of the queued call.
+func (m *MemoryStore) EnqueueCall(key string, data []byte) (string, error) {
+	m.callsMu.Lock()
+	defer m.callsMu.Unlock()
+
+	m.mu.Lock()
+	m.index++
+	c := &store.Call{Id: key + "/" + strconv.FormatUint(m.index, 10), Index: m.index, Data: data}
+	m.queues[key] = append(m.queues[key], c)
+	watchers := m.callWatchers[key]
+	m.mu.Unlock()
+
+	for _, fn := range watchers {
+		fn(c)
+	}
+	return c.Id, nil
+}
+
+// Removes a call from an elevator's waiting queue.
+func (m *MemoryStore) AckCall(key string, c *store.Call) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queue := m.queues[key]
+	for i, queued := range queue {
+		if queued.Id == c.Id {
+			m.queues[key] = append(queue[:i:i], queue[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Returns the calls still in an elevator's waiting queue.
+func (m *MemoryStore) PendingCalls(key string) ([]*store.Call, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*store.Call(nil), m.queues[key]...), nil
+}
+
+// Delivers every call already in an elevator's waiting queue and registers fn for new calls.
+func (m *MemoryStore) WatchCalls(key string, fn func(*store.Call), state func(string)) {
+	m.callsMu.Lock()
+	defer m.callsMu.Unlock()
+
+	m.mu.Lock()
+	pending := append([]*store.Call(nil), m.queues[key]...)
+	m.callWatchers[key] = append(m.callWatchers[key], fn)
+	m.mu.Unlock()
+
+	state(store.WATCHER_CONNECTED)
+	for _, c := range pending {
+		fn(c)
+	}
+}
+
+// Sets the maintenance mode of an elevator and notifies its watchers.
+func (m *MemoryStore) SetMaintenanceMode(key string, mode string) error {
+	m.maintenanceMu.Lock()
+	defer m.maintenanceMu.Unlock()
+
+	m.mu.Lock()
+	m.maintenance[key] = mode
+	watchers := m.maintenanceWatchers[key]
+	m.mu.Unlock()
+
+	for _, fn := range watchers {
+		fn(mode)
+	}
+	return nil
+}
+
+// Delivers the current maintenance mode of an elevator, if set, and registers fn for changes.
+func (m *MemoryStore) WatchMaintenance(key string, fn func(string), state func(string)) {
+	m.maintenanceMu.Lock()
+	defer m.maintenanceMu.Unlock()
+
+	m.mu.Lock()
+	mode, ok := m.maintenance[key]
+	m.maintenanceWatchers[key] = append(m.maintenanceWatchers[key], fn)
+	m.mu.Unlock()
+
+	state(store.WATCHER_CONNECTED)
+	if ok {
+		fn(mode)
+	}
+}
+
+// Saves the record of a passenger's trip.  The record expires after ttl.
+func (m *MemoryStore) SavePassenger(id string, data []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.passengers[id] = &status{data: data, expires: m.now().Add(ttl)}
+	return nil
+}
+
+// Returns the record of a passenger's trip, or nil if there is none or it has expired.
+func (m *MemoryStore) GetPassenger(id string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.passengers[id]
+	if !ok {
+		return nil, nil
+	}
+
+	if m.now().After(record.expires) {
+		delete(m.passengers, id)
+		return nil, nil
+	}
+	return record.data, nil
+}
+
+// Returns the assignment record of every elevator that has one.
+func (m *MemoryStore) GetAssignments() (map[string]*store.Versioned, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	assignments := make(map[string]*store.Versioned, len(m.assignments))
+	for key, a := range m.assignments {
+		assignments[key] = &store.Versioned{Data: a.Data, Version: a.Version}
+	}
+	return assignments, nil
+}
+
+// Replaces an elevator's assignment record if it is still at version.
+func (m *MemoryStore) SwapAssignment(key string, data []byte, version int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var current int64
+	if a, ok := m.assignments[key]; ok {
+		current = a.Version
+	}
+
+	if current != version {
+		return false, nil
+	}
+
+	m.assignments[key] = &store.Versioned{Data: data, Version: current + 1}
+	return true, nil
+}
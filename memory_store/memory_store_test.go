@@ -0,0 +1,223 @@
+package memory_store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davepersing/elevator-platform/clock"
+	"github.com/davepersing/elevator-platform/memory_store"
+	"github.com/davepersing/elevator-platform/store"
+)
+
+func newStore() *memory_store.MemoryStore {
+	m := &memory_store.MemoryStore{}
+	m.Init()
+	return m
+}
+
+func TestStatusExpires(t *testing.T) {
+	m := newStore()
+
+	m.SetStatus("0-0", []byte(`{"id":0}`), time.Hour)
+	m.SetStatus("0-1", []byte(`{"id":1}`), -time.Second)
+
+	statuses, _ := m.GetAllStatuses()
+	if len(statuses) != 1 || string(statuses[0]) != `{"id":0}` {
+		t.Errorf("Expected only the live status but got %s", statuses)
+	}
+
+	// The persisted state outlives the status.
+	if state, _ := m.GetState("0-1"); string(state) != `{"id":1}` {
+		t.Errorf("Expected persisted state for 0-1 but got %s", state)
+	}
+}
+
+func TestStatusesAndRecordsExpireOnTheStoreClock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC))
+	m := &memory_store.MemoryStore{Clock: fake}
+	m.Init()
+
+	m.SetStatus("0-0", []byte(`{"id":0}`), time.Minute)
+	m.SavePassenger("rider", []byte(`{"id":"rider"}`), time.Hour)
+
+	fake.Advance(time.Minute + time.Second)
+	if statuses, _ := m.GetAllStatuses(); len(statuses) != 0 {
+		t.Errorf("Expected the status expired on the fake clock but got %s", statuses)
+	}
+
+	if data, _ := m.GetPassenger("rider"); data == nil {
+		t.Errorf("Expected the record kept until it is an hour old")
+	}
+
+	fake.Advance(time.Hour)
+	if data, _ := m.GetPassenger("rider"); data != nil {
+		t.Errorf("Expected the record expired on the fake clock but got %s", data)
+	}
+}
+
+func TestExpiredStatusesAreDeliveredAsNil(t *testing.T) {
+	fake := clock.NewFake(time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC))
+	m := &memory_store.MemoryStore{Clock: fake}
+	m.Init()
+
+	expired := make(chan string, 1)
+	m.WatchStatuses(func(key string, data []byte) {
+		if data == nil {
+			expired <- key
+		}
+	}, func(string) {})
+
+	m.SetStatus("0-0", []byte(`{"id":0}`), time.Second)
+	m.SetStatus("0-1", []byte(`{"id":1}`), time.Hour)
+
+	fake.Advance(time.Second + memory_store.EXPIRY_INTERVAL)
+
+	select {
+	case key := <-expired:
+		if key != "0-0" {
+			t.Errorf("Expected 0-0 to expire but got %s", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the watcher to hear 0-0 expire")
+	}
+
+	if statuses, _ := m.GetAllStatuses(); len(statuses) != 1 {
+		t.Errorf("Expected only 0-1 left but got %s", statuses)
+	}
+}
+
+func TestWatchStatusesDeliversLiveThenNewStatuses(t *testing.T) {
+	m := newStore()
+	m.SetStatus("0-0", []byte(`{"id":0}`), time.Hour)
+	m.SetStatus("0-1", []byte(`{"id":1}`), -time.Second)
+
+	var delivered []string
+	m.WatchStatuses(func(key string, data []byte) {
+		delivered = append(delivered, key+" "+string(data))
+	}, func(string) {})
+
+	m.SetStatus("0-1", []byte(`{"id":1,"currentFloor":2}`), time.Hour)
+
+	if len(delivered) != 2 || delivered[0] != `0-0 {"id":0}` || delivered[1] != `0-1 {"id":1,"currentFloor":2}` {
+		t.Errorf("Expected the live status then the new one but got %v", delivered)
+	}
+}
+
+func TestWatchCallsDeliversPendingThenNewCalls(t *testing.T) {
+	m := newStore()
+	m.EnqueueCall("0-0", []byte("first"))
+	m.EnqueueCall("0-1", []byte("other elevator"))
+
+	var delivered []*store.Call
+	m.WatchCalls("0-0", func(c *store.Call) {
+		delivered = append(delivered, c)
+	}, func(string) {})
+
+	m.EnqueueCall("0-0", []byte("second"))
+
+	if len(delivered) != 2 {
+		t.Fatalf("Expected 2 calls but got %d", len(delivered))
+	}
+
+	if string(delivered[0].Data) != "first" || string(delivered[1].Data) != "second" {
+		t.Errorf("Calls delivered out of order: %s, %s", delivered[0].Data, delivered[1].Data)
+	}
+
+	if delivered[1].Index <= delivered[0].Index {
+		t.Errorf("Expected increasing indexes but got %d then %d", delivered[0].Index, delivered[1].Index)
+	}
+}
+
+func TestAckedCallsAreNotRedelivered(t *testing.T) {
+	m := newStore()
+	m.EnqueueCall("0-0", []byte("first"))
+	m.EnqueueCall("0-0", []byte("second"))
+
+	m.WatchCalls("0-0", func(c *store.Call) {
+		if string(c.Data) == "first" {
+			m.AckCall("0-0", c)
+		}
+	}, func(string) {})
+
+	count := 0
+	m.WatchCalls("0-0", func(c *store.Call) {
+		count++
+	}, func(string) {})
+
+	if count != 1 {
+		t.Errorf("Expected 1 unacknowledged call but got %d", count)
+	}
+}
+
+func TestAckRemovesOnlyTheAcknowledgedCall(t *testing.T) {
+	m := newStore()
+	m.EnqueueCall("0-0", []byte("first"))
+	secondId, _ := m.EnqueueCall("0-0", []byte("second"))
+	m.EnqueueCall("0-0", []byte("third"))
+
+	m.AckCall("0-0", &store.Call{Id: secondId})
+	m.AckCall("0-0", &store.Call{Id: "0-0/unknown"})
+	m.AckCall("0-1", &store.Call{Id: secondId})
+
+	pending, _ := m.PendingCalls("0-0")
+	if len(pending) != 2 || string(pending[0].Data) != "first" || string(pending[1].Data) != "third" {
+		t.Errorf("Expected [first third] left in order but got %d calls", len(pending))
+	}
+}
+
+func TestUnackedCallsAreRedeliveredInOrder(t *testing.T) {
+	m := newStore()
+	m.EnqueueCall("0-0", []byte("first"))
+	m.EnqueueCall("0-0", []byte("second"))
+
+	// The first watcher goes away without acknowledging anything, like an elevator that crashed.
+	var first []*store.Call
+	m.WatchCalls("0-0", func(c *store.Call) {
+		first = append(first, c)
+	}, func(string) {})
+
+	var again []*store.Call
+	m.WatchCalls("0-0", func(c *store.Call) {
+		again = append(again, c)
+	}, func(string) {})
+
+	if len(again) != 2 {
+		t.Fatalf("Expected both calls redelivered but got %d", len(again))
+	}
+
+	for i := range again {
+		if again[i].Id != first[i].Id || again[i].Index != first[i].Index {
+			t.Errorf("Call %d redelivered as %s at %d but was first %s at %d",
+				i, again[i].Id, again[i].Index, first[i].Id, first[i].Index)
+		}
+	}
+}
+
+func TestCallIndexesIncreaseAcrossElevators(t *testing.T) {
+	m := newStore()
+	m.EnqueueCall("0-0", []byte("first"))
+	m.EnqueueCall("0-1", []byte("other elevator"))
+	m.EnqueueCall("0-0", []byte("second"))
+
+	pending, _ := m.PendingCalls("0-0")
+	if len(pending) != 2 || pending[0].Index != 1 || pending[1].Index != 3 {
+		t.Errorf("Expected indexes 1 and 3 but got %v", pending)
+	}
+}
+
+func TestWatchMaintenance(t *testing.T) {
+	m := newStore()
+	m.SetMaintenanceMode("0-0", "true")
+
+	var modes []string
+	m.WatchMaintenance("0-0", func(mode string) {
+		modes = append(modes, mode)
+	}, func(string) {})
+
+	m.SetMaintenanceMode("0-0", "false")
+	m.SetMaintenanceMode("0-1", "true")
+
+	if len(modes) != 2 || modes[0] != "true" || modes[1] != "false" {
+		t.Errorf("Expected [true false] but got %v", modes)
+	}
+}
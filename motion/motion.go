@@ -0,0 +1,178 @@
+package motion
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// The time step used to integrate the car's motion.
+	STEP = 10 * time.Millisecond
+
+	// Cars this close to a floor are considered level with it.
+	LEVEL_TOLERANCE = 0.005 // meters
+)
+
+type (
+	// Describes how a car moves and how far apart the floors are.
+	// A zero Profile is disabled, and the elevator falls back to moving one floor per tick.
+	Profile struct {
+		Speed        float64 // Rated speed in meters per second.
+		Acceleration float64 // Meters per second squared.
+		Deceleration float64 // Meters per second squared.  Defaults to Acceleration.
+
+		FloorHeight  float64         // Meters from one floor to the next.
+		FloorHeights map[int]float64 // Meters from floor n to floor n + 1, overriding FloorHeight.
+	}
+
+	// The position and velocity of a car in a shaft.
+	Car struct {
+		Height   float64 // Meters above floor 0.
+		Velocity float64 // Meters per second.  Positive is up.
+
+		braking bool // True once the car has started slowing down for stop.
+		stop    int
+	}
+)
+
+// Returns true if the profile describes a car's motion.
+func (p Profile) Enabled() bool {
+	return p.Speed > 0 && p.Acceleration > 0 && p.FloorHeight > 0
+}
+
+// Returns the height of a floor in meters above floor 0.
+func (p Profile) Height(floor int) float64 {
+	height := 0.0
+	for f := 0; f < floor; f++ {
+		height += p.storyHeight(f)
+	}
+	for f := -1; f >= floor; f-- {
+		height -= p.storyHeight(f)
+	}
+	return height
+}
+
+// Returns the fractional floor at a height.  e.g. 2.5 is halfway between floors 2 and 3.
+func (p Profile) FloorAt(height float64) float64 {
+	floor := 0
+	for height >= p.Height(floor+1) {
+		floor++
+	}
+	for height < p.Height(floor) {
+		floor--
+	}
+
+	base := p.Height(floor)
+	return float64(floor) + (height-base)/p.storyHeight(floor)
+}
+
+// Returns the distance a car travelling at velocity needs to stop.
+func (p Profile) StoppingDistance(velocity float64) float64 {
+	return velocity * velocity / (2 * p.deceleration())
+}
+
+// Moves the car toward the floor it has to stop at for up to dt.
+// next is called with every floor ahead of the car, in the direction of travel, that it can still stop at.
+// It returns true if the car should stop there.  The car stops at lastFloor if next never does.
+// Returns the last floor the car reached, and true once the car is at rest, level with that floor.
+func (p Profile) Travel(c *Car, direction, lastFloor int, dt time.Duration, next func(floor int) bool) (int, bool) {
+	for elapsed := time.Duration(0); elapsed < dt; elapsed += STEP {
+		step := STEP
+		if dt-elapsed < step {
+			step = dt - elapsed
+		}
+
+		// Once the car starts slowing down for a floor, it is committed to stopping there.
+		if !c.braking {
+			c.stop = p.nextStop(c, direction, lastFloor, next)
+		}
+
+		distance := math.Abs(p.Height(c.stop) - c.Height)
+		speed := math.Abs(c.Velocity)
+
+		// Start braking if the car would be too close to stop after another step.
+		seconds := step.Seconds()
+		if c.braking || p.StoppingDistance(speed)+speed*seconds >= distance {
+			c.braking = true
+			speed -= p.deceleration() * seconds
+		} else {
+			speed = math.Min(speed+p.Acceleration*seconds, p.Speed)
+		}
+
+		if distance <= LEVEL_TOLERANCE || speed <= 0 || speed*seconds >= distance {
+			// Reached the floor, or stopped just short of it.  Level the car.
+			c.Height, c.Velocity, c.braking = p.Height(c.stop), 0, false
+			return c.stop, true
+		}
+
+		c.Velocity = speed * float64(direction)
+		c.Height += c.Velocity * seconds
+	}
+
+	return p.floorPassed(c, direction), false
+}
+
+// Returns the first floor ahead of the car it can still stop at and should, or the last floor if none.
+func (p Profile) nextStop(c *Car, direction, lastFloor int, next func(floor int) bool) int {
+	// Allow for the distance covered in one step, since braking starts a step early.
+	stopping := p.StoppingDistance(c.Velocity) - math.Abs(c.Velocity)*STEP.Seconds()
+
+	floor := p.floorPassed(c, direction)
+	for (lastFloor-floor)*direction > 0 {
+		floor += direction
+		ahead := (p.Height(floor) - c.Height) * float64(direction)
+		if ahead+LEVEL_TOLERANCE >= stopping && next(floor) {
+			return floor
+		}
+	}
+	return lastFloor
+}
+
+// Returns the last floor the car reached in its direction of travel.
+func (p Profile) floorPassed(c *Car, direction int) int {
+	position := p.FloorAt(c.Height)
+	if direction > 0 {
+		return int(math.Floor(position + LEVEL_TOLERANCE))
+	}
+	return int(math.Ceil(position - LEVEL_TOLERANCE))
+}
+
+// Returns the time a car takes to travel between two floors without stopping on the way.
+func (p Profile) TravelTime(from, to int) time.Duration {
+	distance := math.Abs(p.Height(to) - p.Height(from))
+	if distance == 0 {
+		return 0
+	}
+
+	accel, decel := p.Acceleration, p.deceleration()
+
+	// Distance needed to reach rated speed and stop again.
+	ramp := p.Speed*p.Speed/(2*accel) + p.Speed*p.Speed/(2*decel)
+
+	var seconds float64
+	if distance >= ramp {
+		seconds = p.Speed/accel + p.Speed/decel + (distance-ramp)/p.Speed
+	} else {
+		// Never reaches rated speed.
+		peak := math.Sqrt(2 * distance * accel * decel / (accel + decel))
+		seconds = peak/accel + peak/decel
+	}
+
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// Returns the height of the story from floor to floor + 1.
+func (p Profile) storyHeight(floor int) float64 {
+	if h, ok := p.FloorHeights[floor]; ok {
+		return h
+	}
+	return p.FloorHeight
+}
+
+// Returns the deceleration, defaulting to the acceleration.
+func (p Profile) deceleration() float64 {
+	if p.Deceleration > 0 {
+		return p.Deceleration
+	}
+	return p.Acceleration
+}
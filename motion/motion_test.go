@@ -0,0 +1,115 @@
+package motion
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func newProfile() Profile {
+	return Profile{Speed: 2, Acceleration: 1, FloorHeight: 3}
+}
+
+func TestHeightWithTallFloors(t *testing.T) {
+	p := newProfile()
+	p.FloorHeights = map[int]float64{1: 5, -1: 4}
+
+	if h := p.Height(3); h != 11 {
+		t.Errorf("Got height %v but wanted 11", h)
+	}
+
+	if h := p.Height(-1); h != -4 {
+		t.Errorf("Got height %v but wanted -4", h)
+	}
+
+	if f := p.FloorAt(5.5); f != 1.5 {
+		t.Errorf("Got floor %v but wanted 1.5", f)
+	}
+
+	if f := p.FloorAt(-2); f != -0.5 {
+		t.Errorf("Got floor %v but wanted -0.5", f)
+	}
+}
+
+func TestTravelTime(t *testing.T) {
+	p := newProfile()
+
+	// 30 meters: 2s to reach speed, 2s to stop, and 26 meters at 2 m/s.
+	if d := p.TravelTime(0, 10); d != 17*time.Second {
+		t.Errorf("Got %v but wanted 17s", d)
+	}
+
+	// 3 meters never reaches rated speed.
+	if d := p.TravelTime(1, 0); math.Abs(d.Seconds()-2*math.Sqrt(3)) > 0.001 {
+		t.Errorf("Got %v but wanted %vs", d, 2*math.Sqrt(3))
+	}
+}
+
+func TestTravelMatchesTravelTime(t *testing.T) {
+	p := newProfile()
+	c := &Car{}
+
+	var elapsed time.Duration
+	var passed []int
+	for {
+		floor, stopped := p.Travel(c, 1, 16, 100*time.Millisecond, func(floor int) bool { return floor == 10 })
+		elapsed += 100 * time.Millisecond
+
+		if len(passed) == 0 || passed[len(passed)-1] != floor {
+			passed = append(passed, floor)
+		}
+
+		if stopped {
+			if floor != 10 {
+				t.Fatalf("Stopped at floor %d but wanted 10", floor)
+			}
+			break
+		}
+
+		if elapsed > time.Minute {
+			t.Fatal("Car never stopped.")
+		}
+	}
+
+	if math.Abs(elapsed.Seconds()-17) > 0.2 {
+		t.Errorf("Took %v but wanted about 17s", elapsed)
+	}
+
+	if c.Velocity != 0 || c.Height != 30 {
+		t.Errorf("Expected the car at rest at 30m but got %+v", c)
+	}
+
+	// Every floor on the way was passed without stopping.
+	if len(passed) != 11 {
+		t.Errorf("Expected to pass floors 0 through 10 but passed %v", passed)
+	}
+}
+
+func TestTravelPassesFloorsTooCloseToStop(t *testing.T) {
+	p := newProfile()
+
+	// At rated speed the car needs 2 meters to stop, so floor 1 is too close.
+	c := &Car{Height: 2, Velocity: 2}
+	stops := func(floor int) bool { return floor == 1 || floor == 3 }
+
+	floor, stopped := p.Travel(c, 1, 16, 10*time.Second, stops)
+	if !stopped || floor != 3 {
+		t.Errorf("Expected to stop at floor 3 but stopped %v at floor %d", stopped, floor)
+	}
+}
+
+func TestTravelDown(t *testing.T) {
+	p := newProfile()
+	c := &Car{Height: p.Height(5)}
+
+	floor, stopped := p.Travel(c, -1, 0, time.Minute, func(floor int) bool { return floor == 2 })
+	if !stopped || floor != 2 || c.Height != 6 {
+		t.Errorf("Expected to stop at floor 2 but stopped %v at floor %d and height %v", stopped, floor, c.Height)
+	}
+}
+
+func TestDisabledProfile(t *testing.T) {
+	if (Profile{}).Enabled() {
+		t.Error("Expected a zero profile to be disabled.")
+	}
+}
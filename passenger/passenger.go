@@ -1,8 +1,94 @@
 package passenger
 
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+const (
+	// Stages of a passenger's trip.
+	STATE_WAITING   = "waiting"   // Waiting for the elevator to pick them up.
+	STATE_RIDING    = "riding"    // On the elevator.
+	STATE_DELIVERED = "delivered" // Dropped off at their destination.
+)
+
+const (
+	// Why a passenger's call was moved to another elevator.
+	REASSIGN_MAINTENANCE = "maintenance" // The elevator was draining for maintenance.
+	REASSIGN_EXPIRED     = "expired"     // The elevator stopped saving its status.
+	REASSIGN_ERROR       = "error"       // The elevator reported STATE_ERROR.
+)
+
+// How long a passenger's record is kept in the store after it was last updated.
+const RECORD_TTL = 24 * time.Hour
+
+// Records a passenger's call being moved from one elevator to another.
+type Reassignment struct {
+	From   string    `json:"from"`   // Key of the elevator the call was taken from.
+	Reason string    `json:"reason"` // One of the REASSIGN_* reasons.
+	At     time.Time `json:"at"`
+}
+
 // Defines a passenger.
 type Passenger struct {
+	Id string `json:"id,omitempty"` // Generated when the passenger's call is scheduled.
+
 	//	Weight           uint // TODO:  Calculate capacity based on weight?
 	CurrentFloor     int `json:"currentFloor"`     // The floor the passenger is currently on.
 	DestinationFloor int `json:"destinationFloor"` // The floor the passenger wants to go to.
+
+	// Set to up or down if the call came from a hall button.  The destination is only the next floor in that direction,
+	// and the call is answered, rather than boarded, when the elevator stops at CurrentFloor.
+	HallCall string `json:"hallCall,omitempty"`
+
+	// True if the call came from a button inside the car.  The elevator carries it to DestinationFloor from wherever it is.
+	CarCall bool `json:"carCall,omitempty"`
+
+	Elevator      string         `json:"elevator,omitempty"`      // Key of the elevator assigned to the passenger.  e.g. 0-1
+	Reassignments []Reassignment `json:"reassignments,omitempty"` // Every earlier elevator the call was moved from, oldest first.
+
+	CalledAt     time.Time `json:"calledAt"`     // When the passenger's call was scheduled.
+	PickedUpAt   time.Time `json:"pickedUpAt"`   // When the passenger boarded.  Zero until then.
+	DroppedOffAt time.Time `json:"droppedOffAt"` // When the passenger got off at their destination.  Zero until then.
+}
+
+// Returns a new random passenger id.
+func NewId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Returns the stage of the passenger's trip.
+func (p *Passenger) State() string {
+	if !p.DroppedOffAt.IsZero() {
+		return STATE_DELIVERED
+	}
+	if !p.PickedUpAt.IsZero() {
+		return STATE_RIDING
+	}
+	return STATE_WAITING
+}
+
+// Returns how long the passenger waited to be picked up, or has waited so far at now.
+func (p *Passenger) WaitTime(now time.Time) time.Duration {
+	if p.CalledAt.IsZero() {
+		return 0
+	}
+	if !p.PickedUpAt.IsZero() {
+		now = p.PickedUpAt
+	}
+	return now.Sub(p.CalledAt)
+}
+
+// Returns how long the passenger rode the elevator, or has ridden so far at now.
+func (p *Passenger) RideTime(now time.Time) time.Duration {
+	if p.PickedUpAt.IsZero() {
+		return 0
+	}
+	if !p.DroppedOffAt.IsZero() {
+		now = p.DroppedOffAt
+	}
+	return now.Sub(p.PickedUpAt)
 }
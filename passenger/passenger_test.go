@@ -3,6 +3,7 @@ package passenger_test
 import (
 	"github.com/davepersing/elevator-platform/passenger"
 	"testing"
+	"time"
 )
 
 func TestNewPassenger(t *testing.T) {
@@ -16,3 +17,28 @@ func TestNewPassenger(t *testing.T) {
 			p.CurrentFloor, p.DestinationFloor)
 	}
 }
+
+func TestPassengerLifecycle(t *testing.T) {
+	called := time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC)
+	p := passenger.Passenger{Id: passenger.NewId(), CurrentFloor: 1, DestinationFloor: 16, CalledAt: called}
+
+	if p.State() != passenger.STATE_WAITING || p.WaitTime(called.Add(5*time.Second)) != 5*time.Second || p.RideTime(called) != 0 {
+		t.Errorf("Expected a passenger waiting 5s but got %s waiting %v", p.State(), p.WaitTime(called.Add(5*time.Second)))
+	}
+
+	p.PickedUpAt = called.Add(20 * time.Second)
+	if p.State() != passenger.STATE_RIDING || p.WaitTime(called.Add(time.Minute)) != 20*time.Second {
+		t.Errorf("Expected a riding passenger that waited 20s but got %s after %v", p.State(), p.WaitTime(called.Add(time.Minute)))
+	}
+
+	p.DroppedOffAt = called.Add(50 * time.Second)
+	if p.State() != passenger.STATE_DELIVERED || p.RideTime(called.Add(time.Hour)) != 30*time.Second {
+		t.Errorf("Expected a delivered passenger that rode 30s but got %s after %v", p.State(), p.RideTime(called.Add(time.Hour)))
+	}
+}
+
+func TestNewIdIsUnique(t *testing.T) {
+	if a, b := passenger.NewId(), passenger.NewId(); a == "" || a == b {
+		t.Errorf("Expected two different ids but got %q and %q", a, b)
+	}
+}
@@ -0,0 +1,225 @@
+package reconciler
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/davepersing/elevator-platform/clock"
+	"github.com/davepersing/elevator-platform/elevator"
+	"github.com/davepersing/elevator-platform/passenger"
+	"github.com/davepersing/elevator-platform/store"
+	"github.com/davepersing/elevator-platform/util"
+)
+
+const (
+	// How often the reconciler looks for stranded calls.
+	DEFAULT_INTERVAL = 5 * time.Second
+
+	// How long an elevator has to stay down before its calls are moved.  Rides out brief lapses in its status.
+	DEFAULT_GRACE_PERIOD = 10 * time.Second
+)
+
+type (
+	// Dispatches a passenger's call again, away from the elevator it is assigned to.
+	// Implemented by http_api.HttpApi.
+	Dispatcher interface {
+		Reassign(p *passenger.Passenger, reason string) (*util.SuccessResult, error)
+	}
+
+	// Finds calls stranded on elevators whose status expired or that are in STATE_ERROR,
+	// and dispatches them to other elevators.
+	// Only one reconciler should run in the cluster.  It isn't safe to sweep from more than one goroutine.
+	Reconciler struct {
+		Store       store.Store
+		Dispatcher  Dispatcher
+		Clock       clock.Clock   // Defaults to the system clock.
+		Interval    time.Duration // Time between sweeps.  Defaults to DEFAULT_INTERVAL.
+		GracePeriod time.Duration // Defaults to DEFAULT_GRACE_PERIOD.
+
+		down map[string]time.Time // When each elevator was first seen down, by key.
+	}
+)
+
+// Sweeps for stranded calls every interval until stop is closed.  A nil stop sweeps forever.
+func (r *Reconciler) Run(stop <-chan struct{}) {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DEFAULT_INTERVAL
+	}
+
+	tick := r.getClock().Tick(interval)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick:
+			r.Sweep()
+		}
+	}
+}
+
+// Looks for stranded calls once and dispatches them to other elevators.
+// Calls are only moved once their elevator has been down for the grace period.
+// Returns the number of calls reassigned.
+func (r *Reconciler) Sweep() int {
+	statuses, err := r.Store.GetAllStatuses()
+	if err != nil {
+		fmt.Printf("Could not get statuses to reconcile.  Error: %v\n", err)
+		return 0
+	}
+
+	states, err := r.Store.GetAllStates()
+	if err != nil {
+		fmt.Printf("Could not get states to reconcile.  Error: %v\n", err)
+		return 0
+	}
+
+	alive := make(map[string]*elevator.ElevatorStatus)
+	for _, data := range statuses {
+		es := &elevator.ElevatorStatus{}
+		if err := json.Unmarshal(data, es); err == nil {
+			alive[store.Key(es.GroupId, es.Id)] = es
+		}
+	}
+
+	if r.down == nil {
+		r.down = make(map[string]time.Time)
+	}
+
+	now := r.getClock().Now()
+	down := make(map[string]time.Time)
+	moved := 0
+
+	for _, data := range states {
+		es := &elevator.ElevatorStatus{}
+		if err := json.Unmarshal(data, es); err != nil {
+			// Skip states that can't be deciphered.
+			continue
+		}
+		key := store.Key(es.GroupId, es.Id)
+
+		var reason string
+		if live, ok := alive[key]; !ok {
+			reason = passenger.REASSIGN_EXPIRED
+		} else if live.CurrentState == elevator.STATE_ERROR {
+			reason = passenger.REASSIGN_ERROR
+		} else {
+			continue
+		}
+
+		since, ok := r.down[key]
+		if !ok {
+			since = now
+		}
+		down[key] = since
+
+		if now.Sub(since) >= r.gracePeriod() {
+			moved += r.reassign(key, es, reason)
+		}
+	}
+
+	// Forget elevators that came back.
+	r.down = down
+	return moved
+}
+
+// Moves the calls waiting on an elevator, and any it never consumed from its queue, to other elevators.
+// Returns the number of calls moved.
+func (r *Reconciler) reassign(key string, es *elevator.ElevatorStatus, reason string) int {
+	moved := 0
+	for _, p := range es.Waiting {
+		if record, _ := r.waitingRecord(key, p); record != nil && r.dispatch(record, reason) {
+			moved++
+		}
+	}
+
+	calls, err := r.Store.PendingCalls(key)
+	if err != nil {
+		fmt.Printf("Could not get the queued calls of elevator %s.  Error: %v\n", key, err)
+		return moved
+	}
+
+	for _, c := range calls {
+		var p passenger.Passenger
+		if err := json.Unmarshal(c.Data, &p); err != nil {
+			continue
+		}
+
+		record, tracked := r.waitingRecord(key, &p)
+		if !tracked {
+			// Leave it for the elevator to pick up if it comes back.
+			continue
+		}
+
+		if record != nil {
+			if !r.dispatch(record, reason) {
+				continue
+			}
+			moved++
+		}
+
+		// The call is now queued on another elevator.
+		r.Store.AckCall(key, c)
+	}
+
+	return moved
+}
+
+// Returns the record of a passenger still waiting for the elevator, or nil if they have been picked up
+// or their call has already been moved.  Returns false if the passenger has no record to check.
+// Passengers without a record can't be told apart across sweeps, so they are never moved.
+func (r *Reconciler) waitingRecord(key string, p *passenger.Passenger) (*passenger.Passenger, bool) {
+	if p.Id == "" {
+		return nil, false
+	}
+
+	data, err := r.Store.GetPassenger(p.Id)
+	if err != nil || data == nil {
+		return nil, false
+	}
+
+	var record passenger.Passenger
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, false
+	}
+
+	if record.CarCall {
+		// Car calls were pressed inside the car, so they stay for it to carry when it comes back.
+		return nil, false
+	}
+
+	if record.Elevator != key || record.State() != passenger.STATE_WAITING {
+		return nil, true
+	}
+	return &record, true
+}
+
+// Dispatches a passenger to another elevator.  Returns false if none could take them.
+func (r *Reconciler) dispatch(p *passenger.Passenger, reason string) bool {
+	result, err := r.Dispatcher.Reassign(p, reason)
+	if err != nil {
+		fmt.Printf("Could not reassign passenger %s from elevator %s.  Error: %s\n", p.Id, p.Elevator, err.Error())
+		return false
+	}
+
+	fmt.Printf("Reassigned passenger %s from elevator %s to %s-%s.  Reason: %s\n",
+		p.Id, p.Elevator, result.GroupId, result.ElevatorId, reason)
+	return true
+}
+
+// Returns the reconciler's clock.
+func (r *Reconciler) getClock() clock.Clock {
+	if r.Clock == nil {
+		return clock.Real{}
+	}
+	return r.Clock
+}
+
+// Returns how long an elevator has to stay down before its calls are moved.
+func (r *Reconciler) gracePeriod() time.Duration {
+	if r.GracePeriod <= 0 {
+		return DEFAULT_GRACE_PERIOD
+	}
+	return r.GracePeriod
+}
@@ -0,0 +1,183 @@
+package reconciler_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/davepersing/elevator-platform/clock"
+	"github.com/davepersing/elevator-platform/elevator"
+	"github.com/davepersing/elevator-platform/group"
+	"github.com/davepersing/elevator-platform/http_api"
+	"github.com/davepersing/elevator-platform/memory_store"
+	"github.com/davepersing/elevator-platform/passenger"
+	"github.com/davepersing/elevator-platform/reconciler"
+	"github.com/davepersing/elevator-platform/scheduler"
+	"github.com/davepersing/elevator-platform/store"
+)
+
+// Creates and starts an idle elevator in group 0 on floor 1 that only moves when stepped.
+func newSteppedElevator(st store.Store, c clock.Clock, id int) *elevator.Elevator {
+	e := &elevator.Elevator{
+		MaxFloor:    16,
+		MinFloor:    1,
+		MaxCapacity: 16,
+		Store:       st,
+		Clock:       c,
+		Stepped:     true,
+		ElevatorStatus: elevator.ElevatorStatus{
+			Id:                id,
+			CurrentFloor:      1,
+			CurrentState:      elevator.STATE_IDLE,
+			WaitingPassengers: elevator.WaitingPassengers{Waiting: make([]*passenger.Passenger, 0)},
+			Passengers:        make([]*passenger.Passenger, 0),
+		},
+	}
+	e.Init()
+	return e
+}
+
+// Records a passenger waiting for elevator 0-0 and returns them.
+func newWaitingPassenger(st store.Store, id string, floor int, at time.Time) *passenger.Passenger {
+	p := &passenger.Passenger{Id: id, CurrentFloor: floor, DestinationFloor: 1, Elevator: store.Key(0, 0), CalledAt: at}
+	data, _ := json.Marshal(p)
+	st.SavePassenger(p.Id, data, passenger.RECORD_TTL)
+	return p
+}
+
+// Returns the record of a passenger.
+func getRecord(t *testing.T, st store.Store, id string) passenger.Passenger {
+	data, err := st.GetPassenger(id)
+	if err != nil || data == nil {
+		t.Fatalf("Expected a record for passenger %s", id)
+	}
+
+	var p passenger.Passenger
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// Runs a live elevator 0-1 beside elevator 0-0, which died with one passenger waiting and one still queued.
+func newStrandedBuilding(t *testing.T) (*memory_store.MemoryStore, *clock.Fake, *reconciler.Reconciler, *elevator.Elevator) {
+	st := &memory_store.MemoryStore{}
+	st.Init()
+	fake := clock.NewFake(time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC))
+
+	live := newSteppedElevator(st, fake, 1)
+
+	waiting := newWaitingPassenger(st, "waiting", 5, fake.Now())
+	data, _ := json.Marshal(&elevator.ElevatorStatus{
+		Id:                0,
+		CurrentFloor:      9,
+		CurrentState:      elevator.STATE_MOVING_DOWN,
+		WaitingPassengers: elevator.WaitingPassengers{Waiting: []*passenger.Passenger{waiting}},
+	})
+	st.SetStatus(store.Key(0, 0), data, -1)
+
+	queued := newWaitingPassenger(st, "queued", 7, fake.Now())
+	data, _ = json.Marshal(queued)
+	st.EnqueueCall(store.Key(0, 0), data)
+
+	sched, err := scheduler.Get(scheduler.DEFAULT_SCHEDULER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := &http_api.HttpApi{
+		Store:     st,
+		Scheduler: sched,
+		Groups:    []*group.Group{{Id: 0, ElevatorCount: 2, MinFloor: 1, MaxFloor: 16}},
+		Clock:     fake,
+	}
+
+	return st, fake, &reconciler.Reconciler{Store: st, Dispatcher: api, Clock: fake}, live
+}
+
+func TestSweepReassignsCallsFromExpiredElevator(t *testing.T) {
+	st, fake, r, live := newStrandedBuilding(t)
+
+	if moved := r.Sweep(); moved != 0 {
+		t.Fatalf("Expected no calls moved within the grace period but moved %d", moved)
+	}
+
+	fake.Advance(reconciler.DEFAULT_GRACE_PERIOD)
+	if moved := r.Sweep(); moved != 2 {
+		t.Fatalf("Expected 2 calls moved but moved %d", moved)
+	}
+
+	if len(live.Waiting) != 2 {
+		t.Errorf("Expected both passengers waiting on elevator 0-1 but got %d", len(live.Waiting))
+	}
+
+	for _, id := range []string{"waiting", "queued"} {
+		p := getRecord(t, st, id)
+		if p.Elevator != store.Key(0, 1) || len(p.Reassignments) != 1 {
+			t.Fatalf("Expected passenger %s reassigned once to 0-1 but got %+v", id, p)
+		}
+
+		re := p.Reassignments[0]
+		if re.From != store.Key(0, 0) || re.Reason != passenger.REASSIGN_EXPIRED || !re.At.Equal(fake.Now()) {
+			t.Errorf("Expected passenger %s reassigned from 0-0 because it expired but got %+v", id, re)
+		}
+	}
+
+	if calls, _ := st.PendingCalls(store.Key(0, 0)); len(calls) != 0 {
+		t.Errorf("Expected the dead elevator's queue emptied but %d calls remain", len(calls))
+	}
+
+	// The dead elevator's state still lists the waiting passenger, but it is only moved once.
+	if moved := r.Sweep(); moved != 0 {
+		t.Errorf("Expected nothing left to move but moved %d", moved)
+	}
+}
+
+func TestRestartedElevatorDropsReassignedPassengers(t *testing.T) {
+	st, fake, r, _ := newStrandedBuilding(t)
+
+	r.Sweep()
+	fake.Advance(reconciler.DEFAULT_GRACE_PERIOD)
+	r.Sweep()
+
+	restarted := newSteppedElevator(st, fake, 0)
+	if len(restarted.Waiting) != 0 {
+		t.Errorf("Expected the restarted elevator to drop its reassigned passengers but has %d waiting", len(restarted.Waiting))
+	}
+}
+
+func TestSweepReassignsCallsFromErroredElevator(t *testing.T) {
+	st := &memory_store.MemoryStore{}
+	st.Init()
+	fake := clock.NewFake(time.Date(2016, 1, 1, 8, 0, 0, 0, time.UTC))
+
+	live := newSteppedElevator(st, fake, 1)
+
+	waiting := newWaitingPassenger(st, "waiting", 5, fake.Now())
+	data, _ := json.Marshal(&elevator.ElevatorStatus{
+		Id:                0,
+		CurrentFloor:      9,
+		CurrentState:      elevator.STATE_ERROR,
+		WaitingPassengers: elevator.WaitingPassengers{Waiting: []*passenger.Passenger{waiting}},
+	})
+	st.SetStatus(store.Key(0, 0), data, time.Hour)
+
+	sched, _ := scheduler.Get(scheduler.DEFAULT_SCHEDULER)
+	api := &http_api.HttpApi{
+		Store:     st,
+		Scheduler: sched,
+		Groups:    []*group.Group{{Id: 0, ElevatorCount: 2, MinFloor: 1, MaxFloor: 16}},
+		Clock:     fake,
+	}
+
+	r := &reconciler.Reconciler{Store: st, Dispatcher: api, Clock: fake, GracePeriod: time.Second}
+	r.Sweep()
+	fake.Advance(time.Second)
+	if moved := r.Sweep(); moved != 1 || len(live.Waiting) != 1 {
+		t.Fatalf("Expected the passenger moved to elevator 0-1 but moved %d", moved)
+	}
+
+	if p := getRecord(t, st, "waiting"); len(p.Reassignments) != 1 || p.Reassignments[0].Reason != passenger.REASSIGN_ERROR {
+		t.Errorf("Expected the reassignment recorded as an error but got %+v", p.Reassignments)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/davepersing/elevator-platform/passenger"
+	"github.com/davepersing/elevator-platform/traffic"
+	"github.com/davepersing/elevator-platform/util"
+)
+
+// The response to a replayed call, written out one per line.
+type replayResponse struct {
+	Offset    float64             `json:"offset"` // Seconds from the start of the log the call was recorded at.
+	Passenger passenger.Passenger `json:"passenger"`
+	Result    *util.SuccessResult `json:"result,omitempty"` // The assignment, if the call was scheduled.
+	Error     string              `json:"error,omitempty"`  // Why the call failed, if it wasn't.
+}
+
+// Runs `elevator-platform replay [flags] calls.jsonl`.
+// Posts recorded calls to a running cluster through POST /elevator_call at their recorded offsets,
+// and writes the responses out as JSONL.  `elevator-platform simulate -replay=calls.jsonl` replays them against the simulator instead.
+// Returns the exit code.
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+
+	var speedup = fs.Float64("speedup", 1, "Replays the calls this many times faster than they were recorded.  0 sends them as fast as possible.")
+	var port = fs.Int("port", 8080, "The HTTP port of the elevator to send calls to.")
+	var outputPath = fs.String("output", "-", "Writes the response to every call to this file, one per line.  - writes to stdout.")
+
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Println("Usage: elevator-platform replay [flags] calls.jsonl")
+		fs.PrintDefaults()
+		return 2
+	}
+
+	replay, err := readReplay(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Cannot replay calls.  Error: %s\n", err.Error())
+		return 1
+	}
+
+	var out io.Writer = os.Stdout
+	if *outputPath != "-" {
+		f, err := os.Create(*outputPath)
+		if err != nil {
+			fmt.Printf("Cannot replay calls.  Error: %s\n", err.Error())
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+
+	encoder := json.NewEncoder(out)
+	target := ":" + strconv.Itoa(*port)
+	failed := 0
+
+	traffic.Play(replay, *speedup, func(at time.Duration, p passenger.Passenger) {
+		response := replayResponse{Offset: at.Seconds(), Passenger: p}
+
+		result, err := util.SendPassengerPost(target, p.CurrentFloor, p.DestinationFloor)
+		if err != nil {
+			response.Error = err.Error()
+			failed++
+		} else {
+			response.Result = result
+		}
+
+		if err := encoder.Encode(&response); err != nil {
+			fmt.Printf("Could not write response.  Error: %s\n", err.Error())
+		}
+	})
+
+	fmt.Fprintf(os.Stderr, "Replayed %d calls.  %d failed.\n", replay.Len(), failed)
+	return 0
+}
+
+// Reads recorded calls from a JSONL file.
+func readReplay(path string) (*traffic.Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return traffic.ReadCalls(f)
+}
@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"math"
+	"time"
+
+	"github.com/davepersing/elevator-platform/elevator"
+	"github.com/davepersing/elevator-platform/passenger"
+)
+
+const (
+	REASON_LOWEST_ETA = "lowest_eta" // The elevator with the lowest estimated wait plus ride time was chosen.
+
+	// Upper bound on simulated floors so a malformed status can't loop forever.
+	MAX_SIMULATED_FLOORS = 10000
+)
+
+type (
+	// Schedules passengers on the elevator that gets them to their destination soonest.
+	// Each elevator's remaining stops are simulated, including its riders' destinations
+	// and the passengers it has yet to pick up, to estimate the new passenger's wait and ride time.
+	EtaScheduler struct {
+		Options
+	}
+
+	// A passenger being simulated.
+	simulatedTrip struct {
+		pickupFloor      int
+		destinationFloor int
+		onBoard          bool
+		isNew            bool // The passenger being scheduled.
+	}
+)
+
+func init() {
+	Register("eta", func(opts Options) Scheduler {
+		return EtaScheduler{Options: opts}
+	})
+}
+
+// Assigns the passenger to the elevator with the lowest estimated arrival time.
+func (s EtaScheduler) FindElevator(statuses map[int]*elevator.ElevatorStatus, p *passenger.Passenger) Assignment {
+
+	statusResults := filterUnavailableStatuses(statuses)
+	if len(statusResults) == 0 {
+		return Unavailable()
+	}
+
+	statusResults = filterNotServing(statusResults, p)
+	if len(statusResults) == 0 {
+		return Assignment{ElevatorId: -1, GroupId: -1, Reason: REASON_NOT_SERVED}
+	}
+
+	reason := REASON_LOWEST_ETA
+	statusResults, ok := filterFullStatuses(statusResults)
+	if !ok {
+		// Every elevator is full.  Still queue the passenger on the least loaded one.
+		a := assignmentForId(statusResults, getLeastLoadedId(statusResults, p), REASON_ALL_FULL)
+		a.EstimatedPickup, a.EstimatedArrival = s.Estimate(statusResults[a.ElevatorId], p)
+		return a
+	}
+
+	best := Unavailable()
+	bestArrival := time.Duration(math.MaxInt64)
+	for id, es := range statusResults {
+		pickup, arrival := s.Estimate(es, p)
+
+		// Ties go to the lowest id so the decision doesn't depend on map order.
+		if arrival < bestArrival || (arrival == bestArrival && id < best.ElevatorId) {
+			best = assignmentForId(statusResults, id, reason)
+			best.EstimatedPickup, best.EstimatedArrival = pickup, arrival
+			bestArrival = arrival
+		}
+	}
+
+	return best
+}
+
+// Estimates how long until the elevator picks up the passenger, and how long until it drops them off.
+// Simulates the elevator's remaining stops the way it moves: it keeps going in its current direction
+// while it has stops ahead, then reverses.  Every floor takes FloorTravelTime and every stop takes DwellTime.
+func (o Options) Estimate(es *elevator.ElevatorStatus, p *passenger.Passenger) (time.Duration, time.Duration) {
+
+	var trips []*simulatedTrip
+	for _, rider := range es.Passengers {
+		trips = append(trips, &simulatedTrip{destinationFloor: rider.DestinationFloor, onBoard: true})
+	}
+	for _, waiting := range es.Waiting {
+		trips = append(trips, &simulatedTrip{pickupFloor: waiting.CurrentFloor, destinationFloor: waiting.DestinationFloor})
+	}
+	trips = append(trips, &simulatedTrip{pickupFloor: p.CurrentFloor, destinationFloor: p.DestinationFloor, isNew: true})
+
+	floor := es.CurrentFloor
+	direction := 0
+	switch es.CurrentState {
+	case elevator.STATE_MOVING_UP:
+		direction = 1
+	case elevator.STATE_MOVING_DOWN:
+		direction = -1
+	}
+
+	var elapsed, pickup time.Duration
+	for i := 0; i < MAX_SIMULATED_FLOORS; i++ {
+
+		// Unload and load everyone at this floor.
+		stopped := false
+		remaining := trips[:0]
+		for _, trip := range trips {
+			if trip.onBoard && trip.destinationFloor == floor {
+				stopped = true
+				if trip.isNew {
+					return pickup, elapsed
+				}
+				continue
+			}
+
+			if !trip.onBoard && trip.pickupFloor == floor {
+				stopped = true
+				trip.onBoard = true
+				if trip.isNew {
+					pickup = elapsed
+				}
+			}
+			remaining = append(remaining, trip)
+		}
+		trips = remaining
+
+		if stopped {
+			elapsed += o.DwellTime
+		}
+
+		direction = nextDirection(trips, floor, direction)
+		if direction == 0 {
+			break
+		}
+
+		floor += direction
+		elapsed += o.FloorTravelTime
+	}
+
+	// Only reachable with a malformed status.  The estimate is as good as it gets.
+	return pickup, elapsed
+}
+
+// Returns the direction the simulated elevator moves next.
+// Keeps the current direction while there are stops ahead, otherwise heads toward the remaining stops.
+// Returns 0 when there is nowhere left to go.
+func nextDirection(trips []*simulatedTrip, floor, direction int) int {
+	above, below := false, false
+	for _, trip := range trips {
+		target := trip.pickupFloor
+		if trip.onBoard {
+			target = trip.destinationFloor
+		}
+
+		if target > floor {
+			above = true
+		} else if target < floor {
+			below = true
+		}
+	}
+
+	switch {
+	case direction > 0 && above, direction < 0 && below:
+		return direction
+	case above && (direction == 0 || !below):
+		return 1
+	case below:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// The scheduler used when no strategy is selected.
+	DEFAULT_SCHEDULER = "nearest"
+
+	// Default timings for estimating arrival times.  These match one elevator tick per floor and per stop.
+	DEFAULT_FLOOR_TRAVEL_TIME = 1 * time.Second
+	DEFAULT_DWELL_TIME        = 1 * time.Second
+)
+
+type (
+	// Options shared by every scheduler.
+	Options struct {
+		FloorTravelTime time.Duration // Time for an elevator to travel one floor.
+		DwellTime       time.Duration // Time an elevator spends stopped at a floor to load or unload.
+	}
+
+	// Creates a scheduler with the given options.
+	Factory func(opts Options) Scheduler
+)
+
+var (
+	schedulersMu sync.Mutex
+	schedulers   = make(map[string]Factory)
+)
+
+// Returns the options used when none are given.
+func DefaultOptions() Options {
+	return Options{FloorTravelTime: DEFAULT_FLOOR_TRAVEL_TIME, DwellTime: DEFAULT_DWELL_TIME}
+}
+
+// Makes a scheduler available by the provided name.
+// Panics if the factory is nil or the name is already registered.
+func Register(name string, factory Factory) {
+	schedulersMu.Lock()
+	defer schedulersMu.Unlock()
+
+	if factory == nil {
+		panic("scheduler: Register factory is nil")
+	}
+
+	if _, dup := schedulers[name]; dup {
+		panic("scheduler: Register called twice for scheduler " + name)
+	}
+
+	schedulers[name] = factory
+}
+
+// Returns a new scheduler registered with the given name.
+func New(name string, opts Options) (Scheduler, error) {
+	schedulersMu.Lock()
+	defer schedulersMu.Unlock()
+
+	factory, ok := schedulers[name]
+	if !ok {
+		return nil, errors.New("Unknown scheduler: " + name)
+	}
+
+	return factory(opts), nil
+}
+
+// Returns a new scheduler registered with the given name using the default options.
+func Get(name string) (Scheduler, error) {
+	return New(name, DefaultOptions())
+}
+
+// Returns the sorted names of all registered schedulers.
+func Names() []string {
+	schedulersMu.Lock()
+	defer schedulersMu.Unlock()
+
+	names := make([]string, 0, len(schedulers))
+	for name := range schedulers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -1,24 +1,92 @@
 package scheduler
 
 import (
-	"fmt"
 	"math"
+	"time"
 
 	"github.com/davepersing/elevator-platform/elevator"
 	"github.com/davepersing/elevator-platform/passenger"
 	"github.com/davepersing/elevator-platform/util"
 )
 
+const (
+	// Reasons given by a scheduler for an assignment.
+	REASON_CLOSEST_IDLE        = "closest_idle"        // The closest idling elevator was chosen.
+	REASON_CLOSEST_DIRECTIONAL = "closest_directional" // The closest elevator moving toward the passenger was chosen.
+	REASON_CLOSEST_TARGET      = "closest_target"      // The elevator with a target floor closest to the passenger was chosen.
+	REASON_ALL_FULL            = "all_full"            // Every elevator is full, so the least loaded elevator was chosen.
+	REASON_NOT_SERVED          = "not_served"          // No available elevator stops at both of the passenger's floors.
+	REASON_UNAVAILABLE         = "unavailable"         // No elevator was available to take the passenger.
+)
+
+type (
+	// Defines a dispatch strategy.  A scheduler receives the current statuses of the elevators
+	// and decides which elevator should pick up the passenger.
+	Scheduler interface {
+		FindElevator(statuses map[int]*elevator.ElevatorStatus, p *passenger.Passenger) Assignment
+	}
+
+	// The result of a scheduling decision.
+	// ElevatorId and GroupId are -1 when no elevator could be assigned.
+	Assignment struct {
+		ElevatorId int
+		GroupId    int
+		Reason     string // Why the scheduler made this decision.
+
+		EstimatedPickup  time.Duration // Estimated time until the elevator reaches the passenger.
+		EstimatedArrival time.Duration // Estimated time until the passenger reaches their destination.
+	}
+
+	// Schedules passengers on the closest idle elevator or the closest elevator
+	// already moving in the passenger's direction.
+	NearestScheduler struct {
+		Options
+	}
+)
+
+func init() {
+	Register(DEFAULT_SCHEDULER, func(opts Options) Scheduler {
+		return NearestScheduler{Options: opts}
+	})
+}
+
+// Returns an assignment that could not be fulfilled.
+func Unavailable() Assignment {
+	return Assignment{ElevatorId: -1, GroupId: -1, Reason: REASON_UNAVAILABLE}
+}
+
 // Based on the statuses returned from each elevator, makes a decision on where to schedule the elevator.
-// Returns the elevatorId and groupId of the assigned elevator.
-func FindElevator(statuses map[int]*elevator.ElevatorStatus, p *passenger.Passenger) (int, int) {
+// Returns the elevatorId and groupId of the assigned elevator, with its estimated times.
+func (s NearestScheduler) FindElevator(statuses map[int]*elevator.ElevatorStatus, p *passenger.Passenger) Assignment {
+	a := s.findNearest(statuses, p)
+	if a.ElevatorId >= 0 {
+		a.EstimatedPickup, a.EstimatedArrival = s.Estimate(statuses[a.ElevatorId], p)
+	}
+	return a
+}
+
+// Returns an assignment for the nearest elevator.
+func (s NearestScheduler) findNearest(statuses map[int]*elevator.ElevatorStatus, p *passenger.Passenger) Assignment {
 
 	// Take out all statuses that aren't available.
 	statusResults := filterUnavailableStatuses(statuses)
 
 	// If all are unavailable, bail out early.
 	if len(statusResults) == 0 {
-		return -1, -1
+		return Unavailable()
+	}
+
+	// Only elevators stopping at both the passenger's current and destination floors can take the trip.
+	statusResults = filterNotServing(statusResults, p)
+	if len(statusResults) == 0 {
+		return Assignment{ElevatorId: -1, GroupId: -1, Reason: REASON_NOT_SERVED}
+	}
+
+	// Skip elevators that would be overfull with this passenger.
+	// If every elevator is full, still queue the passenger on the least loaded one.
+	statusResults, ok := filterFullStatuses(statusResults)
+	if !ok {
+		return assignmentForId(statusResults, getLeastLoadedId(statusResults, p), REASON_ALL_FULL)
 	}
 
 	closestIdleId := getClosestIdle(statusResults, p)
@@ -43,17 +111,17 @@ func FindElevator(statuses map[int]*elevator.ElevatorStatus, p *passenger.Passen
 
 		if idleTest < directionalTest {
 
-			return closestIdleId, groupIdForId(statusResults, closestIdleId)
+			return assignmentForId(statusResults, closestIdleId, REASON_CLOSEST_IDLE)
 		} else {
 
-			return closestDirectionalId, groupIdForId(statusResults, closestDirectionalId)
+			return assignmentForId(statusResults, closestDirectionalId, REASON_CLOSEST_DIRECTIONAL)
 		}
 	} else if closestIdleId >= 0 {
 
-		return closestIdleId, groupIdForId(statusResults, closestIdleId)
+		return assignmentForId(statusResults, closestIdleId, REASON_CLOSEST_IDLE)
 	} else if closestDirectionalId >= 0 {
 
-		return closestDirectionalId, groupIdForId(statusResults, closestDirectionalId)
+		return assignmentForId(statusResults, closestDirectionalId, REASON_CLOSEST_DIRECTIONAL)
 	}
 
 	// If we got this far, there are no idle and no moving the same direction.
@@ -63,10 +131,15 @@ func FindElevator(statuses map[int]*elevator.ElevatorStatus, p *passenger.Passen
 
 	// All elevators are in maintenance or error states.
 	if closestIdToPassenger < 0 {
-		return -1, -1
+		return Unavailable()
 	}
 
-	return closestIdToPassenger, statusResults[closestIdToPassenger].GroupId
+	return assignmentForId(statusResults, closestIdToPassenger, REASON_CLOSEST_TARGET)
+}
+
+// Builds an assignment for the elevator with the given id in the statuses hash.
+func assignmentForId(statuses map[int]*elevator.ElevatorStatus, id int, reason string) Assignment {
+	return Assignment{ElevatorId: id, GroupId: groupIdForId(statuses, id), Reason: reason}
 }
 
 // Convenience method to grab the group ID out of the statuses hash.
@@ -85,8 +158,8 @@ func getClosestToTargetId(statuses map[int]*elevator.ElevatorStatus, p *passenge
 	for _, status := range statuses {
 
 		test := util.Abs(status.CurrentTargetFloor - p.CurrentFloor)
-		// less than or equal because the elevators could be heading to the same floor.
-		if test < closestTarget {
+		// Ties go to the lowest id so the same statuses always give the same elevator.
+		if test < closestTarget || (test == closestTarget && status.Id < closestIdToPassenger) {
 			closestIdToPassenger = status.Id
 			closestTarget = test
 		}
@@ -135,10 +208,9 @@ func getClosestDirectionalId(statuses map[int]*elevator.ElevatorStatus, p *passe
 	var closestInFloors int = math.MaxInt32
 	for id, es := range sameDirection {
 		test := util.Abs(es.CurrentFloor - p.CurrentFloor)
-		if test < closestInFloors {
+		if test < closestInFloors || (test == closestInFloors && id < closestId) {
 			closestId = id
 			closestInFloors = test
-			fmt.Printf("DIRECTIONAL: Setting closestID: %d, floors: %d\n", id, closestInFloors)
 		}
 	}
 
@@ -173,7 +245,7 @@ func getClosestIdle(statuses map[int]*elevator.ElevatorStatus, p *passenger.Pass
 	var closestId int
 	for id, es := range idlers {
 		test := util.Abs(es.CurrentFloor - p.CurrentFloor)
-		if test < closestInFloors {
+		if test < closestInFloors || (test == closestInFloors && id < closestId) {
 			closestId = id
 			closestInFloors = test
 		}
@@ -183,28 +255,85 @@ func getClosestIdle(statuses map[int]*elevator.ElevatorStatus, p *passenger.Pass
 }
 
 // Filters out any elevator with a non-available status.
-// Returns a map of elevator statuses.
+// Returns a new map of elevator statuses.  The statuses passed in are left as they were.
 func filterUnavailableStatuses(statuses map[int]*elevator.ElevatorStatus) map[int]*elevator.ElevatorStatus {
+	available := make(map[int]*elevator.ElevatorStatus)
 	for id, es := range statuses {
-		var remove bool
 
 		// Check the elevator state.
 		switch es.CurrentState {
 		case elevator.STATE_ERROR,
-			elevator.STATE_MAINTENANCE:
-			remove = true
+			elevator.STATE_MAINTENANCE,
+			elevator.STATE_DRAINING:
+			continue
+		}
+
+		// Elevators draining for maintenance finish their current work, but take no new calls.
+		if es.MaintenanceRequested {
+			continue
 		}
 
-		// Check the capacity.
-		// TODO: Fix this.  MaxCapacity needs to be in here somewhere.
-		// Also, if all elevators are at max capacity, still need to schedule passengers.
-		// if len(es.Passengers) >= MAX_CAPACITY {
-		// 	remove = true
-		// }
+		available[id] = es
+	}
+	return available
+}
 
-		if remove {
-			delete(statuses, id)
+// Filters out any elevator that doesn't stop at both the passenger's current and destination floors.
+func filterNotServing(statuses map[int]*elevator.ElevatorStatus, p *passenger.Passenger) map[int]*elevator.ElevatorStatus {
+	serving := make(map[int]*elevator.ElevatorStatus)
+	for id, es := range statuses {
+		if ServesTrip(es, p) {
+			serving[id] = es
 		}
 	}
-	return statuses
+	return serving
+}
+
+// Filters out any elevator that can't take another passenger without going over capacity.
+// Returns the elevators with room.  If every elevator is full, returns the original statuses and false.
+func filterFullStatuses(statuses map[int]*elevator.ElevatorStatus) (map[int]*elevator.ElevatorStatus, bool) {
+	withRoom := make(map[int]*elevator.ElevatorStatus)
+	for id, es := range statuses {
+		if !isFull(es) {
+			withRoom[id] = es
+		}
+	}
+
+	if len(withRoom) == 0 {
+		return statuses, false
+	}
+	return withRoom, true
+}
+
+// Returns true if the elevator would be over capacity with one more passenger.
+// An elevator without a published capacity is never full.
+func isFull(es *elevator.ElevatorStatus) bool {
+	return es.MaxCapacity > 0 && es.CommittedLoad+1 > es.MaxCapacity
+}
+
+// Returns the elevator with the lowest committed load relative to its capacity.
+// An elevator without a published capacity is never full, so it counts as unloaded.
+// Ties go to the elevator closest to the passenger, then to the lowest id.
+func getLeastLoadedId(statuses map[int]*elevator.ElevatorStatus, p *passenger.Passenger) int {
+
+	leastLoadedId := -1
+	leastLoad := math.MaxFloat64
+	closestInFloors := math.MaxInt32
+
+	for id, es := range statuses {
+		var load float64
+		if es.MaxCapacity > 0 {
+			load = float64(es.CommittedLoad) / float64(es.MaxCapacity)
+		}
+
+		test := util.Abs(es.CurrentFloor - p.CurrentFloor)
+		if load < leastLoad || (load == leastLoad && test < closestInFloors) ||
+			(load == leastLoad && test == closestInFloors && id < leastLoadedId) {
+			leastLoadedId = id
+			leastLoad = load
+			closestInFloors = test
+		}
+	}
+
+	return leastLoadedId
 }
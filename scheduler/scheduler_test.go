@@ -3,6 +3,7 @@ package scheduler
 import (
 	_ "fmt"
 	"testing"
+	"time"
 
 	"github.com/davepersing/elevator-platform/elevator"
 	"github.com/davepersing/elevator-platform/passenger"
@@ -290,3 +291,364 @@ func TestClosestTargetFloor3(t *testing.T) {
 		t.Errorf("Got %d but wanted >= 0", closestId)
 	}
 }
+
+// ====================== Registry ========================
+
+func TestGetDefaultScheduler(t *testing.T) {
+	s, err := Get(DEFAULT_SCHEDULER)
+	if err != nil {
+		t.Fatalf("Expected default scheduler to be registered.  Error: %v", err)
+	}
+
+	if _, ok := s.(NearestScheduler); !ok {
+		t.Errorf("Expected NearestScheduler but got %T", s)
+	}
+}
+
+func TestGetUnknownScheduler(t *testing.T) {
+	if _, err := Get("does-not-exist"); err == nil {
+		t.Error("Expected an error for an unknown scheduler.")
+	}
+}
+
+func TestNearestSchedulerReason(t *testing.T) {
+	statuses := make(map[int]*elevator.ElevatorStatus)
+	statuses[0] = &elevator.ElevatorStatus{
+		Id:           0,
+		GroupId:      0,
+		CurrentFloor: 1,
+		CurrentState: elevator.STATE_IDLE,
+	}
+	statuses[1] = &elevator.ElevatorStatus{
+		Id:           1,
+		GroupId:      0,
+		CurrentFloor: 16,
+		CurrentState: elevator.STATE_MAINTENANCE,
+	}
+
+	a := NearestScheduler{}.FindElevator(statuses, &passenger.Passenger{CurrentFloor: 8, DestinationFloor: 16})
+	if a.ElevatorId != 0 || a.Reason != REASON_CLOSEST_IDLE {
+		t.Errorf("Got elevator %d for reason %s but wanted 0 for reason %s", a.ElevatorId, a.Reason, REASON_CLOSEST_IDLE)
+	}
+}
+
+func TestNearestSchedulerUnavailable(t *testing.T) {
+	statuses := make(map[int]*elevator.ElevatorStatus)
+	statuses[0] = &elevator.ElevatorStatus{
+		Id:           0,
+		GroupId:      0,
+		CurrentFloor: 1,
+		CurrentState: elevator.STATE_ERROR,
+	}
+
+	a := NearestScheduler{}.FindElevator(statuses, &passenger.Passenger{CurrentFloor: 8, DestinationFloor: 16})
+	if a.ElevatorId != -1 || a.GroupId != -1 || a.Reason != REASON_UNAVAILABLE {
+		t.Errorf("Expected unavailable assignment but got %+v", a)
+	}
+}
+
+func TestNearestSchedulerSkipsDrainingElevators(t *testing.T) {
+	statuses := make(map[int]*elevator.ElevatorStatus)
+	statuses[0] = &elevator.ElevatorStatus{
+		Id:                   0,
+		GroupId:              0,
+		CurrentFloor:         8,
+		CurrentState:         elevator.STATE_MOVING_UP,
+		MaintenanceRequested: true,
+	}
+	statuses[1] = &elevator.ElevatorStatus{
+		Id:           1,
+		GroupId:      0,
+		CurrentFloor: 9,
+		CurrentState: elevator.STATE_DRAINING,
+	}
+	statuses[2] = &elevator.ElevatorStatus{
+		Id:           2,
+		GroupId:      0,
+		CurrentFloor: 16,
+		CurrentState: elevator.STATE_IDLE,
+	}
+
+	a := NearestScheduler{}.FindElevator(statuses, &passenger.Passenger{CurrentFloor: 8, DestinationFloor: 16})
+	if a.ElevatorId != 2 {
+		t.Errorf("Expected elevator 2 while 0 and 1 drain for maintenance but got %d", a.ElevatorId)
+	}
+}
+
+// ====================== Capacity ========================
+
+func TestSkipFullElevator(t *testing.T) {
+	statuses := make(map[int]*elevator.ElevatorStatus)
+	statuses[0] = &elevator.ElevatorStatus{
+		Id:            0,
+		GroupId:       0,
+		CurrentFloor:  8,
+		CurrentState:  elevator.STATE_IDLE,
+		MaxCapacity:   16,
+		CommittedLoad: 16,
+	}
+	statuses[1] = &elevator.ElevatorStatus{
+		Id:            1,
+		GroupId:       0,
+		CurrentFloor:  16,
+		CurrentState:  elevator.STATE_IDLE,
+		MaxCapacity:   16,
+		CommittedLoad: 3,
+	}
+
+	a := NearestScheduler{}.FindElevator(statuses, &passenger.Passenger{CurrentFloor: 8, DestinationFloor: 1})
+	if a.ElevatorId != 1 {
+		t.Errorf("Got %d but wanted 1", a.ElevatorId)
+	}
+}
+
+func TestAllElevatorsFull(t *testing.T) {
+	statuses := make(map[int]*elevator.ElevatorStatus)
+	statuses[0] = &elevator.ElevatorStatus{
+		Id:            0,
+		GroupId:       0,
+		CurrentFloor:  8,
+		CurrentState:  elevator.STATE_MOVING_UP,
+		MaxCapacity:   16,
+		CommittedLoad: 30,
+	}
+	statuses[1] = &elevator.ElevatorStatus{
+		Id:            1,
+		GroupId:       0,
+		CurrentFloor:  16,
+		CurrentState:  elevator.STATE_MOVING_DOWN,
+		MaxCapacity:   16,
+		CommittedLoad: 17,
+	}
+
+	a := NearestScheduler{}.FindElevator(statuses, &passenger.Passenger{CurrentFloor: 8, DestinationFloor: 1})
+	if a.ElevatorId != 1 || a.Reason != REASON_ALL_FULL {
+		t.Errorf("Got elevator %d for reason %s but wanted 1 for reason %s", a.ElevatorId, a.Reason, REASON_ALL_FULL)
+	}
+}
+
+func TestAllElevatorsFullComparesLoadToCapacity(t *testing.T) {
+	statuses := make(map[int]*elevator.ElevatorStatus)
+	statuses[0] = &elevator.ElevatorStatus{
+		Id:            0,
+		GroupId:       0,
+		CurrentFloor:  8,
+		CurrentState:  elevator.STATE_MOVING_UP,
+		MaxCapacity:   8,
+		CommittedLoad: 10,
+	}
+	statuses[1] = &elevator.ElevatorStatus{
+		Id:            1,
+		GroupId:       0,
+		CurrentFloor:  16,
+		CurrentState:  elevator.STATE_MOVING_DOWN,
+		MaxCapacity:   32,
+		CommittedLoad: 36,
+	}
+
+	// Elevator 1 is 4 passengers over to elevator 0's 2, but it's only 12% over capacity to elevator 0's 25%.
+	a := NearestScheduler{}.FindElevator(statuses, &passenger.Passenger{CurrentFloor: 8, DestinationFloor: 1})
+	if a.ElevatorId != 1 || a.Reason != REASON_ALL_FULL {
+		t.Errorf("Got elevator %d for reason %s but wanted 1 for reason %s", a.ElevatorId, a.Reason, REASON_ALL_FULL)
+	}
+}
+
+func TestAllElevatorsFullTiesGoToClosest(t *testing.T) {
+	statuses := make(map[int]*elevator.ElevatorStatus)
+	statuses[0] = &elevator.ElevatorStatus{
+		Id:            0,
+		GroupId:       0,
+		CurrentFloor:  16,
+		CurrentState:  elevator.STATE_MOVING_UP,
+		MaxCapacity:   8,
+		CommittedLoad: 8,
+	}
+	statuses[1] = &elevator.ElevatorStatus{
+		Id:            1,
+		GroupId:       0,
+		CurrentFloor:  9,
+		CurrentState:  elevator.STATE_MOVING_DOWN,
+		MaxCapacity:   16,
+		CommittedLoad: 16,
+	}
+
+	a := NearestScheduler{}.FindElevator(statuses, &passenger.Passenger{CurrentFloor: 8, DestinationFloor: 1})
+	if a.ElevatorId != 1 {
+		t.Errorf("Got %d but wanted the closer elevator 1", a.ElevatorId)
+	}
+}
+
+func TestFindElevatorLeavesStatusesUntouched(t *testing.T) {
+	statuses := make(map[int]*elevator.ElevatorStatus)
+	statuses[0] = &elevator.ElevatorStatus{
+		Id:           0,
+		GroupId:      0,
+		CurrentFloor: 1,
+		CurrentState: elevator.STATE_MAINTENANCE,
+	}
+	statuses[1] = &elevator.ElevatorStatus{
+		Id:           1,
+		GroupId:      0,
+		CurrentFloor: 4,
+		CurrentState: elevator.STATE_IDLE,
+	}
+
+	NearestScheduler{}.FindElevator(statuses, &passenger.Passenger{CurrentFloor: 8, DestinationFloor: 16})
+	EtaScheduler{}.FindElevator(statuses, &passenger.Passenger{CurrentFloor: 8, DestinationFloor: 16})
+	if len(statuses) != 2 {
+		t.Errorf("Expected the caller's 2 statuses to be kept but got %d", len(statuses))
+	}
+}
+
+// ====================== Served Floors ========================
+
+func TestSkipElevatorNotServingDestination(t *testing.T) {
+	statuses := make(map[int]*elevator.ElevatorStatus)
+	statuses[0] = &elevator.ElevatorStatus{
+		Id:           0,
+		GroupId:      0,
+		CurrentFloor: 1,
+		CurrentState: elevator.STATE_IDLE,
+		ServedFloors: elevator.ServedFloors{Ranges: []elevator.FloorRange{{Min: 1, Max: 16}}},
+	}
+	statuses[1] = &elevator.ElevatorStatus{
+		Id:           1,
+		GroupId:      0,
+		CurrentFloor: 40,
+		CurrentState: elevator.STATE_IDLE,
+		ServedFloors: elevator.ServedFloors{Ranges: []elevator.FloorRange{{Min: 1, Max: 1}, {Min: 17, Max: 40}}},
+	}
+
+	a := NearestScheduler{}.FindElevator(statuses, &passenger.Passenger{CurrentFloor: 1, DestinationFloor: 30})
+	if a.ElevatorId != 1 {
+		t.Errorf("Got %d but wanted 1", a.ElevatorId)
+	}
+
+	a = NearestScheduler{}.FindElevator(statuses, &passenger.Passenger{CurrentFloor: 10, DestinationFloor: 30})
+	if a.ElevatorId != -1 || a.Reason != REASON_NOT_SERVED {
+		t.Errorf("Expected no serving elevator but got %+v", a)
+	}
+}
+
+func TestFindTransferFloor(t *testing.T) {
+	statuses := []*elevator.ElevatorStatus{
+		{Id: 0, ServedFloors: elevator.ServedFloors{Ranges: []elevator.FloorRange{{Min: 1, Max: 20}}}},
+		{Id: 1, ServedFloors: elevator.ServedFloors{Ranges: []elevator.FloorRange{{Min: 1, Max: 1}, {Min: 20, Max: 40}}}},
+	}
+
+	// Floors 1 and 20 are served by both, but changing at 20 is the shorter ride.
+	floor := FindTransferFloor(statuses, &passenger.Passenger{CurrentFloor: 10, DestinationFloor: 30})
+	if floor != 20 {
+		t.Errorf("Got transfer floor %d but wanted 20", floor)
+	}
+
+	floor = FindTransferFloor(statuses, &passenger.Passenger{CurrentFloor: 10, DestinationFloor: 50})
+	if floor != -1 {
+		t.Errorf("Got transfer floor %d but wanted -1", floor)
+	}
+}
+
+// ====================== ETA ========================
+
+func TestGetEtaScheduler(t *testing.T) {
+	s, err := New("eta", Options{FloorTravelTime: 2 * time.Second, DwellTime: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("Expected eta scheduler to be registered.  Error: %v", err)
+	}
+
+	eta, ok := s.(EtaScheduler)
+	if !ok {
+		t.Fatalf("Expected EtaScheduler but got %T", s)
+	}
+
+	if eta.FloorTravelTime != 2*time.Second || eta.DwellTime != 5*time.Second {
+		t.Errorf("Expected options to be passed to the scheduler but got %+v", eta.Options)
+	}
+}
+
+func TestEstimateIdle(t *testing.T) {
+	opts := Options{FloorTravelTime: time.Second, DwellTime: 3 * time.Second}
+	es := &elevator.ElevatorStatus{CurrentFloor: 1, CurrentState: elevator.STATE_IDLE}
+
+	// 4 floors to the pickup, a stop, then 4 floors to the destination.
+	pickup, arrival := opts.Estimate(es, &passenger.Passenger{CurrentFloor: 5, DestinationFloor: 9})
+	if pickup != 4*time.Second || arrival != 11*time.Second {
+		t.Errorf("Got pickup %v and arrival %v but wanted 4s and 11s", pickup, arrival)
+	}
+}
+
+func TestEstimateIncludesPendingStops(t *testing.T) {
+	opts := Options{FloorTravelTime: time.Second, DwellTime: 3 * time.Second}
+	es := &elevator.ElevatorStatus{
+		CurrentFloor: 1,
+		CurrentState: elevator.STATE_MOVING_UP,
+		Passengers:   []*passenger.Passenger{{DestinationFloor: 3}},
+		WaitingPassengers: elevator.WaitingPassengers{
+			Waiting: []*passenger.Passenger{{CurrentFloor: 7, DestinationFloor: 2}},
+		},
+	}
+
+	// Up to 3 to drop off, 5 to pick up, stop at 7, then back down to 2.
+	pickup, arrival := opts.Estimate(es, &passenger.Passenger{CurrentFloor: 5, DestinationFloor: 2})
+	if pickup != 7*time.Second || arrival != 20*time.Second {
+		t.Errorf("Got pickup %v and arrival %v but wanted 7s and 20s", pickup, arrival)
+	}
+}
+
+func TestEtaSchedulerAvoidsBusyElevator(t *testing.T) {
+	opts := Options{FloorTravelTime: time.Second, DwellTime: 10 * time.Second}
+	statuses := make(map[int]*elevator.ElevatorStatus)
+
+	// Closest to the passenger and moving their way, but with a stop to make first.
+	statuses[0] = &elevator.ElevatorStatus{
+		Id:                 0,
+		CurrentFloor:       7,
+		CurrentState:       elevator.STATE_MOVING_DOWN,
+		CurrentTargetFloor: 6,
+		Passengers:         []*passenger.Passenger{{DestinationFloor: 6}},
+	}
+	statuses[1] = &elevator.ElevatorStatus{
+		Id:           1,
+		CurrentFloor: 1,
+		CurrentState: elevator.STATE_IDLE,
+	}
+
+	p := &passenger.Passenger{CurrentFloor: 5, DestinationFloor: 1}
+
+	nearest := NearestScheduler{Options: opts}.FindElevator(statuses, p)
+	if nearest.ElevatorId != 0 {
+		t.Errorf("Got elevator %d but wanted 0 from nearest", nearest.ElevatorId)
+	}
+
+	a := EtaScheduler{Options: opts}.FindElevator(statuses, p)
+	if a.ElevatorId != 1 || a.Reason != REASON_LOWEST_ETA {
+		t.Errorf("Got elevator %d for reason %s but wanted 1 for reason %s", a.ElevatorId, a.Reason, REASON_LOWEST_ETA)
+	}
+
+	if a.EstimatedPickup != 4*time.Second || a.EstimatedArrival != 18*time.Second {
+		t.Errorf("Got pickup %v and arrival %v but wanted 4s and 18s", a.EstimatedPickup, a.EstimatedArrival)
+	}
+}
+
+func TestEtaSchedulerTiesGoToLowestId(t *testing.T) {
+	statuses := make(map[int]*elevator.ElevatorStatus)
+	statuses[2] = &elevator.ElevatorStatus{Id: 2, CurrentFloor: 3, CurrentState: elevator.STATE_IDLE}
+	statuses[1] = &elevator.ElevatorStatus{Id: 1, CurrentFloor: 7, CurrentState: elevator.STATE_IDLE}
+
+	for i := 0; i < 10; i++ {
+		a := EtaScheduler{Options: DefaultOptions()}.FindElevator(statuses, &passenger.Passenger{CurrentFloor: 5, DestinationFloor: 5})
+		if a.ElevatorId != 1 {
+			t.Fatalf("Got elevator %d but wanted 1", a.ElevatorId)
+		}
+	}
+}
+
+func TestEtaSchedulerUnavailable(t *testing.T) {
+	statuses := make(map[int]*elevator.ElevatorStatus)
+	statuses[0] = &elevator.ElevatorStatus{Id: 0, CurrentFloor: 1, CurrentState: elevator.STATE_MAINTENANCE}
+
+	a := EtaScheduler{}.FindElevator(statuses, &passenger.Passenger{CurrentFloor: 8, DestinationFloor: 16})
+	if a.ElevatorId != -1 || a.Reason != REASON_UNAVAILABLE {
+		t.Errorf("Expected unavailable assignment but got %+v", a)
+	}
+}
@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"math"
+	"sort"
+
+	"github.com/davepersing/elevator-platform/elevator"
+	"github.com/davepersing/elevator-platform/passenger"
+	"github.com/davepersing/elevator-platform/util"
+)
+
+// Returns true if the elevator stops at both the passenger's current and destination floors.
+func ServesTrip(es *elevator.ElevatorStatus, p *passenger.Passenger) bool {
+	return es.ServedFloors.Serves(p.CurrentFloor) && es.ServedFloors.Serves(p.DestinationFloor)
+}
+
+// Returns true if any of the elevators stops at both the passenger's current and destination floors.
+func AnyServesTrip(statuses []*elevator.ElevatorStatus, p *passenger.Passenger) bool {
+	for _, es := range statuses {
+		if ServesTrip(es, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Suggests a floor to change elevators at for a trip no single elevator can serve.
+// The passenger rides one elevator from their current floor to the transfer floor,
+// and another from the transfer floor to their destination.
+// Returns the transfer floor with the shortest total ride, or -1 if there isn't one.
+func FindTransferFloor(statuses []*elevator.ElevatorStatus, p *passenger.Passenger) int {
+
+	// Every floor at least one elevator stops at.
+	candidates := make(map[int]bool)
+	for _, es := range statuses {
+		for _, floor := range es.ServedFloors.Floors() {
+			candidates[floor] = true
+		}
+	}
+
+	floors := make([]int, 0, len(candidates))
+	for floor := range candidates {
+		floors = append(floors, floor)
+	}
+	sort.Ints(floors)
+
+	transferFloor := -1
+	shortestRide := math.MaxInt32
+	for _, floor := range floors {
+		if floor == p.CurrentFloor || floor == p.DestinationFloor {
+			continue
+		}
+
+		firstLeg := &passenger.Passenger{CurrentFloor: p.CurrentFloor, DestinationFloor: floor}
+		secondLeg := &passenger.Passenger{CurrentFloor: floor, DestinationFloor: p.DestinationFloor}
+		if !AnyServesTrip(statuses, firstLeg) || !AnyServesTrip(statuses, secondLeg) {
+			continue
+		}
+
+		// Floors are sorted, so ties go to the lowest floor.
+		ride := util.Abs(p.CurrentFloor-floor) + util.Abs(floor-p.DestinationFloor)
+		if ride < shortestRide {
+			transferFloor = floor
+			shortestRide = ride
+		}
+	}
+
+	return transferFloor
+}
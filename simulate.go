@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/davepersing/elevator-platform/door"
+	"github.com/davepersing/elevator-platform/group"
+	"github.com/davepersing/elevator-platform/motion"
+	"github.com/davepersing/elevator-platform/scheduler"
+	"github.com/davepersing/elevator-platform/simulator"
+	"github.com/davepersing/elevator-platform/traffic"
+)
+
+// Runs `elevator-platform simulate [flags]`.
+// Simulates the building against one of the traffic profiles with virtual time, then prints the run's KPIs.
+// Returns the exit code.
+func runSimulation(args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+
+	var groupCount = fs.Int("groups", 1, "Number of elevator groups to simulate.")
+	var elevatorCount = fs.Int("elevators", 2, "Number of elevators in each group.")
+	var bottomFloor = fs.Int("bottom-floor", 1, "The bottom floor the elevators can access.")
+	var topFloor = fs.Int("top-floor", 16, "The top floor the elevators can access.")
+	var maxCapacity = fs.Int("capacity", 16, "The maximum number of persons an elevator can carry at one time.")
+	var groupSpec = fs.String("group-spec", "", "Each group as elevators:bottom-top, separated by commas.  e.g. 4:1-20,4:1-40")
+	var skipFloors = fs.String("skip-floors", "", "Floors no elevator stops at, separated by commas.  e.g. 13")
+	var schedulerName = fs.String("scheduler", scheduler.DEFAULT_SCHEDULER,
+		"The dispatch strategy under test.  One of: "+strings.Join(scheduler.Names(), ", "))
+	var floorTravelTime = fs.Duration("floor-travel-time", scheduler.DEFAULT_FLOOR_TRAVEL_TIME, "The time an elevator takes to travel one floor.  Used to estimate arrival times.")
+	var dwellTime = fs.Duration("dwell-time", scheduler.DEFAULT_DWELL_TIME, "The time an elevator spends stopped at a floor.  Used to estimate arrival times.")
+	var doorOpenTime = fs.Duration("door-open-time", 0, "The time the doors take to open.")
+	var doorDwellTime = fs.Duration("door-dwell-time", 0, "The time the doors stay open before closing.")
+	var doorCloseTime = fs.Duration("door-close-time", 0, "The time the doors take to close.")
+	var speed = fs.Float64("speed", 0, "The rated speed of the elevators in meters per second.  0 moves one floor per second.")
+	var acceleration = fs.Float64("acceleration", 0, "The acceleration of the elevators in meters per second squared.")
+	var deceleration = fs.Float64("deceleration", 0, "The deceleration of the elevators in meters per second squared.  Defaults to the acceleration.")
+	var floorHeight = fs.Float64("floor-height", 3, "The height of each floor in meters.")
+	var profileName = fs.String("profile", traffic.PROFILE_INTER_FLOOR, "The traffic pattern.  One of: "+strings.Join(traffic.Names(), ", "))
+	var lobby = fs.Int("lobby", 0, "The lobby floor for up-peak, down-peak and lunch traffic.  Defaults to the lowest floor.")
+	var rate = fs.Float64("rate", 120, "Passengers calling an elevator per hour.")
+	var duration = fs.Duration("duration", time.Hour, "How long passengers keep arriving for.")
+	var drainTime = fs.Duration("drain-time", simulator.DEFAULT_DRAIN_TIME, "How long to keep running after the last arrival so riders can reach their floors.")
+	var seed = fs.Int64("seed", 1, "Seeds the random traffic.  The same seed always gives the same run.")
+	var replayPath = fs.String("replay", "", "Replays the calls recorded in this JSONL file instead of generating traffic.")
+	var recordsPath = fs.String("records", "", "Writes a JSON record of every passenger to this file, one per line.  - writes to stdout.")
+
+	fs.Parse(args)
+
+	motionProfile := motion.Profile{Speed: *speed, Acceleration: *acceleration, Deceleration: *deceleration, FloorHeight: *floorHeight}
+	if motionProfile.Enabled() && !flagSet(fs, "floor-travel-time") {
+		*floorTravelTime = time.Duration(*floorHeight / *speed * float64(time.Second))
+	}
+
+	sched, err := scheduler.New(*schedulerName, scheduler.Options{FloorTravelTime: *floorTravelTime, DwellTime: *dwellTime})
+	if err != nil {
+		fmt.Printf("Cannot simulate elevators.  Error: %s\n", err.Error())
+		return 1
+	}
+
+	var groups []*group.Group
+	if *groupSpec != "" {
+		groups, err = group.Parse(*groupSpec, 0)
+	} else {
+		groups, err = group.Uniform(*groupCount, *elevatorCount, *bottomFloor, *topFloor, 0)
+	}
+	if err != nil {
+		fmt.Printf("Cannot simulate elevators.  Error: %s\n", err.Error())
+		return 1
+	}
+
+	skip, err := group.ParseFloors(*skipFloors)
+	if err != nil {
+		fmt.Printf("Cannot simulate elevators.  Error: %s\n", err.Error())
+		return 1
+	}
+
+	for _, g := range groups {
+		g.ServedFloors.Skip = skip
+	}
+
+	cfg := simulator.Config{
+		Groups:      groups,
+		MaxCapacity: *maxCapacity,
+		DoorTimings: door.Timings{OpenTime: *doorOpenTime, DwellTime: *doorDwellTime, CloseTime: *doorCloseTime},
+		Motion:      motionProfile,
+		Scheduler:   sched,
+		DrainTime:   *drainTime,
+	}
+
+	floors := servedFloors(groups)
+	if len(floors) == 0 {
+		fmt.Println("Cannot simulate elevators.  Error: No floors are served.")
+		return 1
+	}
+
+	if !flagSet(fs, "lobby") {
+		*lobby = floors[0]
+	}
+
+	var src traffic.Source
+	if *replayPath != "" {
+		if src, err = readReplay(*replayPath); err != nil {
+			fmt.Printf("Cannot simulate elevators.  Error: %s\n", err.Error())
+			return 1
+		}
+	} else {
+		profile, err := traffic.Named(*profileName, *lobby, floors, *rate, *duration)
+		if err != nil {
+			fmt.Printf("Cannot simulate elevators.  Error: %s\n", err.Error())
+			return 1
+		}
+		src = traffic.New(profile, *seed)
+	}
+
+	result, err := simulator.Run(cfg, src)
+	if err != nil {
+		fmt.Printf("Cannot simulate elevators.  Error: %s\n", err.Error())
+		return 1
+	}
+
+	if *recordsPath != "" {
+		if err := writeRecords(*recordsPath, result.Records); err != nil {
+			fmt.Printf("Could not write passenger records.  Error: %s\n", err.Error())
+			return 1
+		}
+	}
+
+	// Keep the summary out of the records when they go to stdout.
+	out := os.Stdout
+	if *recordsPath == "-" {
+		out = os.Stderr
+	}
+
+	printSummary(out, *schedulerName, result.Summary)
+	return 0
+}
+
+// Returns every floor served by at least one group, from lowest to highest.
+func servedFloors(groups []*group.Group) []int {
+	bottomFloor, topFloor := groups[0].MinFloor, groups[0].MaxFloor
+	for _, g := range groups {
+		if g.MinFloor < bottomFloor {
+			bottomFloor = g.MinFloor
+		}
+		if g.MaxFloor > topFloor {
+			topFloor = g.MaxFloor
+		}
+	}
+
+	var floors []int
+	for floor := bottomFloor; floor <= topFloor; floor++ {
+		for _, g := range groups {
+			if g.Serves(floor) {
+				floors = append(floors, floor)
+				break
+			}
+		}
+	}
+	return floors
+}
+
+// Writes the passenger records as JSON, one per line.  A path of - writes to stdout.
+func writeRecords(path string, records []*simulator.Record) error {
+	w := os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	encoder := json.NewEncoder(w)
+	for _, r := range records {
+		if err := encoder.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prints the KPIs of a run.
+func printSummary(w io.Writer, schedulerName string, s simulator.Summary) {
+	fmt.Fprintf(w, "Scheduler:       %s\n", schedulerName)
+	fmt.Fprintf(w, "Simulated time:  %v\n", seconds(s.Duration))
+	fmt.Fprintf(w, "Passengers:      %d (%d delivered, %d rejected)\n", s.Passengers, s.Delivered, s.Rejected)
+	fmt.Fprintf(w, "Average wait:    %v\n", seconds(s.AverageWait))
+	fmt.Fprintf(w, "95th pct wait:   %v\n", seconds(s.Wait95))
+	fmt.Fprintf(w, "Longest wait:    %v\n", seconds(s.MaxWait))
+	fmt.Fprintf(w, "Average ride:    %v\n", seconds(s.AverageRide))
+	fmt.Fprintf(w, "Throughput:      %.1f passengers/hour\n", s.Throughput)
+	fmt.Fprintf(w, "Car-kilometres:  %.3f\n", s.CarKilometers)
+}
+
+// Returns seconds as a duration rounded to the tenth of a second, for printing.
+func seconds(s float64) time.Duration {
+	return (time.Duration(s*float64(time.Second)) + 50*time.Millisecond) / (100 * time.Millisecond) * (100 * time.Millisecond)
+}
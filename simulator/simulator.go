@@ -0,0 +1,333 @@
+package simulator
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/davepersing/elevator-platform/clock"
+	"github.com/davepersing/elevator-platform/door"
+	"github.com/davepersing/elevator-platform/elevator"
+	"github.com/davepersing/elevator-platform/group"
+	"github.com/davepersing/elevator-platform/http_api"
+	"github.com/davepersing/elevator-platform/memory_store"
+	"github.com/davepersing/elevator-platform/motion"
+	"github.com/davepersing/elevator-platform/passenger"
+	"github.com/davepersing/elevator-platform/scheduler"
+	"github.com/davepersing/elevator-platform/traffic"
+)
+
+const (
+	// How long the simulation keeps running after the last arrival so riders can reach their floors.
+	DEFAULT_DRAIN_TIME = 1 * time.Hour
+
+	// The height of each floor used to measure car-kilometres when the motion profile doesn't set one.
+	DEFAULT_FLOOR_HEIGHT = 3.0 // meters
+)
+
+type (
+	// Describes the building to simulate.
+	Config struct {
+		Groups      []*group.Group      // The elevator groups in the building.
+		MaxCapacity int                 // The maximum number of persons an elevator can carry.  0 is unlimited.
+		DoorTimings door.Timings        // How long the doors of every elevator take to open, dwell and close.
+		Motion      motion.Profile      // How every elevator moves between floors.
+		Scheduler   scheduler.Scheduler // The dispatch strategy under test.  Defaults to scheduler.DEFAULT_SCHEDULER.
+		DrainTime   time.Duration       // How long to keep running after the last arrival.  Defaults to DEFAULT_DRAIN_TIME.
+		Start       time.Time           // The time of day the run starts at.  Only affects the elevators' clock.
+	}
+
+	// What happened to one passenger.  Times are in seconds from the start of the run.
+	Record struct {
+		Id string `json:"id,omitempty"` // The passenger's id, if the call was scheduled.
+
+		CurrentFloor     int `json:"currentFloor"`
+		DestinationFloor int `json:"destinationFloor"`
+
+		GroupId    int `json:"groupId"`    // The group of the elevator assigned, or -1 if the call was rejected.
+		ElevatorId int `json:"elevatorId"` // The elevator assigned, or -1 if the call was rejected.
+
+		Called   float64 `json:"called"`   // When the passenger called an elevator.
+		PickedUp float64 `json:"pickedUp"` // When the passenger boarded, or -1 if they never did.
+		Arrived  float64 `json:"arrived"`  // When the passenger got off at their floor, or -1 if they never did.
+
+		Error string `json:"error,omitempty"` // Why the call was rejected.
+	}
+
+	// Key performance indicators for a run.  Times are in seconds.
+	Summary struct {
+		Passengers int `json:"passengers"` // Passengers that called an elevator.
+		Delivered  int `json:"delivered"`  // Passengers that reached their floor.
+		Rejected   int `json:"rejected"`   // Calls no elevator could be assigned to.
+
+		AverageWait float64 `json:"averageWait"` // From call to pickup, for passengers picked up.
+		Wait95      float64 `json:"wait95"`      // 95th percentile wait.
+		MaxWait     float64 `json:"maxWait"`
+		AverageRide float64 `json:"averageRide"` // From pickup to arrival, for passengers delivered.
+
+		Duration      float64 `json:"duration"`      // Simulated time the run took.
+		Throughput    float64 `json:"throughput"`    // Passengers delivered per hour.
+		CarKilometers float64 `json:"carKilometers"` // Distance travelled by every car combined.
+	}
+
+	// The outcome of a run.
+	Result struct {
+		Records []*Record
+		Summary Summary
+	}
+
+	// A simulated elevator and the distance it has travelled.
+	car struct {
+		*elevator.Elevator
+
+		position float64 // Fractional floor the car was at after the last step.
+		meters   float64
+	}
+
+	// Runs a building of elevators against a traffic stream with virtual time.
+	simulation struct {
+		Config
+
+		clock  *clock.Fake
+		api    *http_api.HttpApi
+		cars   map[int]map[int]*car
+		riders map[string]*Record // Passengers not yet delivered, by id.
+	}
+)
+
+// Runs the building against the traffic until every passenger is delivered or the drain time runs out.
+// Every elevator is Stepped on a fake clock, so a day of traffic runs in seconds.
+// Calls are dispatched through the same code as POST /elevator_call.
+func Run(cfg Config, src traffic.Source) (*Result, error) {
+	if len(cfg.Groups) == 0 {
+		return nil, errors.New("At least one group is required.")
+	}
+
+	if cfg.Scheduler == nil {
+		s, err := scheduler.Get(scheduler.DEFAULT_SCHEDULER)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Scheduler = s
+	}
+
+	if cfg.DrainTime <= 0 {
+		cfg.DrainTime = DEFAULT_DRAIN_TIME
+	}
+
+	s := &simulation{Config: cfg, clock: clock.NewFake(cfg.Start), riders: make(map[string]*Record)}
+	s.initElevators()
+
+	var records []*Record
+	at, p, more := src.Next()
+
+	var now, lastArrival time.Duration
+	for ; more || (len(s.riders) > 0 && now <= lastArrival+s.DrainTime); now += elevator.TICK_INTERVAL {
+		// Dispatch everyone who called since the last step.
+		for more && at <= now {
+			records = append(records, s.dispatch(at, p))
+			lastArrival = at
+			at, p, more = src.Next()
+		}
+
+		s.step()
+		s.clock.Advance(elevator.TICK_INTERVAL)
+	}
+
+	return &Result{Records: records, Summary: summarize(records, now, s.carMeters())}, nil
+}
+
+// Creates a Stepped elevator for every car in every group, sharing one in-process store.
+func (s *simulation) initElevators() {
+	st := &memory_store.MemoryStore{Clock: s.clock}
+	st.Init()
+
+	s.api = &http_api.HttpApi{Store: st, Scheduler: s.Scheduler, Groups: s.Groups, Clock: s.clock}
+	s.cars = make(map[int]map[int]*car)
+
+	for _, g := range s.Groups {
+		s.cars[g.Id] = make(map[int]*car)
+
+		for i := 0; i < g.ElevatorCount; i++ {
+			e := &elevator.Elevator{
+				MaxFloor:    g.MaxFloor,
+				MinFloor:    g.MinFloor,
+				MaxCapacity: s.MaxCapacity,
+				Doors:       door.Door{Timings: s.DoorTimings},
+				Motion:      s.Motion,
+				Store:       st,
+				Clock:       s.clock,
+				Stepped:     true,
+				ElevatorStatus: elevator.ElevatorStatus{
+					ServedFloors:      g.ServedFloors,
+					DisplayId:         i + 1,
+					GroupId:           g.Id,
+					Id:                i,
+					CurrentFloor:      g.MinFloor,
+					CurrentState:      elevator.STATE_IDLE,
+					WaitingPassengers: elevator.WaitingPassengers{Waiting: make([]*passenger.Passenger, 0)},
+					Passengers:        make([]*passenger.Passenger, 0),
+				},
+			}
+			e.Init()
+
+			s.cars[g.Id][i] = &car{Elevator: e, position: float64(g.MinFloor)}
+		}
+	}
+}
+
+// Dispatches a passenger's call and starts following them.
+func (s *simulation) dispatch(at time.Duration, p passenger.Passenger) *Record {
+	r := &Record{
+		CurrentFloor:     p.CurrentFloor,
+		DestinationFloor: p.DestinationFloor,
+		GroupId:          -1,
+		ElevatorId:       -1,
+		Called:           at.Seconds(),
+		PickedUp:         -1,
+		Arrived:          -1,
+	}
+
+	// A new call, as POST /elevator_call would see it.  The id and timestamps are the server's to set.
+	p = passenger.Passenger{CurrentFloor: p.CurrentFloor, DestinationFloor: p.DestinationFloor}
+
+	success, err := s.api.Dispatch(&p)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+
+	r.Id = success.PassengerId
+	r.GroupId, _ = strconv.Atoi(success.GroupId)
+	r.ElevatorId, _ = strconv.Atoi(success.ElevatorId)
+	s.riders[r.Id] = r
+
+	return r
+}
+
+// Moves every elevator one step, then records who boarded, who got off, and how far each car went.
+// Boarding and arrival times are read from the passengers' records, which the elevators timestamp on the fake clock.
+func (s *simulation) step() {
+	for _, cars := range s.cars {
+		for _, c := range cars {
+			c.Step()
+
+			position := c.Position
+			c.meters += math.Abs(s.height(position) - s.height(c.position))
+			c.position = position
+		}
+	}
+
+	for id, r := range s.riders {
+		data, err := s.api.Store.GetPassenger(id)
+		if err != nil || data == nil {
+			continue
+		}
+
+		var p passenger.Passenger
+		if err := json.Unmarshal(data, &p); err != nil {
+			continue
+		}
+
+		if !p.PickedUpAt.IsZero() {
+			r.PickedUp = s.since(p.PickedUpAt)
+		}
+
+		if !p.DroppedOffAt.IsZero() {
+			r.Arrived = s.since(p.DroppedOffAt)
+			delete(s.riders, id)
+		}
+	}
+}
+
+// Returns the seconds from the start of the run to t.
+func (s *simulation) since(t time.Time) float64 {
+	return t.Sub(s.Start).Seconds()
+}
+
+// Returns the height of a fractional floor in meters.
+func (s *simulation) height(position float64) float64 {
+	profile := s.Motion
+	if profile.FloorHeight <= 0 {
+		profile.FloorHeight = DEFAULT_FLOOR_HEIGHT
+	}
+
+	floor := int(math.Floor(position))
+	base := profile.Height(floor)
+	return base + (position-float64(floor))*(profile.Height(floor+1)-base)
+}
+
+// Returns the distance travelled by every car combined, in meters.
+func (s *simulation) carMeters() float64 {
+	meters := 0.0
+	for _, cars := range s.cars {
+		for _, c := range cars {
+			meters += c.meters
+		}
+	}
+	return meters
+}
+
+// Computes the KPIs of a run that took the given simulated time.
+func summarize(records []*Record, duration time.Duration, meters float64) Summary {
+	summary := Summary{
+		Passengers:    len(records),
+		Duration:      duration.Seconds(),
+		CarKilometers: meters / 1000,
+	}
+
+	var waits []float64
+	rides := 0.0
+	for _, r := range records {
+		if r.Error != "" {
+			summary.Rejected++
+			continue
+		}
+
+		if r.PickedUp >= 0 {
+			waits = append(waits, r.PickedUp-r.Called)
+		}
+
+		if r.Arrived >= 0 {
+			summary.Delivered++
+			rides += r.Arrived - r.PickedUp
+		}
+	}
+
+	if len(waits) > 0 {
+		sort.Float64s(waits)
+		total := 0.0
+		for _, w := range waits {
+			total += w
+		}
+		summary.AverageWait = total / float64(len(waits))
+		summary.Wait95 = percentile(waits, 95)
+		summary.MaxWait = waits[len(waits)-1]
+	}
+
+	if summary.Delivered > 0 {
+		summary.AverageRide = rides / float64(summary.Delivered)
+	}
+
+	if duration > 0 {
+		summary.Throughput = float64(summary.Delivered) / duration.Hours()
+	}
+
+	return summary
+}
+
+// Returns the pth percentile of sorted values using the nearest rank.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,128 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davepersing/elevator-platform/group"
+	"github.com/davepersing/elevator-platform/passenger"
+	"github.com/davepersing/elevator-platform/traffic"
+)
+
+type (
+	// Traffic from a fixed list of passengers.
+	listTraffic struct {
+		at         []time.Duration
+		passengers []passenger.Passenger
+	}
+)
+
+func (l *listTraffic) Next() (time.Duration, passenger.Passenger, bool) {
+	if len(l.at) == 0 {
+		return 0, passenger.Passenger{}, false
+	}
+
+	at, p := l.at[0], l.passengers[0]
+	l.at, l.passengers = l.at[1:], l.passengers[1:]
+	return at, p, true
+}
+
+func TestRunRecordsPassenger(t *testing.T) {
+	groups, _ := group.Uniform(1, 1, 1, 16, 8080)
+	cfg := Config{Groups: groups, MaxCapacity: 16}
+	src := &listTraffic{
+		at:         []time.Duration{0},
+		passengers: []passenger.Passenger{{CurrentFloor: 3, DestinationFloor: 1}},
+	}
+
+	result, err := Run(cfg, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Records) != 1 {
+		t.Fatalf("Expected 1 record but got %d", len(result.Records))
+	}
+
+	// Up 2 floors, load, down 2 floors, unload.  The doors open and close instantly.
+	r := result.Records[0]
+	if r.GroupId != 0 || r.ElevatorId != 0 || r.PickedUp != 3 || r.Arrived != 6 {
+		t.Errorf("Expected pickup at 3s and arrival at 6s on elevator 0-0 but got %+v", r)
+	}
+
+	summary := result.Summary
+	if summary.Delivered != 1 || summary.AverageWait != 3 || summary.AverageRide != 3 {
+		t.Errorf("Expected 1 delivery with a 3s wait and 3s ride but got %+v", summary)
+	}
+
+	// 2 floors up and 2 floors down, 3 meters each.
+	if summary.CarKilometers != 0.012 {
+		t.Errorf("Expected 0.012 car-kilometres but got %v", summary.CarKilometers)
+	}
+}
+
+func TestRunRejectsUnservedTrip(t *testing.T) {
+	groups, _ := group.Uniform(1, 1, 1, 16, 8080)
+	cfg := Config{Groups: groups}
+	src := &listTraffic{
+		at:         []time.Duration{0},
+		passengers: []passenger.Passenger{{CurrentFloor: 3, DestinationFloor: 30}},
+	}
+
+	result, err := Run(cfg, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Summary.Rejected != 1 || result.Records[0].Error == "" || result.Records[0].ElevatorId != -1 {
+		t.Errorf("Expected the trip to be rejected but got %+v", result.Records[0])
+	}
+}
+
+func TestRunInterFloorTraffic(t *testing.T) {
+	floors := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	groups, _ := group.Uniform(1, 2, 1, 10, 8080)
+	cfg := Config{Groups: groups, MaxCapacity: 8}
+
+	profile := traffic.Profile{{Duration: time.Hour, Matrix: traffic.InterFloor(floors, 120)}}
+
+	first, err := Run(cfg, traffic.New(profile, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary := first.Summary
+	if summary.Passengers < 90 || summary.Passengers > 150 {
+		t.Errorf("Expected about 120 passengers but got %d", summary.Passengers)
+	}
+
+	if summary.Delivered != summary.Passengers {
+		t.Errorf("Expected every passenger to be delivered but got %+v", summary)
+	}
+
+	if summary.Wait95 < summary.AverageWait || summary.MaxWait < summary.Wait95 {
+		t.Errorf("Expected average <= 95th percentile <= max wait but got %+v", summary)
+	}
+
+	// The same seed gives the same run.
+	second, err := Run(cfg, traffic.New(profile, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.Summary != first.Summary {
+		t.Errorf("Expected the same summary from the same seed but got %+v and %+v", first.Summary, second.Summary)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	if p := percentile(values, 95); p != 10 {
+		t.Errorf("Expected 10 but got %v", p)
+	}
+
+	if p := percentile(values, 50); p != 5 {
+		t.Errorf("Expected 5 but got %v", p)
+	}
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	// Connection states reported by a watcher.
+	WATCHER_CONNECTED    = "connected"
+	WATCHER_RECONNECTING = "reconnecting"
+)
+
+type (
+	// Defines the data store backing the elevator system.
+	// Elevators are identified by the key returned from Key.  All values are opaque JSON.
+	Store interface {
+		// Connects to the store.  Safe to call more than once.
+		Init() error
+
+		// Returns the persisted state of an elevator, or nil if none has been saved.
+		GetState(key string) ([]byte, error)
+
+		// Saves the state of an elevator, and its status with a time-to-live.
+		// The status disappears if it isn't saved again before the ttl expires.
+		SetStatus(key string, data []byte, ttl time.Duration) error
+
+		// Returns the statuses of all elevators that are still alive.
+		GetAllStatuses() ([][]byte, error)
+
+		// Returns the persisted states of all elevators, alive or not.
+		GetAllStates() ([][]byte, error)
+
+		// Calls fn with the key and status of every live elevator, then with every status saved after.
+		// data is nil when an elevator's status expires.  Returns immediately.
+		WatchStatuses(fn func(key string, data []byte), state func(string))
+
+		// Appends a call to the end of an elevator's waiting queue.
+		// Returns the id of the queued call.
+		EnqueueCall(key string, data []byte) (string, error)
+
+		// Removes a call from an elevator's waiting queue once it has been consumed.
+		AckCall(key string, c *Call) error
+
+		// Returns the calls still in an elevator's waiting queue, in order.
+		PendingCalls(key string) ([]*Call, error)
+
+		// Calls fn, in order, with every call already in an elevator's waiting queue and every call queued after.
+		// Returns immediately.  A call may be delivered more than once if the watcher has to re-read the queue,
+		// so consumers should skip calls with an index they have already seen.
+		WatchCalls(key string, fn func(*Call), state func(string))
+
+		// Sets the maintenance mode of an elevator.
+		SetMaintenanceMode(key string, mode string) error
+
+		// Calls fn with the current maintenance mode of an elevator, if set, and every change after.
+		// Returns immediately.
+		WatchMaintenance(key string, fn func(string), state func(string))
+
+		// Saves the record of a passenger's trip.  The record disappears if it isn't saved again before the ttl expires.
+		SavePassenger(id string, data []byte, ttl time.Duration) error
+
+		// Returns the record of a passenger's trip, or nil if there is none.
+		GetPassenger(id string) ([]byte, error)
+
+		// Returns the assignment record of every elevator that has one, by elevator key.
+		GetAssignments() (map[string]*Versioned, error)
+
+		// Replaces an elevator's assignment record, but only if its version is still version.
+		// A version of 0 only succeeds if the elevator has no record yet.
+		// Returns false if another write got there first.
+		SwapAssignment(key string, data []byte, version int64) (bool, error)
+	}
+
+	// A record and the version it was read at.  The version changes every time the record is written.
+	Versioned struct {
+		Data    []byte
+		Version int64
+	}
+
+	// A call waiting in an elevator's queue.
+	Call struct {
+		Id    string // Identifies the call within the store.
+		Index uint64 // Position in the queue.  Later calls always have a higher index.
+		Data  []byte
+	}
+)
+
+// Returns the key uniquely identifying an elevator in the cluster.
+func Key(groupId, elevatorId int) string {
+	return strconv.Itoa(groupId) + "-" + strconv.Itoa(elevatorId)
+}
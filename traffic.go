@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davepersing/elevator-platform/elevator"
+	"github.com/davepersing/elevator-platform/group"
+	"github.com/davepersing/elevator-platform/passenger"
+	"github.com/davepersing/elevator-platform/traffic"
+	"github.com/davepersing/elevator-platform/util"
+)
+
+// Runs `elevator-platform traffic [flags]`.
+// Plays one of the traffic profiles against a running cluster through POST /elevator_call in real time.
+// Returns the exit code.
+func runTraffic(args []string) int {
+	fs := flag.NewFlagSet("traffic", flag.ExitOnError)
+
+	var bottomFloor = fs.Int("bottom-floor", 1, "The bottom floor passengers travel from or to.")
+	var topFloor = fs.Int("top-floor", 16, "The top floor passengers travel from or to.")
+	var skipFloors = fs.String("skip-floors", "", "Floors no passenger travels from or to, separated by commas.  e.g. 13")
+	var profileName = fs.String("profile", traffic.PROFILE_INTER_FLOOR, "The traffic pattern.  One of: "+strings.Join(traffic.Names(), ", "))
+	var lobby = fs.Int("lobby", 0, "The lobby floor for up-peak, down-peak and lunch traffic.  Defaults to the bottom floor.")
+	var rate = fs.Float64("rate", 120, "Passengers calling an elevator per hour.")
+	var duration = fs.Duration("duration", time.Hour, "How long passengers keep arriving for.")
+	var seed = fs.Int64("seed", 1, "Seeds the random traffic.  The same seed always gives the same passengers.")
+	var speedup = fs.Float64("speedup", 1, "Plays the traffic this many times faster than real time.")
+	var port = fs.Int("port", 8080, "The HTTP port of the elevator to send calls to.")
+
+	fs.Parse(args)
+
+	skip, err := group.ParseFloors(*skipFloors)
+	if err != nil {
+		fmt.Printf("Cannot generate traffic.  Error: %s\n", err.Error())
+		return 1
+	}
+
+	served := elevator.ServedFloors{Ranges: []elevator.FloorRange{{Min: *bottomFloor, Max: *topFloor}}, Skip: skip}
+
+	var floors []int
+	for floor := *bottomFloor; floor <= *topFloor; floor++ {
+		if served.Serves(floor) {
+			floors = append(floors, floor)
+		}
+	}
+
+	if !flagSet(fs, "lobby") {
+		*lobby = *bottomFloor
+	}
+
+	profile, err := traffic.Named(*profileName, *lobby, floors, *rate, *duration)
+	if err != nil {
+		fmt.Printf("Cannot generate traffic.  Error: %s\n", err.Error())
+		return 1
+	}
+
+	target := ":" + strconv.Itoa(*port)
+	traffic.Play(traffic.New(profile, *seed), *speedup, func(at time.Duration, p passenger.Passenger) {
+		result, err := util.SendPassengerPost(target, p.CurrentFloor, p.DestinationFloor)
+		if err != nil {
+			fmt.Printf("%v  %d -> %d  Could not send request.  Error: %s\n", at, p.CurrentFloor, p.DestinationFloor, err.Error())
+			return
+		}
+
+		fmt.Printf("%v  %d -> %d  Take Elevator %s-%s, arriving in ~%ds.\n",
+			at, p.CurrentFloor, p.DestinationFloor, result.GroupId, result.ElevatorId, result.EstimatedPickup)
+	})
+
+	return 0
+}
@@ -0,0 +1,109 @@
+package traffic
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/davepersing/elevator-platform/passenger"
+)
+
+type (
+	// A passenger call recorded in a log, one JSON object per line.
+	// e.g. {"time": "2016-06-01T08:00:05Z", "currentFloor": 1, "destinationFloor": 12}
+	// Records dumped from GET /passengers/{id} can be replayed too.  They are timed by their calledAt.
+	Call struct {
+		passenger.Passenger
+
+		Time   time.Time `json:"time,omitempty"`   // When the passenger called.  Defaults to the passenger's calledAt.
+		Offset float64   `json:"offset,omitempty"` // Seconds from the start of the log.  Only used without a Time or calledAt.
+	}
+
+	// Plays back recorded calls in order of their call time.
+	Replay struct {
+		calls   []Call
+		offsets []time.Duration
+		next    int
+	}
+)
+
+// Reads calls from JSONL, one call per line.  Blank lines are skipped.
+// Calls with a Time are offset from the earliest Time in the log.  The rest use their Offset.
+func ReadCalls(r io.Reader) (*Replay, error) {
+	var calls []Call
+	var first time.Time
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var c Call
+		if err := json.Unmarshal([]byte(text), &c); err != nil {
+			return nil, fmt.Errorf("Line %d: %s", line, err.Error())
+		}
+
+		if c.Time.IsZero() {
+			c.Time = c.CalledAt
+		}
+
+		if !c.Time.IsZero() && (first.IsZero() || c.Time.Before(first)) {
+			first = c.Time
+		}
+		calls = append(calls, c)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	offsets := make([]time.Duration, len(calls))
+	for i, c := range calls {
+		if c.Time.IsZero() {
+			offsets[i] = time.Duration(c.Offset * float64(time.Second))
+		} else {
+			offsets[i] = c.Time.Sub(first)
+		}
+	}
+
+	// Logs from several nodes may be interleaved out of order.
+	order := make([]int, len(calls))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return offsets[order[i]] < offsets[order[j]]
+	})
+
+	replay := &Replay{}
+	for _, i := range order {
+		replay.calls = append(replay.calls, calls[i])
+		replay.offsets = append(replay.offsets, offsets[i])
+	}
+	return replay, nil
+}
+
+// Returns the next recorded passenger.
+// Only their floors are replayed.  The id, timestamps and elevator of a recorded trip are the server's to set again.
+func (r *Replay) Next() (time.Duration, passenger.Passenger, bool) {
+	if r.next >= len(r.calls) {
+		return 0, passenger.Passenger{}, false
+	}
+
+	i := r.next
+	r.next++
+
+	p := r.calls[i].Passenger
+	return r.offsets[i], passenger.Passenger{CurrentFloor: p.CurrentFloor, DestinationFloor: p.DestinationFloor}, true
+}
+
+// Returns the number of recorded calls.
+func (r *Replay) Len() int {
+	return len(r.calls)
+}
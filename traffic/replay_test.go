@@ -0,0 +1,77 @@
+package traffic
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davepersing/elevator-platform/passenger"
+)
+
+func TestReadCallsOrdersByTime(t *testing.T) {
+	log := `{"time": "2016-06-01T08:00:05Z", "currentFloor": 1, "destinationFloor": 12}
+{"time": "2016-06-01T08:00:00Z", "currentFloor": 3, "destinationFloor": 1}
+
+{"time": "2016-06-01T08:01:00Z", "currentFloor": 7, "destinationFloor": 2}
+`
+
+	replay, err := ReadCalls(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if replay.Len() != 3 {
+		t.Fatalf("Expected 3 calls but got %d", replay.Len())
+	}
+
+	times, passengers := drain(replay)
+
+	expectedTimes := []time.Duration{0, 5 * time.Second, time.Minute}
+	expected := []passenger.Passenger{{CurrentFloor: 3, DestinationFloor: 1}, {CurrentFloor: 1, DestinationFloor: 12}, {CurrentFloor: 7, DestinationFloor: 2}}
+	for i := range expected {
+		if times[i] != expectedTimes[i] || !reflect.DeepEqual(passengers[i], expected[i]) {
+			t.Errorf("Expected call %d to be %+v at %v but got %+v at %v", i, expected[i], expectedTimes[i], passengers[i], times[i])
+		}
+	}
+}
+
+func TestReadCallsWithOffsets(t *testing.T) {
+	log := `{"offset": 2.5, "currentFloor": 4, "destinationFloor": 1}
+{"currentFloor": 1, "destinationFloor": 4}
+`
+
+	replay, err := ReadCalls(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	times, passengers := drain(replay)
+	if times[0] != 0 || passengers[0].CurrentFloor != 1 || times[1] != 2500*time.Millisecond || passengers[1].CurrentFloor != 4 {
+		t.Errorf("Expected calls at 0s and 2.5s but got %v %+v", times, passengers)
+	}
+}
+
+func TestReadCallsReplaysRecordedTripsAsNewCalls(t *testing.T) {
+	log := `{"id": "a1", "currentFloor": 2, "destinationFloor": 9, "elevator": "0-1", "calledAt": "2016-06-01T08:00:10Z", "pickedUpAt": "2016-06-01T08:00:30Z", "reassignments": [{"from": "0-0", "reason": "expired"}]}
+{"id": "a1", "currentFloor": 6, "destinationFloor": 1, "calledAt": "2016-06-01T08:00:00Z"}
+`
+
+	replay, err := ReadCalls(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	times, passengers := drain(replay)
+	expected := []passenger.Passenger{{CurrentFloor: 6, DestinationFloor: 1}, {CurrentFloor: 2, DestinationFloor: 9}}
+	if times[0] != 0 || times[1] != 10*time.Second || !reflect.DeepEqual(passengers, expected) {
+		t.Errorf("Expected %+v at 0s and 10s but got %+v at %v", expected, passengers, times)
+	}
+}
+
+func TestReadCallsReportsBadLine(t *testing.T) {
+	_, err := ReadCalls(strings.NewReader("{\"currentFloor\": 1, \"destinationFloor\": 4}\nnot json\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "Line 2:") {
+		t.Errorf("Expected an error on line 2 but got %v", err)
+	}
+}
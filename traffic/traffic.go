@@ -0,0 +1,292 @@
+package traffic
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/davepersing/elevator-platform/passenger"
+)
+
+const (
+	// Named traffic profiles.
+	PROFILE_INTER_FLOOR = "inter-floor" // Passengers travel between random floors.
+	PROFILE_UP_PEAK     = "up-peak"     // Morning.  Most passengers travel up from the lobby.
+	PROFILE_DOWN_PEAK   = "down-peak"   // Evening.  Most passengers travel down to the lobby.
+	PROFILE_LUNCH       = "lunch"       // Passengers travel both to and from the lobby.
+)
+
+type (
+	// A stream of passengers calling elevators.
+	Source interface {
+		// Returns the next passenger and the time from the start of the stream they call an elevator at.
+		// Passengers are returned in order of their call time.  Returns false once there are no more passengers.
+		Next() (time.Duration, passenger.Passenger, bool)
+	}
+
+	// An origin/destination matrix.  Passengers per hour travelling from the first floor to the second.
+	Matrix map[int]map[int]float64
+
+	// A stretch of time with steady traffic.
+	Period struct {
+		Duration time.Duration
+		Matrix   Matrix
+	}
+
+	// Traffic over time, as periods one after another.
+	Profile []Period
+
+	// Generates passengers for a profile.  Each trip in a period arrives as its own Poisson process.
+	Generator struct {
+		rand    *rand.Rand
+		profile Profile
+
+		period int           // Index of the current period.
+		start  time.Duration // When the current period started.
+		now    time.Duration // When the last passenger arrived.
+		trips  []trip        // The trips of the current period, in a fixed order.
+		rate   float64       // Passengers per second in the current period.
+	}
+
+	// A trip between two floors and its rate in passengers per second.
+	trip struct {
+		from, to int
+		rate     float64
+	}
+)
+
+// Returns a generator of passengers for the profile.  The same seed always gives the same passengers.
+func New(profile Profile, seed int64) *Generator {
+	g := &Generator{rand: rand.New(rand.NewSource(seed)), profile: profile, period: -1}
+	g.nextPeriod()
+	return g
+}
+
+// Returns the next passenger.
+func (g *Generator) Next() (time.Duration, passenger.Passenger, bool) {
+	for g.period < len(g.profile) {
+		end := g.start + g.profile[g.period].Duration
+
+		if g.rate > 0 {
+			// Poisson arrivals are memoryless, so the wait can be drawn again from the start of the next period.
+			g.now += time.Duration(g.rand.ExpFloat64() / g.rate * float64(time.Second))
+			if g.now < end {
+				t := g.pick()
+				return g.now, passenger.Passenger{CurrentFloor: t.from, DestinationFloor: t.to}, true
+			}
+		}
+
+		g.now = end
+		g.nextPeriod()
+	}
+
+	return 0, passenger.Passenger{}, false
+}
+
+// Moves on to the next period of the profile.
+func (g *Generator) nextPeriod() {
+	if g.period >= 0 {
+		g.start += g.profile[g.period].Duration
+	}
+	g.period++
+
+	g.trips, g.rate = nil, 0
+	if g.period >= len(g.profile) {
+		return
+	}
+
+	g.trips = g.profile[g.period].Matrix.trips()
+	for _, t := range g.trips {
+		g.rate += t.rate
+	}
+}
+
+// Returns a trip picked at random, weighted by its rate.
+func (g *Generator) pick() trip {
+	r := g.rand.Float64() * g.rate
+	for _, t := range g.trips {
+		if r < t.rate {
+			return t
+		}
+		r -= t.rate
+	}
+	return g.trips[len(g.trips)-1]
+}
+
+// Returns the trips of the matrix with a rate in passengers per second, ordered by floor so
+// the same seed picks the same trips.
+func (m Matrix) trips() []trip {
+	var trips []trip
+	for from, row := range m {
+		for to, rate := range row {
+			if rate > 0 && from != to {
+				trips = append(trips, trip{from: from, to: to, rate: rate / 3600})
+			}
+		}
+	}
+
+	sort.Slice(trips, func(i, j int) bool {
+		if trips[i].from != trips[j].from {
+			return trips[i].from < trips[j].from
+		}
+		return trips[i].to < trips[j].to
+	})
+	return trips
+}
+
+// Adds rate passengers per hour travelling from one floor to another.
+func (m Matrix) Add(from, to int, rate float64) {
+	if m[from] == nil {
+		m[from] = make(map[int]float64)
+	}
+	m[from][to] += rate
+}
+
+// Adds every trip of another matrix, scaled by weight.
+func (m Matrix) Merge(other Matrix, weight float64) Matrix {
+	for from, row := range other {
+		for to, rate := range row {
+			m.Add(from, to, rate*weight)
+		}
+	}
+	return m
+}
+
+// Returns the total passengers per hour.
+func (m Matrix) Rate() float64 {
+	total := 0.0
+	for _, row := range m {
+		for _, rate := range row {
+			total += rate
+		}
+	}
+	return total
+}
+
+// Returns traffic arriving at each floor at its own rate in passengers per hour, each going to one of the
+// other floors at random.
+func ByFloor(rates map[int]float64, floors []int) Matrix {
+	m := make(Matrix)
+	for from, rate := range rates {
+		var destinations []int
+		for _, to := range floors {
+			if to != from {
+				destinations = append(destinations, to)
+			}
+		}
+
+		for _, to := range destinations {
+			m.Add(from, to, rate/float64(len(destinations)))
+		}
+	}
+	return m
+}
+
+// Returns rate passengers per hour travelling between random floors.
+func InterFloor(floors []int, rate float64) Matrix {
+	rates := make(map[int]float64)
+	for _, floor := range floors {
+		rates[floor] = rate / float64(len(floors))
+	}
+	return ByFloor(rates, floors)
+}
+
+// Returns rate passengers per hour travelling from the lobby to random floors.
+func FromLobby(lobby int, floors []int, rate float64) Matrix {
+	return ByFloor(map[int]float64{lobby: rate}, floors)
+}
+
+// Returns rate passengers per hour travelling from random floors to the lobby.
+func ToLobby(lobby int, floors []int, rate float64) Matrix {
+	m := make(Matrix)
+	upper := upperFloors(lobby, floors)
+	for _, floor := range upper {
+		m.Add(floor, lobby, rate/float64(len(upper)))
+	}
+	return m
+}
+
+// Returns morning traffic of rate passengers per hour.  85% travel up from the lobby, 10% between floors,
+// and 5% down to the lobby.
+func UpPeak(lobby int, floors []int, rate float64) Matrix {
+	return make(Matrix).
+		Merge(FromLobby(lobby, floors, rate), 0.85).
+		Merge(InterFloor(upperFloors(lobby, floors), rate), 0.10).
+		Merge(ToLobby(lobby, floors, rate), 0.05)
+}
+
+// Returns evening traffic of rate passengers per hour.  85% travel down to the lobby, 10% between floors,
+// and 5% up from the lobby.
+func DownPeak(lobby int, floors []int, rate float64) Matrix {
+	return make(Matrix).
+		Merge(ToLobby(lobby, floors, rate), 0.85).
+		Merge(InterFloor(upperFloors(lobby, floors), rate), 0.10).
+		Merge(FromLobby(lobby, floors, rate), 0.05)
+}
+
+// Returns two-way lunchtime traffic of rate passengers per hour.  45% travel down to the lobby, 45% up from it,
+// and 10% between floors.
+func Lunch(lobby int, floors []int, rate float64) Matrix {
+	return make(Matrix).
+		Merge(ToLobby(lobby, floors, rate), 0.45).
+		Merge(FromLobby(lobby, floors, rate), 0.45).
+		Merge(InterFloor(upperFloors(lobby, floors), rate), 0.10)
+}
+
+// Returns a profile of steady traffic with one of the named patterns for the given duration.
+func Named(name string, lobby int, floors []int, rate float64, duration time.Duration) (Profile, error) {
+	var m Matrix
+	switch name {
+	case PROFILE_INTER_FLOOR:
+		m = InterFloor(floors, rate)
+	case PROFILE_UP_PEAK:
+		m = UpPeak(lobby, floors, rate)
+	case PROFILE_DOWN_PEAK:
+		m = DownPeak(lobby, floors, rate)
+	case PROFILE_LUNCH:
+		m = Lunch(lobby, floors, rate)
+	default:
+		return nil, fmt.Errorf("Unknown traffic profile %q.  Expected one of: %v", name, Names())
+	}
+
+	return Profile{{Duration: duration, Matrix: m}}, nil
+}
+
+// Returns the names of the built-in profiles.
+func Names() []string {
+	return []string{PROFILE_INTER_FLOOR, PROFILE_UP_PEAK, PROFILE_DOWN_PEAK, PROFILE_LUNCH}
+}
+
+// Returns the floors other than the lobby.
+func upperFloors(lobby int, floors []int) []int {
+	var upper []int
+	for _, floor := range floors {
+		if floor != lobby {
+			upper = append(upper, floor)
+		}
+	}
+	return upper
+}
+
+// Calls fn with each passenger of the source at their call time, scaled by speed, in real time.
+// A speed of 2 plays the stream twice as fast.  A speed of 0 or less calls fn as fast as it returns.
+// Returns once the source has no more passengers.
+func Play(src Source, speed float64, fn func(at time.Duration, p passenger.Passenger)) {
+	start := time.Now()
+	for {
+		at, p, ok := src.Next()
+		if !ok {
+			return
+		}
+
+		if speed > 0 {
+			due := start.Add(time.Duration(float64(at) / speed))
+			if wait := due.Sub(time.Now()); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+
+		fn(at, p)
+	}
+}
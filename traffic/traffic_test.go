@@ -0,0 +1,141 @@
+package traffic
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davepersing/elevator-platform/passenger"
+)
+
+var floors = []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+// Draws every passenger from a source.
+func drain(src Source) ([]time.Duration, []passenger.Passenger) {
+	var times []time.Duration
+	var passengers []passenger.Passenger
+	for {
+		at, p, ok := src.Next()
+		if !ok {
+			return times, passengers
+		}
+		times = append(times, at)
+		passengers = append(passengers, p)
+	}
+}
+
+func TestMatrixRates(t *testing.T) {
+	for name, m := range map[string]Matrix{
+		PROFILE_INTER_FLOOR: InterFloor(floors, 600),
+		PROFILE_UP_PEAK:     UpPeak(1, floors, 600),
+		PROFILE_DOWN_PEAK:   DownPeak(1, floors, 600),
+		PROFILE_LUNCH:       Lunch(1, floors, 600),
+	} {
+		if rate := m.Rate(); math.Abs(rate-600) > 1e-9 {
+			t.Errorf("Expected %s to total 600 passengers per hour but got %v", name, rate)
+		}
+	}
+
+	up := UpPeak(1, floors, 600)
+	fromLobby := 0.0
+	for _, rate := range up[1] {
+		fromLobby += rate
+	}
+	if math.Abs(fromLobby-510) > 1e-9 {
+		t.Errorf("Expected 85%% of up-peak traffic from the lobby but got %v passengers per hour", fromLobby)
+	}
+}
+
+func TestGeneratorFollowsProfile(t *testing.T) {
+	profile := Profile{
+		{Duration: time.Hour, Matrix: UpPeak(1, floors, 1200)},
+		{Duration: time.Hour},
+		{Duration: time.Hour, Matrix: DownPeak(1, floors, 1200)},
+	}
+
+	times, passengers := drain(New(profile, 1))
+
+	var up, quiet, down, toLobby int
+	for i, at := range times {
+		if i > 0 && at < times[i-1] {
+			t.Fatalf("Passenger %d arrived before the one before it", i)
+		}
+
+		p := passengers[i]
+		if p.CurrentFloor == p.DestinationFloor {
+			t.Errorf("Passenger %d is already on their floor", i)
+		}
+
+		switch {
+		case at < time.Hour:
+			up++
+		case at < 2*time.Hour:
+			quiet++
+		case at < 3*time.Hour:
+			down++
+			if p.DestinationFloor == 1 {
+				toLobby++
+			}
+		default:
+			t.Errorf("Passenger %d arrived after the profile ended at %v", i, at)
+		}
+	}
+
+	if up < 1000 || up > 1400 || down < 1000 || down > 1400 {
+		t.Errorf("Expected about 1200 passengers in each peak but got %d and %d", up, down)
+	}
+
+	if quiet != 0 {
+		t.Errorf("Expected no passengers in the quiet hour but got %d", quiet)
+	}
+
+	if share := float64(toLobby) / float64(down); share < 0.8 || share > 0.9 {
+		t.Errorf("Expected about 85%% of down-peak passengers going to the lobby but got %.2f", share)
+	}
+}
+
+func TestGeneratorIsRepeatable(t *testing.T) {
+	profile, err := Named(PROFILE_LUNCH, 1, floors, 300, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firstTimes, first := drain(New(profile, 7))
+	secondTimes, second := drain(New(profile, 7))
+
+	if len(first) != len(second) {
+		t.Fatalf("Expected the same passengers from the same seed but got %d and %d", len(first), len(second))
+	}
+
+	for i := range first {
+		if firstTimes[i] != secondTimes[i] || !reflect.DeepEqual(first[i], second[i]) {
+			t.Fatalf("Passenger %d differs: %v %+v and %v %+v", i, firstTimes[i], first[i], secondTimes[i], second[i])
+		}
+	}
+}
+
+func TestNamedRejectsUnknownProfile(t *testing.T) {
+	if _, err := Named("rush-hour", 1, floors, 300, time.Hour); err == nil {
+		t.Error("Expected an error for an unknown profile")
+	}
+}
+
+func TestPlayScalesTime(t *testing.T) {
+	profile := Profile{{Duration: time.Second, Matrix: InterFloor(floors, 360000)}}
+
+	start := time.Now()
+	count := 0
+	Play(New(profile, 1), 10, func(at time.Duration, p passenger.Passenger) {
+		count++
+	})
+
+	// One second of traffic played ten times faster takes about a tenth of a second.
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected playback to take about 100ms but took %v", elapsed)
+	}
+
+	if count < 50 || count > 150 {
+		t.Errorf("Expected about 100 passengers but got %d", count)
+	}
+}
@@ -3,7 +3,9 @@ package util
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
 	"net/http"
 	"strconv"
 	"time"
@@ -29,9 +31,34 @@ func Abs(n int) int {
 }
 
 type (
+	// Computes jittered exponential backoff delays for retrying a failed operation.
+	Backoff struct {
+		Min time.Duration // The delay ceiling for the first retry.
+		Max time.Duration // The largest delay ceiling, no matter how many attempts have failed.
+
+		attempt uint
+	}
+
+	// The response to a successful elevator call.
 	SuccessResult struct {
 		ElevatorId string `json:"elevatorId"`
 		GroupId    string `json:"groupId"`
+		CallId     string `json:"callId"` // Identifies the call in the elevator's waiting queue.
+
+		PassengerId string `json:"passengerId"` // Looks up the passenger's trip at GET /passengers/{id}.
+
+		EstimatedPickup  int `json:"estimatedPickup"`            // Seconds until the elevator reaches the passenger.
+		EstimatedArrival int `json:"estimatedArrival,omitempty"` // Seconds until the passenger reaches their destination.  Left out for hall calls.
+
+		CurrentFloor int    `json:"currentFloor"` // The floor the elevator was on when the call was scheduled.
+		Direction    string `json:"direction"`    // The direction the elevator was travelling.  up, down, or none.
+		Reason       string `json:"reason"`       // Why the scheduler chose the elevator.
+	}
+
+	// The response to a failed elevator call.
+	ErrorResult struct {
+		Error         string `json:"error"`
+		TransferFloor int    `json:"transferFloor"` // Floor to change elevators at, or -1 if the trip can't be split.
 	}
 
 	Maintenance struct {
@@ -41,6 +68,27 @@ type (
 	}
 )
 
+// Returns how long to wait before the next retry.
+// The ceiling doubles with every attempt up to Max, and the delay is picked at random
+// between Min and the ceiling so retrying clients don't all reconnect at once.
+func (b *Backoff) Next() time.Duration {
+	ceiling := b.Max
+	if b.attempt < 32 && b.Min<<b.attempt < b.Max {
+		ceiling = b.Min << b.attempt
+	}
+	b.attempt++
+
+	if ceiling <= b.Min {
+		return b.Min
+	}
+	return b.Min + time.Duration(rand.Int63n(int64(ceiling-b.Min)))
+}
+
+// Resets the backoff after a successful attempt.
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
+
 func SendMaintenancePost(port string, elevatorId, groupId int, maintenance bool) (string, string, error) {
 	mr := Maintenance{
 		ElevatorId:  strconv.Itoa(elevatorId),
@@ -82,13 +130,18 @@ func SendMaintenancePost(port string, elevatorId, groupId int, maintenance bool)
 
 // Sends a POST request to a given URL with desired current and destination floors.
 // Creates a new passenger, serializes into JSON, and POSTs to the given endpoint.
-func SendPassengerPost(port string, currFloor, destFloor int) (string, string, error) {
+// Returns the elevator assigned to the passenger.
+func SendPassengerPost(port string, currFloor, destFloor int) (*SuccessResult, error) {
 	// Send the request to the random known node pool.
 	p := passenger.Passenger{CurrentFloor: currFloor, DestinationFloor: destFloor}
 	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
 	req, err := http.NewRequest("POST", "http://localhost"+port+"/elevator_call", bytes.NewBuffer(data))
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
 	// Set the JSON header.
@@ -99,18 +152,31 @@ func SendPassengerPost(port string, currFloor, destFloor int) (string, string, e
 	resp, err := client.Do(req)
 	if err != nil {
 		fmt.Printf("Error from port %s.  Error: %s\n", port, err.Error())
-		return "", "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	// Get the elevator to take.
 	decoder := json.NewDecoder(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		var failure ErrorResult
+		if err := decoder.Decode(&failure); err != nil || failure.Error == "" {
+			return nil, errors.New("Elevator call failed: " + resp.Status)
+		}
+
+		if failure.TransferFloor >= 0 {
+			return nil, fmt.Errorf("%s  Change elevators at floor %d.", failure.Error, failure.TransferFloor)
+		}
+		return nil, errors.New(failure.Error)
+	}
+
+	// Get the elevator to take.
 	var result SuccessResult
 	err = decoder.Decode(&result)
 	if err != nil {
 		fmt.Printf("Could not decode result of elevator request.  Error: %v\n", err)
-		return "", "", err
+		return nil, err
 	}
 
-	return result.ElevatorId, result.GroupId, nil
+	return &result, nil
 }
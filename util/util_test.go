@@ -0,0 +1,39 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffStaysWithinBounds(t *testing.T) {
+	b := Backoff{Min: 100 * time.Millisecond, Max: 2 * time.Second}
+
+	for i := 0; i < 50; i++ {
+		d := b.Next()
+		if d < b.Min || d > b.Max {
+			t.Fatalf("Attempt %d: delay %v outside of [%v, %v]", i, d, b.Min, b.Max)
+		}
+	}
+}
+
+func TestBackoffGrowsAndResets(t *testing.T) {
+	b := Backoff{Min: time.Millisecond, Max: time.Hour}
+
+	// The first delay is capped at Min.
+	if d := b.Next(); d != time.Millisecond {
+		t.Errorf("Expected first delay of 1ms but got %v", d)
+	}
+
+	for i := 0; i < 5; i++ {
+		b.Next()
+	}
+
+	if d := b.Next(); d > 64*time.Millisecond {
+		t.Errorf("Expected delay of at most 64ms after 7 attempts but got %v", d)
+	}
+
+	b.Reset()
+	if d := b.Next(); d != time.Millisecond {
+		t.Errorf("Expected delay of 1ms after reset but got %v", d)
+	}
+}